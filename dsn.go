@@ -0,0 +1,115 @@
+package kvstore
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// Open creates a store from a connection string of the form
+//
+//	scheme://[user:password@]host1:port1[,host2:port2...][/namespace][?param=value...]
+//
+// The scheme names the backend, e.g. etcd, etcdv3, zk, redis or
+// boltdb, which must be registered beforehand. The path, if any,
+// becomes the Namespace of the store. Without host, the path is
+// the single address instead, e.g. boltdb:///var/lib/kv.db.
+//
+// The supported parameters are timeout, operation_timeout and
+// wait_for_ready, as durations, bucket and persist_connection,
+// as a boolean.
+func Open(dsn string) (store.Store, error) {
+	u, err := url.Parse(dsn)
+	if uerr, ok := err.(*url.Error); ok {
+		// The error quotes dsn, password included
+		return nil, fmt.Errorf("invalid connection string %s: %v", redactString(dsn), uerr.Err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := initializers[u.Scheme]; !exists {
+		return nil, fmt.Errorf("no backend registered for scheme %q of %s", u.Scheme, redact(u))
+	}
+
+	options, err := parseParams(u.Query())
+	if err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		options.Username = u.User.Username()
+		options.Password, _ = u.User.Password()
+	}
+
+	var addrs []string
+	if u.Host == "" {
+		addrs = []string{u.Path}
+	} else {
+		addrs = strings.Split(u.Host, ",")
+		options.Namespace = strings.Trim(u.Path, "/")
+	}
+
+	return NewStore(u.Scheme, addrs, options)
+}
+
+// parseParams returns the config set by the query parameters
+// of a connection string
+func parseParams(params url.Values) (*store.Config, error) {
+	options := &store.Config{}
+	for name, values := range params {
+		value := values[len(values)-1]
+
+		var err error
+		switch name {
+		case "timeout":
+			options.ConnectionTimeout, err = time.ParseDuration(value)
+		case "operation_timeout":
+			options.OperationTimeout, err = time.ParseDuration(value)
+		case "wait_for_ready":
+			options.WaitForReady, err = time.ParseDuration(value)
+		case "bucket":
+			options.Bucket = value
+		case "persist_connection":
+			options.PersistConnection, err = strconv.ParseBool(value)
+		default:
+			return nil, fmt.Errorf("unknown connection parameter %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection parameter %s: %v", name, err)
+		}
+	}
+	return options, nil
+}
+
+// redact returns u without its password, for error messages
+func redact(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.User(u.User.Username())
+	return redacted.String()
+}
+
+// redactString strips the password of a connection string that
+// does not parse. Everything up to the last @ is taken as the
+// userinfo, wrongly so only when the path or query hold one and
+// then more than the password is left out.
+func redactString(dsn string) string {
+	start := 0
+	if i := strings.Index(dsn, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	at := strings.LastIndex(dsn[start:], "@")
+	if at < 0 {
+		return dsn
+	}
+	user := dsn[start : start+at]
+	if i := strings.Index(user, ":"); i >= 0 {
+		user = user[:i]
+	}
+	return dsn[:start] + user + dsn[start+at:]
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ArchiveExport writes the keys under prefix to w as a gzip
+// compressed tar, with one regular file per key whose path is the
+// key without its leading slash and whose content is the value.
+// The archive is portable across backends and can be inspected
+// with the standard tools.
+func ArchiveExport(ctx context.Context, s Store, prefix string, w io.Writer) error {
+	pairs, err := s.List(ctx, prefix)
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, pair := range pairs {
+		hdr := &tar.Header{
+			Name:     strings.TrimPrefix(Normalize(pair.Key), "/"),
+			Mode:     0644,
+			Size:     int64(len(pair.Value)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, pair.Value); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ArchiveImport writes the keys of an archive made by
+// ArchiveExport back to s. Only the entries under prefix are
+// imported. Keys already in the store are overwritten if
+// overwrite is set and left untouched otherwise.
+func ArchiveImport(ctx context.Context, s Store, prefix string, r io.Reader, overwrite bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	prefix = Normalize(prefix)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		key := Normalize(hdr.Name)
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		value, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		if overwrite {
+			_, err = s.Put(ctx, key, string(value), nil)
+		} else if err = s.AtomicPut(ctx, key, string(value), nil, nil); err == ErrKeyExists {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	src := newMapStore()
+	ctx := context.Background()
+	values := map[string]string{
+		"/app/a":     "1",
+		"/app/b/c":   "2",
+		"/app/empty": "",
+	}
+	for key, value := range values {
+		src.Put(ctx, key, value, nil)
+	}
+	src.Put(ctx, "/other", "3", nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, ArchiveExport(ctx, src, "app", &buf))
+
+	dst := newMapStore()
+	dst.Put(ctx, "/app/a", "kept", nil)
+	assert.NoError(t, ArchiveImport(ctx, dst, "app", bytes.NewReader(buf.Bytes()), false))
+
+	pairs, err := dst.List(ctx, "/")
+	assert.NoError(t, err)
+	got := map[string]string{}
+	for _, pair := range pairs {
+		got[pair.Key] = pair.Value
+	}
+	assert.Equal(t, map[string]string{"/app/a": "kept", "/app/b/c": "2", "/app/empty": ""}, got)
+
+	// Overwriting restores the exported contents
+	assert.NoError(t, ArchiveImport(ctx, dst, "app", bytes.NewReader(buf.Bytes()), true))
+	pair, err := dst.Get(ctx, "/app/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", pair.Value)
+
+	// Only entries under the prefix are imported
+	dst = newMapStore()
+	assert.NoError(t, ArchiveImport(ctx, dst, "app/b", bytes.NewReader(buf.Bytes()), false))
+	pairs, err = dst.List(ctx, "/")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, "/app/b/c", pairs[0].Key)
+	}
+
+	// An empty prefix exports an empty archive
+	buf.Reset()
+	assert.NoError(t, ArchiveExport(ctx, src, "missing", &buf))
+	assert.NoError(t, ArchiveImport(ctx, newMapStore(), "/", &buf, false))
+}
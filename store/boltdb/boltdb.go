@@ -0,0 +1,710 @@
+// Package boltdb implements store.Store over an embedded bolt
+// file, for single node deployments without any network
+// dependency.
+//
+// The file is locked by the process opening it, so that the
+// store has a single writer: watches are fed in-process by the
+// writes of the store, and locks are in-process mutexes.
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore"
+	"github.com/YuleiXiao/kvstore/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultBucket  = "kvstore"
+	defaultTimeout = 10 * time.Second
+
+	// sweepInterval is how often expired keys are removed,
+	// they are hidden from reads as soon as they expire
+	sweepInterval = time.Second
+)
+
+// BoltDB is the receiver type for the
+// Store interface
+type BoltDB struct {
+	db     *bolt.DB
+	bucket []byte
+
+	// writeMu orders the publication of the changes
+	// like their commits
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	locks    map[string]*boltLock
+	lockFree chan struct{}
+
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// record is the encoding of a pair in the bucket
+type record struct {
+	Value   string `json:"v"`
+	Index   uint64 `json:"i"`
+	Version uint64 `json:"ver"`
+	Create  uint64 `json:"c"`
+
+	// Expires is the expiry time of a key written with
+	// a TTL, in Unix nanoseconds
+	Expires int64 `json:"e,omitempty"`
+}
+
+func (r *record) expired(now time.Time) bool {
+	return r.Expires != 0 && now.UnixNano() >= r.Expires
+}
+
+func (r *record) pair(key string) *store.KVPair {
+	return &store.KVPair{
+		Key:         key,
+		Value:       r.Value,
+		Index:       r.Index,
+		Version:     r.Version,
+		CreateIndex: r.Create,
+	}
+}
+
+// Register registers boltdb to kvstore
+func Register() {
+	kvstore.AddStore(store.BOLTDB, New)
+}
+
+// New opens the bolt file given as first endpoint, creating
+// it if needed. The keys are kept in the bucket named by the
+// Bucket option, "kvstore" by default. ConnectionTimeout bounds
+// the wait for the lock of a file opened by another process.
+func New(endpoints []string, options *store.Config) (store.Store, error) {
+	if len(endpoints) == 0 {
+		return nil, store.ErrNotReachable
+	}
+
+	bucket := defaultBucket
+	timeout := defaultTimeout
+	if options != nil {
+		if options.Bucket != "" {
+			bucket = options.Bucket
+		}
+		if options.ConnectionTimeout != 0 {
+			timeout = options.ConnectionTimeout
+		}
+	}
+
+	db, err := bolt.Open(endpoints[0], 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &BoltDB{
+		db:       db,
+		bucket:   []byte(bucket),
+		watchers: make(map[*watcher]struct{}),
+		locks:    make(map[string]*boltLock),
+		lockFree: make(chan struct{}),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.sweep()
+
+	if options != nil && options.Namespace != "" {
+		return store.WithNamespace(s, options.Namespace), nil
+	}
+	return s, nil
+}
+
+// writer applies the writes of a bolt transaction, all made at
+// the same revision, and collects the changes to publish
+type writer struct {
+	b       *bolt.Bucket
+	now     time.Time
+	rev     uint64
+	changes []*store.WatchResponse
+}
+
+// revision returns the revision of the writes, allocating
+// it on the first one
+func (w *writer) revision() (uint64, error) {
+	if w.rev == 0 {
+		rev, err := w.b.NextSequence()
+		if err != nil {
+			return 0, err
+		}
+		w.rev = rev
+	}
+	return w.rev, nil
+}
+
+// get returns the record of key, nil if missing or expired
+func (w *writer) get(key string) (*record, error) {
+	return get(w.b, key, w.now)
+}
+
+func (w *writer) put(key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
+	prev, err := w.get(key)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := w.revision()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &record{Value: value, Index: rev, Version: 1, Create: rev}
+	if prev != nil {
+		r.Version = prev.Version + 1
+		r.Create = prev.Create
+	}
+	if opts != nil && opts.TTL > 0 {
+		r.Expires = w.now.Add(opts.TTL).UnixNano()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.b.Put([]byte(key), data); err != nil {
+		return nil, err
+	}
+
+	change := &store.WatchResponse{Action: store.ActionPut, Node: r.pair(key)}
+	if prev != nil {
+		change.PreNode = prev.pair(key)
+	}
+	w.changes = append(w.changes, change)
+	return r.pair(key), nil
+}
+
+// delete removes key, prev is its current record
+func (w *writer) delete(key string, prev *record) error {
+	rev, err := w.revision()
+	if err != nil {
+		return err
+	}
+	if err := w.b.Delete([]byte(key)); err != nil {
+		return err
+	}
+
+	w.changes = append(w.changes, &store.WatchResponse{
+		Action:  store.ActionDelete,
+		PreNode: prev.pair(key),
+		Node:    &store.KVPair{Key: key, Index: rev},
+	})
+	return nil
+}
+
+// update runs fn in a write transaction and publishes its
+// changes once committed
+func (s *BoltDB) update(fn func(w *writer) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var changes []*store.WatchResponse
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		w := &writer{b: tx.Bucket(s.bucket), now: time.Now()}
+		if err := fn(w); err != nil {
+			return err
+		}
+		changes = w.changes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publish(changes)
+	return nil
+}
+
+// get reads the record of key from b, nil if missing or expired
+func get(b *bolt.Bucket, key string, now time.Time) (*record, error) {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return nil, nil
+	}
+	r := &record{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.expired(now) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// Put a value at "key", returns the pair written with
+// its new index
+func (s *BoltDB) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
+	var pair *store.KVPair
+	err := s.update(func(w *writer) (err error) {
+		pair, err = w.put(store.Normalize(key), value, opts)
+		return err
+	})
+	return pair, err
+}
+
+// Get a value given its key
+func (s *BoltDB) Get(ctx context.Context, key string) (*store.KVPair, error) {
+	key = store.Normalize(key)
+
+	var r *record
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		r, err = get(tx.Bucket(s.bucket), key, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, store.ErrKeyNotFound
+	}
+	return r.pair(key), nil
+}
+
+// Delete the value at the specified key, deleting a
+// missing key is not an error
+func (s *BoltDB) Delete(ctx context.Context, key string) error {
+	key = store.Normalize(key)
+	return s.update(func(w *writer) error {
+		prev, err := w.get(key)
+		if err != nil || prev == nil {
+			return err
+		}
+		return w.delete(key, prev)
+	})
+}
+
+// Exists checks if the key exists inside the store
+func (s *BoltDB) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Get(ctx, key)
+	if err == store.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Update is an alias for Put with key exist
+func (s *BoltDB) Update(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	key = store.Normalize(key)
+	return s.update(func(w *writer) error {
+		prev, err := w.get(key)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return store.ErrKeyNotFound
+		}
+		_, err = w.put(key, value, opts)
+		return err
+	})
+}
+
+// Create is an alias for Put with key not exist
+func (s *BoltDB) Create(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	return s.AtomicPut(ctx, key, value, nil, opts)
+}
+
+// List the content of a given prefix, sorted by key
+func (s *BoltDB) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
+	prefix := store.Normalize(directory)
+	now := time.Now()
+
+	var pairs []*store.KVPair
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.bucket).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			r := &record{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			if !r.expired(now) {
+				pairs = append(pairs, r.pair(string(k)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+// DeleteTree deletes the keys under directory at once
+func (s *BoltDB) DeleteTree(ctx context.Context, directory string) error {
+	prefix := []byte(store.Normalize(directory))
+	return s.update(func(w *writer) error {
+		var keys []string
+		c := w.b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+
+		for _, key := range keys {
+			prev, err := w.get(key)
+			if err != nil {
+				return err
+			}
+			if prev == nil {
+				// Expired, left to the sweeper
+				continue
+			}
+			if err := w.delete(key, prev); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unchanged compares current to the pair read previously,
+// by Index or by value when previous carries no Index
+func unchanged(current *record, previous *store.KVPair) bool {
+	if previous.Index == 0 {
+		return current.Value == previous.Value
+	}
+	return current.Index == previous.Index
+}
+
+// AtomicPut puts a value at "key" if the key has not been
+// modified since previous was read, or creates it if
+// previous is nil
+func (s *BoltDB) AtomicPut(ctx context.Context, key, value string, previous *store.KVPair, opts *store.WriteOptions) error {
+	key = store.Normalize(key)
+	return s.update(func(w *writer) error {
+		cur, err := w.get(key)
+		if err != nil {
+			return err
+		}
+		if previous == nil && cur != nil {
+			return store.ErrKeyExists
+		}
+		if previous != nil && (cur == nil || !unchanged(cur, previous)) {
+			return store.ErrKeyModified
+		}
+		_, err = w.put(key, value, opts)
+		return err
+	})
+}
+
+// AtomicDelete deletes a value at "key" if the key
+// has not been modified in the meantime, throws an
+// error if this is the case
+func (s *BoltDB) AtomicDelete(ctx context.Context, key string, previous *store.KVPair) error {
+	if previous == nil {
+		return store.ErrPreviousNotSpecified
+	}
+
+	key = store.Normalize(key)
+	return s.update(func(w *writer) error {
+		cur, err := w.get(key)
+		if err != nil {
+			return err
+		}
+		if cur == nil || !unchanged(cur, previous) {
+			return store.ErrKeyModified
+		}
+		return w.delete(key, cur)
+	})
+}
+
+// sweep removes the expired keys until the store is closed
+func (s *BoltDB) sweep() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		// Scan in a read transaction, a write transaction
+		// costs a sync of the file and is only worth it when
+		// there is something to remove
+		var expired []string
+		now := time.Now()
+		s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(s.bucket).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				r := &record{}
+				if json.Unmarshal(v, r) == nil && r.expired(now) {
+					expired = append(expired, string(k))
+				}
+			}
+			return nil
+		})
+		if len(expired) == 0 {
+			continue
+		}
+
+		s.update(func(w *writer) error {
+			for _, key := range expired {
+				// Rewritten meanwhile unless still expired
+				data := w.b.Get([]byte(key))
+				if data == nil {
+					continue
+				}
+				r := &record{}
+				if json.Unmarshal(data, r) != nil || !r.expired(w.now) {
+					continue
+				}
+				if err := w.delete(key, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// Compact is not supported in boltdb, there is no history
+func (s *BoltDB) Compact(ctx context.Context, rev uint64, physical bool) error {
+	return store.ErrCallNotSupported
+}
+
+// CompactRevision is not supported in boltdb, there is no history
+func (s *BoltDB) CompactRevision(ctx context.Context) (uint64, error) {
+	return 0, store.ErrCallNotSupported
+}
+
+// NewTxn is not supported in boltdb
+func (s *BoltDB) NewTxn(ctx context.Context) (store.Txn, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+// Status checks the file is open
+func (s *BoltDB) Status(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// Close stops the sweeper and closes the file, closing again
+// returns the same error
+func (s *BoltDB) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.stopped
+		s.closeErr = s.db.Close()
+	})
+	return s.closeErr
+}
+
+// watcher queues the changes for a watch, writers never
+// block on a slow consumer
+type watcher struct {
+	key    string
+	prefix bool
+
+	mu    sync.Mutex
+	queue []*store.WatchResponse
+	ready chan struct{}
+}
+
+func (w *watcher) match(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// publish hands changes to the matching watchers
+func (s *BoltDB) publish(changes []*store.WatchResponse) {
+	if len(changes) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for w := range s.watchers {
+		queued := false
+		w.mu.Lock()
+		for _, c := range changes {
+			if w.match(c.Node.Key) {
+				copy := *c
+				w.queue = append(w.queue, &copy)
+				queued = true
+			}
+		}
+		w.mu.Unlock()
+
+		if queued {
+			select {
+			case w.ready <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Watch for changes on "key", see WatchTree
+func (s *BoltDB) Watch(ctx context.Context, key string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	return s.watch(ctx, key, false), nil
+}
+
+// WatchTree watches for changes on the keys under directory,
+// made by this store. The options are ignored. The channel is
+// closed once ctx is done or the store closed, after a last
+// response carrying ErrWatchFail.
+func (s *BoltDB) WatchTree(ctx context.Context, directory string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	return s.watch(ctx, directory, true), nil
+}
+
+func (s *BoltDB) watch(ctx context.Context, key string, prefix bool) <-chan *store.WatchResponse {
+	w := &watcher{
+		key:    store.Normalize(key),
+		prefix: prefix,
+		ready:  make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	resp := make(chan *store.WatchResponse)
+	go func() {
+		defer close(resp)
+
+		var seq uint64
+		fail := func() {
+			s.mu.Lock()
+			delete(s.watchers, w)
+			s.mu.Unlock()
+
+			seq++
+			resp <- &store.WatchResponse{Error: store.ErrWatchFail, Seq: seq}
+		}
+
+		for {
+			select {
+			case <-w.ready:
+			case <-ctx.Done():
+				fail()
+				return
+			case <-s.stop:
+				fail()
+				return
+			}
+
+			w.mu.Lock()
+			queue := w.queue
+			w.queue = nil
+			w.mu.Unlock()
+
+			for _, r := range queue {
+				seq++
+				r.Seq = seq
+				r.ReceivedAt = time.Now()
+				select {
+				case resp <- r:
+				case <-ctx.Done():
+					seq--
+					fail()
+					return
+				}
+			}
+		}
+	}()
+	return resp
+}
+
+// boltLock is an in-process mutex, locking again a
+// held lock returns right away
+type boltLock struct {
+	s   *BoltDB
+	key string
+}
+
+// NewLock creates an in-process lock for a given key. The
+// lock is not persisted and does not expire, the options
+// are ignored.
+func (s *BoltDB) NewLock(key string, opt *store.LockOptions) store.Locker {
+	return &boltLock{s: s, key: store.Normalize(key)}
+}
+
+// Lock acquires the lock, blocking until it is free or
+// ctx is done
+func (l *boltLock) Lock(ctx context.Context) error {
+	for {
+		ok, free := l.acquire()
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-free:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryLock acquires the lock if it is free, without
+// blocking. It returns false if the lock is held.
+func (l *boltLock) TryLock(ctx context.Context) (bool, error) {
+	ok, _ := l.acquire()
+	return ok, nil
+}
+
+// acquire takes the lock if it is free, or returns a
+// channel closed once a lock is released
+func (l *boltLock) acquire() (bool, <-chan struct{}) {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	switch l.s.locks[l.key] {
+	case l:
+		return true, nil
+	case nil:
+		l.s.locks[l.key] = l
+		return true, nil
+	}
+	return false, l.s.lockFree
+}
+
+// Unlock releases the lock, unlocking a lock that is
+// not held does nothing
+func (l *boltLock) Unlock(ctx context.Context) error {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	if l.s.locks[l.key] == l {
+		delete(l.s.locks, l.key)
+		close(l.s.lockFree)
+		l.s.lockFree = make(chan struct{})
+	}
+	return nil
+}
+
+// Extend does nothing on a held lock, locks do not expire
+func (l *boltLock) Extend(ctx context.Context, ttl time.Duration) error {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	if l.s.locks[l.key] != l {
+		return store.ErrLockNotHeld
+	}
+	return nil
+}
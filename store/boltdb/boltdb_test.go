@@ -0,0 +1,152 @@
+package boltdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore"
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/YuleiXiao/kvstore/testutils"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func makeBoltDBClient(t *testing.T, path string) store.Store {
+	kv, err := New([]string{path}, &store.Config{ConnectionTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("cannot create store: %v", err)
+	}
+	return kv
+}
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kvstore-boltdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "kv.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestRegister(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	Register()
+
+	kv, err := kvstore.NewStore(store.BOLTDB, []string{path}, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, kv)
+	defer kv.Close()
+
+	if _, ok := kv.(*BoltDB); !ok {
+		t.Fatal("Error registering and initializing boltdb")
+	}
+}
+
+func TestBoltDBStore(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	kv := makeBoltDBClient(t, path)
+	defer kv.Close()
+	defer func() {
+		// Closing twice is harmless
+		assert.NoError(t, kv.Close())
+	}()
+
+	testutils.RunCleanup(t, kv)
+	testutils.RunTestCommon(t, kv)
+	testutils.RunTestAtomic(t, kv)
+	testutils.RunTestWatch(t, kv)
+	testutils.RunTestLockV3(t, kv)
+}
+
+func TestPersistence(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	kv := makeBoltDBClient(t, path)
+	pair, err := kv.Put(ctx, "testPersistence/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testPersistence/b", "b", nil)
+	assert.NoError(t, err)
+	kv.Close()
+
+	// The pairs and the revisions survive a reopen
+	kv = makeBoltDBClient(t, path)
+	defer kv.Close()
+	assert.NoError(t, kv.Status(ctx))
+
+	got, err := kv.Get(ctx, "testPersistence/a")
+	assert.NoError(t, err)
+	assert.Equal(t, pair, got)
+
+	pairs, err := kv.List(ctx, "testPersistence/")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+
+	next, err := kv.Put(ctx, "testPersistence/a", "a2", nil)
+	assert.NoError(t, err)
+	assert.True(t, next.Index > pairs[1].Index)
+	assert.Equal(t, pair.CreateIndex, next.CreateIndex)
+	assert.Equal(t, uint64(2), next.Version)
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicDelete(ctx, "testPersistence/a", pair))
+}
+
+func TestPutTTL(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	kv := makeBoltDBClient(t, path)
+	defer kv.Close()
+
+	_, err := kv.Put(ctx, "testPutTTL", "v", &store.WriteOptions{TTL: 100 * time.Millisecond})
+	assert.NoError(t, err)
+
+	events, err := kv.Watch(ctx, "testPutTTL", nil)
+	assert.NoError(t, err)
+
+	// Hidden as soon as it expires, removed by the sweeper
+	time.Sleep(200 * time.Millisecond)
+	_, err = kv.Get(ctx, "testPutTTL")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, store.ActionDelete, e.Action)
+		assert.Equal(t, "v", e.PreNode.Value)
+	case <-time.After(3 * sweepInterval):
+		t.Fatal("key was not swept")
+	}
+}
+
+func TestSweepIdle(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	kv := makeBoltDBClient(t, path).(*BoltDB)
+	defer kv.Close()
+	_, err := kv.Put(context.Background(), "testSweepIdle", "v", nil)
+	assert.NoError(t, err)
+
+	// The id of a read transaction is the one of the last write
+	txID := func() (id int) {
+		kv.db.View(func(tx *bolt.Tx) error {
+			id = tx.ID()
+			return nil
+		})
+		return id
+	}
+
+	// Nothing expired, nothing written
+	before := txID()
+	time.Sleep(2*sweepInterval + sweepInterval/2)
+	assert.Equal(t, before, txID())
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+// CBOptions contains the circuit breaker parameters
+type CBOptions struct {
+	Threshold int           // consecutive failures opening the breaker, defaults to 5
+	Cooldown  time.Duration // time the breaker stays open, defaults to 10s
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow reports whether a call may reach the backend. Once
+// the cooldown has elapsed a single probe call is let through.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !isFailure(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// isFailure tells whether err denotes an unhealthy backend,
+// as opposed to the regular outcome of a call
+func isFailure(err error) bool {
+	switch err {
+	case nil, ErrKeyNotFound, ErrKeyExists, ErrKeyModified, ErrPreviousNotSpecified,
+		ErrCallNotSupported, ErrInvalidKey, context.Canceled:
+		return false
+	}
+	return true
+}
+
+type breakerStore struct {
+	Store
+	b *breaker
+}
+
+// WithCircuitBreaker wraps s with a circuit breaker. After
+// Threshold consecutive failures, calls fail immediately with
+// ErrCircuitOpen for Cooldown. A single call is then allowed
+// to probe the backend, closing the breaker if it succeeds.
+func WithCircuitBreaker(s Store, options CBOptions) Store {
+	b := &breaker{
+		threshold: options.Threshold,
+		cooldown:  options.Cooldown,
+	}
+	if b.threshold <= 0 {
+		b.threshold = defaultBreakerThreshold
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return &breakerStore{Store: s, b: b}
+}
+
+func (s *breakerStore) do(fn func() error) error {
+	if err := s.b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	s.b.record(err)
+	return err
+}
+
+func (s *breakerStore) Put(ctx context.Context, key, value string, options *WriteOptions) (pair *KVPair, err error) {
+	err = s.do(func() error {
+		pair, err = s.Store.Put(ctx, key, value, options)
+		return err
+	})
+	return pair, err
+}
+
+func (s *breakerStore) Get(ctx context.Context, key string) (pair *KVPair, err error) {
+	err = s.do(func() error {
+		pair, err = s.Store.Get(ctx, key)
+		return err
+	})
+	return pair, err
+}
+
+func (s *breakerStore) Delete(ctx context.Context, key string) error {
+	return s.do(func() error {
+		return s.Store.Delete(ctx, key)
+	})
+}
+
+func (s *breakerStore) Exists(ctx context.Context, key string) (exists bool, err error) {
+	err = s.do(func() error {
+		exists, err = s.Store.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (s *breakerStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.do(func() error {
+		return s.Store.Update(ctx, key, value, opts)
+	})
+}
+
+func (s *breakerStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.do(func() error {
+		return s.Store.Create(ctx, key, value, opts)
+	})
+}
+
+func (s *breakerStore) Watch(ctx context.Context, key string, opt *WatchOptions) (events <-chan *WatchResponse, err error) {
+	err = s.do(func() error {
+		events, err = s.Store.Watch(ctx, key, opt)
+		return err
+	})
+	return events, err
+}
+
+func (s *breakerStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (events <-chan *WatchResponse, err error) {
+	err = s.do(func() error {
+		events, err = s.Store.WatchTree(ctx, directory, opt)
+		return err
+	})
+	return events, err
+}
+
+func (s *breakerStore) List(ctx context.Context, directory string) (pairs []*KVPair, err error) {
+	err = s.do(func() error {
+		pairs, err = s.Store.List(ctx, directory)
+		return err
+	})
+	return pairs, err
+}
+
+func (s *breakerStore) DeleteTree(ctx context.Context, directory string) error {
+	return s.do(func() error {
+		return s.Store.DeleteTree(ctx, directory)
+	})
+}
+
+func (s *breakerStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	return s.do(func() error {
+		return s.Store.AtomicPut(ctx, key, value, previous, options)
+	})
+}
+
+func (s *breakerStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	return s.do(func() error {
+		return s.Store.AtomicDelete(ctx, key, previous)
+	})
+}
+
+func (s *breakerStore) Compact(ctx context.Context, rev uint64, physical bool) error {
+	return s.do(func() error {
+		return s.Store.Compact(ctx, rev, physical)
+	})
+}
+
+func (s *breakerStore) Status(ctx context.Context) error {
+	return s.do(func() error {
+		return s.Store.Status(ctx)
+	})
+}
+
+func (s *breakerStore) CompactRevision(ctx context.Context) (rev uint64, err error) {
+	err = s.do(func() error {
+		rev, err = s.Store.CompactRevision(ctx)
+		return err
+	})
+	return rev, err
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyStore fails every Get while err is set
+type flakyStore struct {
+	Store
+	err   error
+	calls int
+}
+
+func (s *flakyStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &KVPair{Key: key}, nil
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	backend := &flakyStore{err: errors.New("unreachable")}
+	kv := WithCircuitBreaker(backend, CBOptions{Threshold: 3, Cooldown: 100 * time.Millisecond})
+	ctx := context.Background()
+
+	// Not found is not a failure
+	backend.err = ErrKeyNotFound
+	for i := 0; i < 5; i++ {
+		_, err := kv.Get(ctx, "key")
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+
+	backend.err = errors.New("unreachable")
+	for i := 0; i < 3; i++ {
+		_, err := kv.Get(ctx, "key")
+		assert.Equal(t, backend.err, err)
+	}
+
+	// The breaker is open, calls fail fast
+	calls := backend.calls
+	for i := 0; i < 3; i++ {
+		_, err := kv.Get(ctx, "key")
+		assert.Equal(t, ErrCircuitOpen, err)
+	}
+	assert.Equal(t, calls, backend.calls)
+
+	// A failed probe opens the breaker again
+	time.Sleep(150 * time.Millisecond)
+	_, err := kv.Get(ctx, "key")
+	assert.Equal(t, backend.err, err)
+	_, err = kv.Get(ctx, "key")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// A successful probe closes it
+	backend.err = nil
+	time.Sleep(150 * time.Millisecond)
+	_, err = kv.Get(ctx, "key")
+	assert.NoError(t, err)
+	_, err = kv.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, calls+3, backend.calls)
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"encoding/json"
+
+	"golang.org/x/net/context"
+)
+
+// ValueEvent is a watch event whose values are decoded.
+// Previous is nil when the event has no previous value,
+// e.g. on creation, and Current is nil on deletion.
+type ValueEvent struct {
+	Error    error
+	Action   string
+	Previous interface{}
+	Current  interface{}
+	Response *WatchResponse
+}
+
+// WatchValue watches "key" and decodes the JSON values of
+// every event. newValue must return a pointer to a fresh
+// value to decode into, e.g. func() interface{} { return &T{} }.
+// Decoding failures are reported in the Error field.
+func WatchValue(ctx context.Context, s Store, key string, opt *WatchOptions, newValue func() interface{}) (<-chan *ValueEvent, error) {
+	events, err := s.Watch(ctx, key, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(chan *ValueEvent)
+	go func() {
+		defer close(resp)
+		for e := range events {
+			resp <- decodeEvent(e, newValue)
+		}
+	}()
+
+	return resp, nil
+}
+
+func decodeEvent(e *WatchResponse, newValue func() interface{}) *ValueEvent {
+	ve := &ValueEvent{Error: e.Error, Action: e.Action, Response: e}
+	if e.Error != nil {
+		return ve
+	}
+
+	decode := func(pair *KVPair) interface{} {
+		if pair == nil || ve.Error != nil {
+			return nil
+		}
+		v := newValue()
+		if err := json.Unmarshal([]byte(pair.Value), v); err != nil {
+			ve.Error = err
+			return nil
+		}
+		return v
+	}
+
+	ve.Previous = decode(e.PreNode)
+	if e.Action != ActionDelete {
+		ve.Current = decode(e.Node)
+	}
+	return ve
+}
+
+// UpdateJSON applies fn to the JSON value at "key" and writes
+// the result back with AtomicPut, retrying on concurrent
+// modifications until it succeeds or ctx is done. A missing
+// key is passed to fn as a nil value and created.
+func UpdateJSON(ctx context.Context, s Store, key string, fn func(raw json.RawMessage) (json.RawMessage, error), opts *WriteOptions) error {
+	for {
+		var raw json.RawMessage
+		previous, err := s.Get(ctx, key)
+		if err == nil {
+			raw = json.RawMessage(previous.Value)
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+
+		updated, err := fn(raw)
+		if err != nil {
+			return err
+		}
+
+		err = s.AtomicPut(ctx, key, string(updated), previous, opts)
+		switch err {
+		case ErrKeyModified, ErrKeyExists, ErrKeyNotFound:
+		default:
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// ownerField is the JSON field holding the owner of a key
+const ownerField = "owner"
+
+// TransferOwnership hands "key" over from fromOwner to toOwner.
+// The value must be a JSON object whose "owner" field names the
+// current owner, its other fields are kept. The update is a CAS
+// retried on concurrent modifications, it fails with ErrNotOwner
+// if the owner is not fromOwner and ErrKeyNotFound if the key
+// does not exist.
+func TransferOwnership(ctx context.Context, s Store, key, fromOwner, toOwner string) error {
+	return UpdateJSON(ctx, s, key, func(raw json.RawMessage) (json.RawMessage, error) {
+		if raw == nil {
+			return nil, ErrKeyNotFound
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+
+		var owner string
+		if err := json.Unmarshal(fields[ownerField], &owner); err != nil || owner != fromOwner {
+			return nil, ErrNotOwner
+		}
+
+		fields[ownerField], _ = json.Marshal(toOwner)
+		return json.Marshal(fields)
+	}, nil)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// watchStore serves a prepared channel to watchers
+type watchStore struct {
+	Store
+	events chan *WatchResponse
+}
+
+func (s *watchStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	return s.events, nil
+}
+
+type config struct {
+	Name    string
+	Retries int
+}
+
+func TestWatchValue(t *testing.T) {
+	kv := &watchStore{events: make(chan *WatchResponse, 3)}
+	kv.events <- &WatchResponse{
+		Action: ActionPut,
+		Node:   &KVPair{Key: "cfg", Value: `{"Name":"a","Retries":1}`},
+	}
+	kv.events <- &WatchResponse{
+		Action:  ActionPut,
+		PreNode: &KVPair{Key: "cfg", Value: `{"Name":"a","Retries":1}`},
+		Node:    &KVPair{Key: "cfg", Value: `{"Name":"a","Retries":2}`},
+	}
+	kv.events <- &WatchResponse{
+		Action:  ActionDelete,
+		PreNode: &KVPair{Key: "cfg", Value: `{"Name":"a","Retries":2}`},
+		Node:    &KVPair{Key: "cfg"},
+	}
+	close(kv.events)
+
+	events, err := WatchValue(context.Background(), kv, "cfg", nil, func() interface{} { return &config{} })
+	assert.NoError(t, err)
+
+	// Creation has no previous value
+	e := <-events
+	assert.NoError(t, e.Error)
+	assert.Nil(t, e.Previous)
+	assert.Equal(t, &config{Name: "a", Retries: 1}, e.Current)
+
+	e = <-events
+	assert.NoError(t, e.Error)
+	assert.Equal(t, &config{Name: "a", Retries: 1}, e.Previous)
+	assert.Equal(t, &config{Name: "a", Retries: 2}, e.Current)
+
+	e = <-events
+	assert.NoError(t, e.Error)
+	assert.Equal(t, ActionDelete, e.Action)
+	assert.Equal(t, &config{Name: "a", Retries: 2}, e.Previous)
+	assert.Nil(t, e.Current)
+
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestUpdateJSON(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	incr := func(raw json.RawMessage) (json.RawMessage, error) {
+		var cfg config
+		if raw != nil {
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return nil, err
+			}
+		}
+		cfg.Retries++
+		return json.Marshal(cfg)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, UpdateJSON(ctx, kv, "cfg", incr, nil))
+			}
+		}()
+	}
+	wg.Wait()
+
+	pair, err := kv.Get(ctx, "cfg")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Name":"","Retries":100}`, pair.Value)
+
+	// Errors of fn are returned untouched
+	failure := errors.New("failure")
+	err = UpdateJSON(ctx, kv, "cfg", func(json.RawMessage) (json.RawMessage, error) {
+		return nil, failure
+	}, nil)
+	assert.Equal(t, failure, err)
+}
+
+func TestTransferOwnership(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	kv.Put(ctx, "resource", `{"owner":"alice","size":3}`, nil)
+
+	assert.NoError(t, TransferOwnership(ctx, kv, "resource", "alice", "bob"))
+	pair, err := kv.Get(ctx, "resource")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"owner":"bob","size":3}`, pair.Value)
+
+	// alice no longer owns it
+	assert.Equal(t, ErrNotOwner, TransferOwnership(ctx, kv, "resource", "alice", "carol"))
+	pair, err = kv.Get(ctx, "resource")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"owner":"bob","size":3}`, pair.Value)
+
+	assert.Equal(t, ErrKeyNotFound, TransferOwnership(ctx, kv, "missing", "alice", "bob"))
+
+	kv.Put(ctx, "unowned", `{"size":3}`, nil)
+	assert.Equal(t, ErrNotOwner, TransferOwnership(ctx, kv, "unowned", "", "bob"))
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ConfigEvent carries a freshly loaded configuration, or the
+// error that prevented loading it
+type ConfigEvent struct {
+	Error  error
+	Config interface{}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadConfig fills the struct pointed to by dst from the direct
+// children of prefix. A field is mapped to the child named by its
+// `kv` tag, or to its lowercased name without one; a "-" tag skips
+// the field. String values are parsed into the field type: string,
+// bool, signed and unsigned integers, floats and time.Duration.
+// Fields without a matching key are left untouched.
+func LoadConfig(ctx context.Context, s Store, prefix string, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("LoadConfig: dst must be a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+
+	pairs, err := s.List(ctx, prefix)
+	if err == ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := Normalize(prefix) + "/"
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name := strings.TrimPrefix(Normalize(pair.Key), dir)
+		if name == Normalize(pair.Key) || strings.Contains(name, "/") {
+			// Not a direct child
+			continue
+		}
+		values[name] = pair.Value
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		name := field.Tag.Get("kv")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("LoadConfig: %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// WatchConfig loads the configuration under prefix, then loads it
+// again each time the prefix changes. Every load goes into a fresh
+// value returned by newDst, e.g. func() interface{} { return &T{} },
+// so the values received are never modified afterwards and keys
+// removed from the store reset their field to its default.
+func WatchConfig(ctx context.Context, s Store, prefix string, newDst func() interface{}) (<-chan *ConfigEvent, error) {
+	events, err := s.WatchTree(ctx, prefix, &WatchOptions{SkipInitialValues: true})
+	if err != nil {
+		return nil, err
+	}
+
+	load := func() *ConfigEvent {
+		dst := newDst()
+		if err := LoadConfig(ctx, s, prefix, dst); err != nil {
+			return &ConfigEvent{Error: err}
+		}
+		return &ConfigEvent{Config: dst}
+	}
+
+	resp := make(chan *ConfigEvent)
+	go func() {
+		defer close(resp)
+
+		// The watch is already set up, changes made
+		// while loading are not missed
+		select {
+		case resp <- load():
+		case <-ctx.Done():
+			return
+		}
+
+		for e := range events {
+			event := &ConfigEvent{Error: e.Error}
+			if e.Error == nil {
+				event = load()
+			}
+			select {
+			case resp <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return resp, nil
+}
+
+func setField(f reflect.Value, value string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
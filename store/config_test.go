@@ -0,0 +1,89 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// treeStore is a mapStore whose tree watchers are fed by hand
+type treeStore struct {
+	*mapStore
+	events chan *WatchResponse
+}
+
+func (s *treeStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	return s.events, nil
+}
+
+type appConfig struct {
+	Name    string
+	Timeout time.Duration `kv:"timeout"`
+	Retries int           `kv:"max-retries"`
+	Debug   bool
+	Ratio   float64
+	Skipped string `kv:"-"`
+}
+
+func TestLoadConfig(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	kv.Put(ctx, "app/name", "kvstore", nil)
+	kv.Put(ctx, "app/timeout", "1m30s", nil)
+	kv.Put(ctx, "app/max-retries", "3", nil)
+	kv.Put(ctx, "app/debug", "true", nil)
+	kv.Put(ctx, "app/ratio", "0.5", nil)
+	kv.Put(ctx, "app/skipped", "ignored", nil)
+	kv.Put(ctx, "app/nested/name", "ignored", nil)
+
+	cfg := appConfig{Skipped: "default"}
+	assert.NoError(t, LoadConfig(ctx, kv, "app", &cfg))
+	assert.Equal(t, appConfig{
+		Name:    "kvstore",
+		Timeout: 90 * time.Second,
+		Retries: 3,
+		Debug:   true,
+		Ratio:   0.5,
+		Skipped: "default",
+	}, cfg)
+
+	// Missing prefix leaves the struct untouched
+	assert.NoError(t, LoadConfig(ctx, kv, "other", &cfg))
+	assert.Equal(t, "kvstore", cfg.Name)
+
+	kv.Put(ctx, "app/debug", "maybe", nil)
+	assert.Error(t, LoadConfig(ctx, kv, "app", &cfg))
+	assert.Error(t, LoadConfig(ctx, kv, "app", cfg))
+}
+
+func TestWatchConfig(t *testing.T) {
+	kv := &treeStore{mapStore: newMapStore(), events: make(chan *WatchResponse, 1)}
+	ctx := context.Background()
+
+	kv.Put(ctx, "app/name", "kvstore", nil)
+	kv.Put(ctx, "app/max-retries", "3", nil)
+
+	events, err := WatchConfig(ctx, kv, "app", func() interface{} { return &appConfig{} })
+	assert.NoError(t, err)
+
+	e := <-events
+	assert.NoError(t, e.Error)
+	assert.Equal(t, &appConfig{Name: "kvstore", Retries: 3}, e.Config)
+
+	// Removed keys go back to their default
+	kv.Put(ctx, "app/max-retries", "5", nil)
+	delete(kv.data, "/app/name")
+	kv.events <- &WatchResponse{Action: ActionPut}
+
+	e = <-events
+	assert.NoError(t, e.Error)
+	assert.Equal(t, &appConfig{Retries: 5}, e.Config)
+
+	close(kv.events)
+	_, ok := <-events
+	assert.False(t, ok)
+}
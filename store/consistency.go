@@ -0,0 +1,35 @@
+package store
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Consistency is the consistency level of a read request
+type Consistency int
+
+const (
+	// Linearizable reads go through the quorum and always
+	// observe the latest committed write. This is the default.
+	Linearizable Consistency = iota
+
+	// Serializable reads are served by the local member
+	// without a quorum round trip. They are faster but may
+	// return stale data.
+	Serializable
+)
+
+type consistencyKey struct{}
+
+// WithConsistency returns a copy of ctx carrying the given read
+// consistency. Backends honor it on Get and List, overriding
+// their default for that call only.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the read consistency set by
+// WithConsistency, ok is false if none was set.
+func ConsistencyFromContext(ctx context.Context) (c Consistency, ok bool) {
+	c, ok = ctx.Value(consistencyKey{}).(Consistency)
+	return c, ok
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+// incrementAttempts bounds the CAS attempts of Increment
+const incrementAttempts = 1000
+
+// Increment atomically adds delta to the integer counter at
+// "key" and returns its new value. A missing key is created at
+// delta. The update is a CAS on the revision of the counter,
+// retried on concurrent modifications; ErrKeyModified is
+// returned if it keeps failing.
+func Increment(ctx context.Context, s Store, key string, delta int64) (int64, error) {
+	for i := 0; i < incrementAttempts; i++ {
+		var count int64
+		previous, err := s.Get(ctx, key)
+		if err == nil {
+			if count, err = strconv.ParseInt(previous.Value, 10, 64); err != nil {
+				return 0, err
+			}
+		} else if err != ErrKeyNotFound {
+			return 0, err
+		}
+
+		count += delta
+		err = s.AtomicPut(ctx, key, strconv.FormatInt(count, 10), previous, nil)
+		switch err {
+		case nil:
+			return count, nil
+		case ErrKeyModified, ErrKeyExists, ErrKeyNotFound:
+		default:
+			return 0, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return 0, ErrKeyModified
+}
+
+// Decrement atomically subtracts delta from the integer counter
+// at "key", see Increment
+func Decrement(ctx context.Context, s Store, key string, delta int64) (int64, error) {
+	return Increment(ctx, s, key, -delta)
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrement(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	// Created at delta
+	count, err := Decrement(ctx, kv, "counter", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-5), count)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := Increment(ctx, kv, "counter", 2)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pair, err := kv.Get(ctx, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "395", pair.Value)
+
+	kv.Put(ctx, "name", "not a number", nil)
+	_, err = Increment(ctx, kv, "name", 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// DryRunChange is a modification recorded by a DryRunStore
+type DryRunChange struct {
+	Op   string   // name of the Store method, e.g. "DeleteTree"
+	Keys []string // normalized keys that would be changed
+}
+
+// DryRunStore is a Store that records the modifications it is
+// asked for instead of making them, see WithDryRun
+type DryRunStore struct {
+	Store
+
+	mu      sync.Mutex
+	changes []DryRunChange
+}
+
+// WithDryRun wraps s so that destructive calls modify nothing:
+// the keys they would change are recorded, to be reviewed with
+// Changes, and the calls succeed. Reads go through to s, which
+// is used to find the keys under a directory. Transactions are
+// not supported.
+func WithDryRun(s Store) *DryRunStore {
+	return &DryRunStore{Store: s}
+}
+
+// Changes returns the modifications recorded so far, in order
+func (s *DryRunStore) Changes() []DryRunChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DryRunChange(nil), s.changes...)
+}
+
+func (s *DryRunStore) record(op string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, DryRunChange{Op: op, Keys: keys})
+}
+
+// Put records key and returns the pair that would be written
+func (s *DryRunStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	s.record("Put", Normalize(key))
+	return &KVPair{Key: Normalize(key), Value: value}, nil
+}
+
+func (s *DryRunStore) Delete(ctx context.Context, key string) error {
+	s.record("Delete", Normalize(key))
+	return nil
+}
+
+func (s *DryRunStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	s.record("Update", Normalize(key))
+	return nil
+}
+
+func (s *DryRunStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	s.record("Create", Normalize(key))
+	return nil
+}
+
+// DeleteTree records every key currently under directory
+func (s *DryRunStore) DeleteTree(ctx context.Context, directory string) error {
+	pairs, err := s.Store.List(ctx, directory)
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	s.record("DeleteTree", keys...)
+	return nil
+}
+
+func (s *DryRunStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	s.record("AtomicPut", Normalize(key))
+	return nil
+}
+
+func (s *DryRunStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	s.record("AtomicDelete", Normalize(key))
+	return nil
+}
+
+// Compact records no key, only the call
+func (s *DryRunStore) Compact(ctx context.Context, rev uint64, physical bool) error {
+	s.record("Compact")
+	return nil
+}
+
+// NewTxn is not supported, a transaction cannot be previewed
+// without evaluating its comparisons
+func (s *DryRunStore) NewTxn(ctx context.Context) (Txn, error) {
+	return nil, ErrCallNotSupported
+}
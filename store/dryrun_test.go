@@ -0,0 +1,40 @@
+package store
+
+import (
+	"sort"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDryRun(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+	for _, key := range []string{"app/a", "app/b", "other"} {
+		backend.Put(ctx, key, "v", nil)
+	}
+
+	kv := WithDryRun(backend)
+	assert.NoError(t, kv.DeleteTree(ctx, "app"))
+	_, err := kv.Put(ctx, "app/c", "new", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.DeleteTree(ctx, "missing"))
+
+	changes := kv.Changes()
+	if assert.Len(t, changes, 3) {
+		sort.Strings(changes[0].Keys)
+		assert.Equal(t, DryRunChange{Op: "DeleteTree", Keys: []string{"/app/a", "/app/b"}}, changes[0])
+		assert.Equal(t, DryRunChange{Op: "Put", Keys: []string{"/app/c"}}, changes[1])
+		assert.Equal(t, "DeleteTree", changes[2].Op)
+		assert.Empty(t, changes[2].Keys)
+	}
+
+	// Nothing was changed
+	pairs, err := backend.List(ctx, "app")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+	_, err = kv.Get(ctx, "app/c")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
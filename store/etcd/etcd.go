@@ -70,8 +70,12 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 
 	// Set options
 	if options != nil {
-		if options.TLS != nil {
-			setTLS(cfg, options.TLS, addrs)
+		tlsConfig, err := store.TLSConfig(options)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			setTLS(cfg, tlsConfig, addrs)
 		}
 		if options.ConnectionTimeout != 0 {
 			setTimeout(cfg, options.ConnectionTimeout)
@@ -97,6 +101,9 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 		}
 	}()
 
+	if options != nil && options.Namespace != "" {
+		return store.WithNamespace(s, options.Namespace), nil
+	}
 	return s, nil
 }
 
@@ -144,12 +151,19 @@ func keyNotFound(err error) bool {
 	return false
 }
 
+// quorum reports whether reads should go through the quorum,
+// according to the consistency carried by ctx
+func quorum(ctx context.Context) bool {
+	c, ok := store.ConsistencyFromContext(ctx)
+	return !ok || c == store.Linearizable
+}
+
 // Get the value at "key", returns the last modified
 // index to use in conjunction to Atomic calls
 func (s *Etcd) Get(ctx context.Context, key string) (pair *store.KVPair, err error) {
 	key = store.Normalize(key)
 	getOpts := &etcd.GetOptions{
-		Quorum: true,
+		Quorum: quorum(ctx),
 	}
 
 	result, err := s.client.Get(ctx, key, getOpts)
@@ -170,7 +184,7 @@ func (s *Etcd) Get(ctx context.Context, key string) (pair *store.KVPair, err err
 }
 
 // Put a value at "key"
-func (s *Etcd) Put(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+func (s *Etcd) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
 	setOpts := &etcd.SetOptions{}
 
 	// Set options
@@ -179,8 +193,16 @@ func (s *Etcd) Put(ctx context.Context, key, value string, opts *store.WriteOpti
 		setOpts.TTL = opts.TTL
 	}
 
-	_, err := s.client.Set(ctx, store.Normalize(key), value, setOpts)
-	return err
+	resp, err := s.client.Set(ctx, store.Normalize(key), value, setOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.KVPair{
+		Key:   store.Normalize(key),
+		Value: value,
+		Index: resp.Node.ModifiedIndex,
+	}, nil
 }
 
 // Delete a value at "key"
@@ -273,9 +295,13 @@ func (s *Etcd) watch(ctx context.Context, key string, opt *store.WatchOptions, r
 	resp := make(chan *store.WatchResponse)
 	go func() {
 		defer close(resp)
+		var seq uint64
 		for {
 			r, err := watcher.Next(ctx)
-			resp <- s.makeWatchResponse(r, err)
+			seq++
+			wr := s.makeWatchResponse(r, err)
+			wr.Seq = seq
+			resp <- wr
 			if err != nil {
 				return
 			}
@@ -377,7 +403,7 @@ func (s *Etcd) AtomicDelete(ctx context.Context, key string, previous *store.KVP
 // List child nodes of a given directory
 func (s *Etcd) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
 	getOpts := &etcd.GetOptions{
-		Quorum:    true,
+		Quorum:    quorum(ctx),
 		Recursive: true,
 		Sort:      true,
 	}
@@ -572,17 +598,39 @@ func (l *etcdLock) Unlock(ctx context.Context) error {
 	return nil
 }
 
+// TryLock is not supported, Lock blocks until the lock is free
+func (l *etcdLock) TryLock(ctx context.Context) (bool, error) {
+	return false, store.ErrCallNotSupported
+}
+
+// Extend is not supported in etcdv2, the lock TTL is
+// renewed automatically while it is held.
+func (l *etcdLock) Extend(ctx context.Context, ttl time.Duration) error {
+	return store.ErrCallNotSupported
+}
+
 // Compact compacts etcd KV history before the given rev. But not support in etcdv2.
-func (s *Etcd) Compact(ctx context.Context, rev uint64, wait bool) error {
+func (s *Etcd) Compact(ctx context.Context, rev uint64, physical bool) error {
 	return store.ErrCallNotSupported
 }
 
+// CompactRevision is not supported in etcdv2, there is no history.
+func (s *Etcd) CompactRevision(ctx context.Context) (uint64, error) {
+	return 0, store.ErrCallNotSupported
+}
+
 // NewTxn creates a transaction Txn. But not support in etcdv2.
 func (s *Etcd) NewTxn(ctx context.Context) (store.Txn, error) {
 	return nil, store.ErrCallNotSupported
 }
 
+// Status checks the cluster is serving with a read of the root
+func (s *Etcd) Status(ctx context.Context) error {
+	_, err := s.client.Get(ctx, "/", &etcd.GetOptions{Quorum: quorum(ctx)})
+	return err
+}
+
 // Close closes the client connection
-func (s *Etcd) Close() {
-	return
+func (s *Etcd) Close() error {
+	return nil
 }
@@ -0,0 +1,37 @@
+package etcdv3
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffMax  = 30 * time.Second
+)
+
+// backoff computes exponentially growing retry intervals
+// with jitter, capped at max
+type backoff struct {
+	cur time.Duration
+	max time.Duration
+}
+
+func newBackoff(max time.Duration) *backoff {
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	return &backoff{cur: defaultBackoffBase, max: max}
+}
+
+// next returns the interval to wait before the next attempt
+func (b *backoff) next() time.Duration {
+	d := b.cur + time.Duration(rand.Int63n(int64(b.cur)/2+1))
+	if d > b.max {
+		d = b.max
+	}
+	if b.cur < b.max {
+		b.cur *= 2
+	}
+	return d
+}
@@ -0,0 +1,246 @@
+package etcdv3
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// ExistsMany checks the existence of several keys in read
+// transactions of at most maxTxnOps gets, a single round trip
+// for most calls. Only counts are fetched, values are never
+// transferred. The result maps every given key to whether
+// it exists in the store.
+//
+// Like GetMulti, the chunks past the first are read at the
+// revision of the first one.
+func (s *Etcd) ExistsMany(ctx context.Context, keys []string) (map[string]bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists := make(map[string]bool, len(keys))
+	var rev int64
+	for start := 0; start < len(keys); start += maxTxnOps {
+		end := start + maxTxnOps
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ops := make([]etcd.Op, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, etcd.OpGet(store.Normalize(key), etcd.WithCountOnly(), etcd.WithRev(rev)))
+		}
+
+		resp, err := s.client.Txn(ctx).Then(ops...).Commit()
+		if err == rpctypes.ErrCompacted {
+			return nil, store.ErrCompacted
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rev == 0 {
+			rev = resp.Header.Revision
+		}
+
+		for i, r := range resp.Responses {
+			exists[keys[start+i]] = r.GetResponseRange().Count > 0
+		}
+	}
+
+	return exists, nil
+}
+
+// GetMulti fetches several keys in read transactions of at most
+// maxTxnOps gets, a single round trip for most calls. The chunks
+// past the first are read at the revision of the first one, so
+// that the result is a consistent view. The pairs are keyed as
+// given, missing keys are left out: when none of the keys exists
+// the map is empty and the error nil.
+func (s *Etcd) GetMulti(ctx context.Context, keys []string) (map[string]*store.KVPair, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pairs := make(map[string]*store.KVPair, len(keys))
+	var rev int64
+	for start := 0; start < len(keys); start += maxTxnOps {
+		end := start + maxTxnOps
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ops := make([]etcd.Op, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, etcd.OpGet(store.Normalize(key), etcd.WithRev(rev)))
+		}
+
+		resp, err := s.client.Txn(ctx).Then(ops...).Commit()
+		if err == rpctypes.ErrCompacted {
+			return nil, store.ErrCompacted
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rev == 0 {
+			rev = resp.Header.Revision
+		}
+
+		for i, r := range resp.Responses {
+			if kvs := r.GetResponseRange().Kvs; len(kvs) > 0 {
+				pairs[keys[start+i]] = newKVPair(kvs[0])
+			}
+		}
+	}
+
+	return pairs, nil
+}
+
+// GetManyIfChanged fetches several keys in read transactions,
+// skipping the ones the caller already holds: known maps every
+// key to the revision the caller has, zero if none, and only keys
+// modified after it are returned, keyed as given. Filtering
+// happens on the server so unchanged values are never
+// transferred. The keys the caller holds that no longer exist are
+// returned apart, sorted, while other missing keys are omitted.
+//
+// Like GetMulti, the transactions are chunked at maxTxnOps and
+// read at the revision of the first one.
+func (s *Etcd) GetManyIfChanged(ctx context.Context, known map[string]int64) (map[string]*store.KVPair, []string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys := make([]string, 0, len(known))
+	for key := range known {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Every key takes a filtered get and a count telling
+	// whether it still exists
+	const chunk = maxTxnOps / 2
+
+	changed := make(map[string]*store.KVPair)
+	var deleted []string
+	var rev int64
+	for start := 0; start < len(keys); start += chunk {
+		end := start + chunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ops := make([]etcd.Op, 0, 2*(end-start))
+		for _, key := range keys[start:end] {
+			ops = append(ops,
+				etcd.OpGet(store.Normalize(key), etcd.WithMinModRev(known[key]+1), etcd.WithRev(rev)),
+				etcd.OpGet(store.Normalize(key), etcd.WithCountOnly(), etcd.WithRev(rev)))
+		}
+
+		resp, err := s.client.Txn(ctx).Then(ops...).Commit()
+		if err == rpctypes.ErrCompacted {
+			return nil, nil, store.ErrCompacted
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if rev == 0 {
+			rev = resp.Header.Revision
+		}
+
+		for i, key := range keys[start:end] {
+			if kvs := resp.Responses[2*i].GetResponseRange().Kvs; len(kvs) > 0 {
+				changed[key] = newKVPair(kvs[0])
+			} else if known[key] > 0 && resp.Responses[2*i+1].GetResponseRange().Count == 0 {
+				deleted = append(deleted, key)
+			}
+		}
+	}
+
+	return changed, deleted, nil
+}
+
+// CreateMany creates several keys in one transaction, only if
+// none of them exists: either all are created or none is. When
+// some exist it returns them, as given and sorted, along with
+// ErrKeyExists. A TTL in opts applies to every key, it fails with
+// ErrInvalidTTL under one second, the granularity of leases.
+func (s *Etcd) CreateMany(ctx context.Context, pairs map[string]string, opts *store.WriteOptions) ([]string, error) {
+	if len(pairs) > maxTxnOps {
+		return nil, store.ErrTooManyOperations
+	}
+	if opts != nil && opts.TTL > 0 && opts.TTL < time.Second {
+		return nil, store.ErrInvalidTTL
+	}
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := checkDuplicates(keys); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
+	var putOpts []etcd.OpOption
+	var lease etcd.LeaseID
+	if opts != nil && opts.TTL > 0 {
+		resp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
+		if err != nil {
+			return nil, err
+		}
+		lease = resp.ID
+		putOpts = append(putOpts, etcd.WithLease(lease))
+	}
+
+	cmps := make([]etcd.Cmp, 0, len(keys))
+	puts := make([]etcd.Op, 0, len(keys))
+	gets := make([]etcd.Op, 0, len(keys))
+	for _, key := range keys {
+		value := pairs[key]
+		nkey := store.Normalize(key)
+		s.observeValue(nkey, value)
+		cmps = append(cmps, etcd.Compare(etcd.CreateRevision(nkey), "=", 0))
+		puts = append(puts, etcd.OpPut(nkey, value, putOpts...))
+		gets = append(gets, etcd.OpGet(nkey, etcd.WithCountOnly()))
+	}
+
+	resp, err := s.client.Txn(ctx).If(cmps...).Then(puts...).Else(gets...).Commit()
+	if err == nil && resp.Succeeded {
+		return nil, nil
+	}
+	// Nothing was written, the lease would only linger
+	if lease != etcd.NoLease {
+		s.client.Revoke(ctx, lease)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for i, r := range resp.Responses {
+		if r.GetResponseRange().Count > 0 {
+			conflicts = append(conflicts, keys[i])
+		}
+	}
+	return conflicts, store.ErrKeyExists
+}
+
+// checkDuplicates returns ErrDuplicateKey if keys holds the same
+// key twice once normalized: etcd rejects transactions writing a
+// key more than once, and last-wins would hide a caller bug
+func checkDuplicates(keys []string) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = store.Normalize(key)
+		if seen[key] {
+			return store.ErrDuplicateKey
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package etcdv3
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExistsMany(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testExistsMany")
+
+	_, err := kv.Put(ctx, "testExistsMany/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testExistsMany/c", "c", nil)
+	assert.NoError(t, err)
+
+	exists, err := kv.ExistsMany(ctx, []string{
+		"testExistsMany/a",
+		"testExistsMany/b",
+		"testExistsMany/c",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"testExistsMany/a": true,
+		"testExistsMany/b": false,
+		"testExistsMany/c": true,
+	}, exists)
+
+	exists, err = kv.ExistsMany(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, exists)
+
+	// More keys than a single transaction allows
+	var keys []string
+	for i := 0; i < maxTxnOps+10; i++ {
+		key := fmt.Sprintf("testExistsMany/%d", i)
+		keys = append(keys, key)
+		if i%2 == 0 {
+			_, err := kv.Put(ctx, key, "v", nil)
+			assert.NoError(t, err)
+		}
+	}
+	exists, err = kv.ExistsMany(ctx, keys)
+	assert.NoError(t, err)
+	assert.Len(t, exists, len(keys))
+	for i, key := range keys {
+		assert.Equal(t, i%2 == 0, exists[key], key)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testGetMulti")
+
+	// More keys than a single transaction allows
+	var keys []string
+	for i := 0; i < maxTxnOps+10; i++ {
+		key := fmt.Sprintf("testGetMulti/%d", i)
+		keys = append(keys, key)
+		if i%2 == 0 {
+			_, err := kv.Put(ctx, key, fmt.Sprint(i), nil)
+			assert.NoError(t, err)
+		}
+	}
+
+	pairs, err := kv.GetMulti(ctx, keys)
+	assert.NoError(t, err)
+	assert.Len(t, pairs, (maxTxnOps+10)/2)
+	for i, key := range keys {
+		pair, ok := pairs[key]
+		if i%2 == 1 {
+			assert.False(t, ok)
+		} else if assert.True(t, ok) {
+			assert.Equal(t, fmt.Sprint(i), pair.Value)
+		}
+	}
+
+	pairs, err = kv.GetMulti(ctx, []string{"testGetMulti/missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, pairs)
+}
+
+func TestGetManyIfChanged(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testGetManyIfChanged")
+
+	a, err := kv.Put(ctx, "testGetManyIfChanged/a", "a", nil)
+	assert.NoError(t, err)
+	b, err := kv.Put(ctx, "testGetManyIfChanged/b", "b", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testGetManyIfChanged/b", "b2", nil)
+	assert.NoError(t, err)
+	d, err := kv.Put(ctx, "testGetManyIfChanged/d", "d", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Delete(ctx, "testGetManyIfChanged/d"))
+
+	changed, deleted, err := kv.GetManyIfChanged(ctx, map[string]int64{
+		"testGetManyIfChanged/a":       int64(a.Index),
+		"testGetManyIfChanged/b":       int64(b.Index),
+		"testGetManyIfChanged/c":       0,
+		"testGetManyIfChanged/d":       int64(d.Index),
+		"testGetManyIfChanged/missing": 0,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	if assert.NotNil(t, changed["testGetManyIfChanged/b"]) {
+		assert.Equal(t, "b2", changed["testGetManyIfChanged/b"].Value)
+	}
+
+	// The deleted key is told apart from the unchanged one
+	assert.Equal(t, []string{"testGetManyIfChanged/d"}, deleted)
+
+	// Unknown keys are always fetched
+	changed, deleted, err = kv.GetManyIfChanged(ctx, map[string]int64{"testGetManyIfChanged/a": 0})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+	if assert.NotNil(t, changed["testGetManyIfChanged/a"]) {
+		assert.Equal(t, "a", changed["testGetManyIfChanged/a"].Value)
+	}
+
+	changed, deleted, err = kv.GetManyIfChanged(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Empty(t, deleted)
+
+	// More keys than a transaction holds
+	known := make(map[string]int64)
+	for i := 0; i < 3*maxTxnOps; i++ {
+		known[fmt.Sprintf("testGetManyIfChanged/many/%d", i)] = int64(a.Index)
+	}
+	known["testGetManyIfChanged/a"] = 0
+	changed, deleted, err = kv.GetManyIfChanged(ctx, known)
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	assert.Len(t, deleted, 3*maxTxnOps)
+}
+
+func TestCreateMany(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testCreateMany")
+
+	conflicts, err := kv.CreateMany(ctx, map[string]string{
+		"testCreateMany/svc/registration": "r",
+		"testCreateMany/svc/health":       "h",
+	}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	pairs, err := kv.List(ctx, "testCreateMany/svc")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+
+	// One key exists, none is created
+	conflicts, err = kv.CreateMany(ctx, map[string]string{
+		"testCreateMany/svc/health":   "h2",
+		"testCreateMany/svc/metadata": "m",
+	}, nil)
+	assert.Equal(t, store.ErrKeyExists, err)
+	assert.Equal(t, []string{"testCreateMany/svc/health"}, conflicts)
+
+	exists, err := kv.Exists(ctx, "testCreateMany/svc/metadata")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	pair, err := kv.Get(ctx, "testCreateMany/svc/health")
+	assert.NoError(t, err)
+	assert.Equal(t, "h", pair.Value)
+
+	// The lease of a failed attempt is revoked
+	before, err := kv.client.Leases(ctx)
+	assert.NoError(t, err)
+	_, err = kv.CreateMany(ctx, map[string]string{
+		"testCreateMany/svc/health": "h2",
+	}, &store.WriteOptions{TTL: 10 * time.Second})
+	assert.Equal(t, store.ErrKeyExists, err)
+	after, err := kv.client.Leases(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(before.Leases), len(after.Leases))
+
+	// Leases count whole seconds
+	_, err = kv.CreateMany(ctx, map[string]string{
+		"testCreateMany/svc/metadata": "m",
+	}, &store.WriteOptions{TTL: 500 * time.Millisecond})
+	assert.Equal(t, store.ErrInvalidTTL, err)
+}
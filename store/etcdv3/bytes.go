@@ -0,0 +1,26 @@
+package etcdv3
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// PutBytes puts a binary value at "key", see Put. The etcd
+// client takes values as strings, value is copied once.
+func (s *Etcd) PutBytes(ctx context.Context, key string, value []byte, opts *store.WriteOptions) (*store.KVPair, error) {
+	return s.Put(ctx, key, string(value), opts)
+}
+
+// GetBytes gets the value of "key" as returned by etcd, without
+// the conversion to a string of Get. The caller owns the slice.
+func (s *Etcd) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Kvs[0].Value, nil
+}
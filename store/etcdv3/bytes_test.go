@@ -0,0 +1,35 @@
+package etcdv3
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytes(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.Delete(ctx, "testBytes")
+
+	value := []byte{0x00, 0xff, 0x1f, 0x8b, 0x00}
+	pair, err := kv.PutBytes(ctx, "testBytes", value, nil)
+	assert.NoError(t, err)
+
+	got, err := kv.GetBytes(ctx, "testBytes")
+	assert.NoError(t, err)
+	assert.Equal(t, value, got)
+
+	// Both APIs see the same value
+	read, err := kv.Get(ctx, "testBytes")
+	assert.NoError(t, err)
+	assert.Equal(t, string(value), read.Value)
+	assert.Equal(t, pair.Index, read.Index)
+
+	_, err = kv.GetBytes(ctx, "testBytes/missing")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
@@ -0,0 +1,73 @@
+package etcdv3
+
+import (
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// ListChangedSince returns the net changes under directory since
+// revision sinceRev: a PUT for every key created or modified after
+// it, with its value at sinceRev as PreNode if it had one, and a
+// DELETE for every key that existed at sinceRev and is gone. Keys
+// left unchanged are omitted. Responses are sorted by key.
+//
+// It fails with ErrCompacted when sinceRev has been compacted, the
+// caller has to fall back to a full List.
+func (s *Etcd) ListChangedSince(ctx context.Context, directory string, sinceRev uint64) ([]*store.WatchResponse, error) {
+	directory = store.Normalize(directory)
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	current, err := s.client.Get(ctx, directory, etcd.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	if uint64(current.Header.Revision) <= sinceRev {
+		return nil, nil
+	}
+
+	past, err := s.client.Get(ctx, directory, etcd.WithPrefix(), etcd.WithRev(int64(sinceRev)))
+	if err == rpctypes.ErrCompacted {
+		return nil, store.ErrCompacted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]*store.KVPair, len(past.Kvs))
+	for _, kv := range past.Kvs {
+		previous[string(kv.Key)] = newKVPair(kv)
+	}
+
+	var changes []*store.WatchResponse
+	for _, kv := range current.Kvs {
+		key := string(kv.Key)
+		pre := previous[key]
+		delete(previous, key)
+
+		if uint64(kv.ModRevision) <= sinceRev {
+			continue
+		}
+		changes = append(changes, &store.WatchResponse{
+			Action:  store.ActionPut,
+			PreNode: pre,
+			Node:    newKVPair(kv),
+		})
+	}
+	for key, pre := range previous {
+		changes = append(changes, &store.WatchResponse{
+			Action:  store.ActionDelete,
+			PreNode: pre,
+			Node:    &store.KVPair{Key: key},
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Node.Key < changes[j].Node.Key })
+	return changes, nil
+}
@@ -0,0 +1,80 @@
+package etcdv3
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListChangedSince(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testListChangedSince")
+
+	_, err := kv.Put(ctx, "testListChangedSince/a", "a1", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListChangedSince/b", "b", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListChangedSince/unchanged", "u", nil)
+	assert.NoError(t, err)
+	since, err := kv.Get(ctx, "testListChangedSince/unchanged")
+	assert.NoError(t, err)
+
+	_, err = kv.Put(ctx, "testListChangedSince/a", "a2", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListChangedSince/a", "a3", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListChangedSince/c", "c", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Delete(ctx, "testListChangedSince/b"))
+
+	changes, err := kv.ListChangedSince(ctx, "testListChangedSince", since.Index)
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, store.ActionPut, changes[0].Action)
+		assert.Equal(t, "/testListChangedSince/a", changes[0].Node.Key)
+		assert.Equal(t, "a3", changes[0].Node.Value)
+		assert.Equal(t, "a1", changes[0].PreNode.Value)
+
+		assert.Equal(t, store.ActionDelete, changes[1].Action)
+		assert.Equal(t, "/testListChangedSince/b", changes[1].Node.Key)
+		assert.Equal(t, "b", changes[1].PreNode.Value)
+
+		assert.Equal(t, store.ActionPut, changes[2].Action)
+		assert.Equal(t, "/testListChangedSince/c", changes[2].Node.Key)
+		assert.Nil(t, changes[2].PreNode)
+	}
+
+	// Nothing changed since the last write
+	last, err := kv.Get(ctx, "testListChangedSince/c")
+	assert.NoError(t, err)
+	changes, err = kv.ListChangedSince(ctx, "testListChangedSince", last.Index+1)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestListChangedSinceCompacted(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testListChangedSinceCompacted")
+
+	_, err := kv.Put(ctx, "testListChangedSinceCompacted/a", "a", nil)
+	assert.NoError(t, err)
+	since, err := kv.Get(ctx, "testListChangedSinceCompacted/a")
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListChangedSinceCompacted/a", "b", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, "testListChangedSinceCompacted/a")
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Compact(ctx, pair.Index, false))
+
+	_, err = kv.ListChangedSince(ctx, "testListChangedSinceCompacted", since.Index)
+	assert.Equal(t, store.ErrCompacted, err)
+}
@@ -0,0 +1,114 @@
+package etcdv3
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// WindowedCounter is a cluster-wide counter that restarts from
+// zero every window, e.g. to count events per minute
+type WindowedCounter struct {
+	s      *Etcd
+	key    string
+	window time.Duration
+	now    func() time.Time
+}
+
+// WindowedCounter returns the counter stored under key, reset
+// every window. Each window is counted in its own key under
+// key, attached to a lease of two windows so that past windows
+// expire by themselves. A window that is not positive fails
+// with ErrInvalidInterval.
+func (s *Etcd) WindowedCounter(key string, window time.Duration) (*WindowedCounter, error) {
+	if window <= 0 {
+		return nil, store.ErrInvalidInterval
+	}
+	return &WindowedCounter{
+		s:      s,
+		key:    store.Normalize(key),
+		window: window,
+		now:    time.Now,
+	}, nil
+}
+
+// windowKey returns the key counting the current window
+func (c *WindowedCounter) windowKey() string {
+	return fmt.Sprintf("%s/%d", c.key, c.now().UnixNano()/int64(c.window))
+}
+
+// Incr atomically adds delta to the counter of the current
+// window and returns the new count
+func (c *WindowedCounter) Incr(ctx context.Context, delta int64) (int64, error) {
+	key := c.windowKey()
+	client := c.s.client
+
+	ctx, cancel := c.s.writeTimeout(ctx, nil)
+	defer cancel()
+
+	for {
+		resp, err := client.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(resp.Kvs) == 0 {
+			ttl := int64((2*c.window + time.Second - 1) / time.Second)
+			lease, err := client.Grant(ctx, ttl)
+			if err != nil {
+				return 0, err
+			}
+			value := strconv.FormatInt(delta, 10)
+			txnResp, err := client.Txn(ctx).
+				If(etcd.Compare(etcd.CreateRevision(key), "=", 0)).
+				Then(etcd.OpPut(key, value, etcd.WithLease(lease.ID))).
+				Commit()
+			if err == nil && txnResp.Succeeded {
+				return delta, nil
+			}
+			client.Revoke(ctx, lease.ID)
+			if err != nil {
+				return 0, err
+			}
+			// Created meanwhile, add to it
+			continue
+		}
+
+		kv := resp.Kvs[0]
+		count, err := strconv.ParseInt(string(kv.Value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		count += delta
+		txnResp, err := client.Txn(ctx).
+			If(etcd.Compare(etcd.ModRevision(key), "=", kv.ModRevision)).
+			Then(etcd.OpPut(key, strconv.FormatInt(count, 10), etcd.WithIgnoreLease())).
+			Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txnResp.Succeeded {
+			return count, nil
+		}
+	}
+}
+
+// Value returns the count of the current window
+func (c *WindowedCounter) Value(ctx context.Context) (int64, error) {
+	ctx, cancel := c.s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.s.client.Get(ctx, c.windowKey())
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+}
@@ -0,0 +1,83 @@
+package etcdv3
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowedCounter(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testWindowedCounter")
+
+	now := time.Unix(1000*60, 0)
+	_, err := kv.WindowedCounter("testWindowedCounter", 0)
+	assert.Equal(t, store.ErrInvalidInterval, err)
+
+	c, err := kv.WindowedCounter("testWindowedCounter", time.Minute)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Incr(ctx, 2)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	count, err := c.Value(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), count)
+
+	// Still the same window
+	now = now.Add(59 * time.Second)
+	count, err = c.Incr(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(21), count)
+
+	// The next window starts from zero
+	now = now.Add(time.Second)
+	count, err = c.Value(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	count, err = c.Incr(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestIncrement(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.Delete(ctx, "testIncrement")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_, err := store.Increment(ctx, kv, "testIncrement", 3)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := store.Decrement(ctx, kv, "testIncrement", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(149), count)
+}
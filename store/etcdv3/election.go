@@ -0,0 +1,99 @@
+package etcdv3
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// Election elects a single leader among the candidates
+// campaigning under the same prefix
+type Election struct {
+	s        *Etcd
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// NewElection joins the election under prefix. The candidacy
+// is bound to a session of the given ttl, defaultSessionTTL
+// seconds when zero: a leader that stops responding loses the
+// leadership once it expires. Close must be called to leave
+// the election.
+func (s *Etcd) NewElection(prefix string, ttl time.Duration) (*Election, error) {
+	sessionTTL := defaultSessionTTL
+	if ttl > 0 {
+		sessionTTL = int(ttl.Seconds())
+	}
+
+	session, err := concurrency.NewSession(s.client, concurrency.WithTTL(sessionTTL))
+	if err != nil {
+		return nil, err
+	}
+	s.trackSession(session)
+
+	return &Election{
+		s:        s,
+		session:  session,
+		election: concurrency.NewElection(session, store.Normalize(prefix)),
+	}, nil
+}
+
+// Campaign blocks until the candidate is elected with value,
+// or ctx is done
+func (e *Election) Campaign(ctx context.Context, value string) error {
+	return e.election.Campaign(ctx, value)
+}
+
+// Resign gives the leadership up, another candidate can then
+// be elected
+func (e *Election) Resign(ctx context.Context) error {
+	ctx, cancel := e.s.withTimeout(ctx)
+	defer cancel()
+
+	return e.election.Resign(ctx)
+}
+
+// Leader returns the pair of the current leader, its value is
+// the one the leader campaigned with. It fails with
+// ErrKeyNotFound if there is no leader.
+func (e *Election) Leader(ctx context.Context) (*store.KVPair, error) {
+	ctx, cancel := e.s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := e.election.Leader(ctx)
+	if err == concurrency.ErrElectionNoLeader {
+		return nil, store.ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKVPair(resp.Kvs[0]), nil
+}
+
+// Observe sends the pair of the current leader, then the one
+// of every new leader. The channel is closed once ctx is done.
+func (e *Election) Observe(ctx context.Context) <-chan *store.KVPair {
+	leaders := e.election.Observe(ctx)
+
+	resp := make(chan *store.KVPair)
+	go func() {
+		defer close(resp)
+		for leader := range leaders {
+			select {
+			case resp <- newKVPair(leader.Kvs[0]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resp
+}
+
+// Close leaves the election, resigning if the candidate is
+// the leader
+func (e *Election) Close() error {
+	return e.session.Close()
+}
@@ -0,0 +1,121 @@
+package etcdv3
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElection(t *testing.T) {
+	ctx := context.Background()
+	observer := makeEtcdClient(t).(*Etcd)
+	defer observer.Close()
+
+	watch, err := observer.NewElection("testElection", 0)
+	assert.NoError(t, err)
+	defer watch.Close()
+	_, err = watch.Leader(ctx)
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	observeCtx, stopObserving := context.WithCancel(ctx)
+	leaders := watch.Observe(observeCtx)
+
+	// Every candidate is a store of its own, as in a fleet. A
+	// leader resigns once it has been observed.
+	const candidates = 5
+	observed := make(map[string]chan struct{})
+	for i := 0; i < candidates; i++ {
+		observed[fmt.Sprintf("worker-%d", i)] = make(chan struct{})
+	}
+	var active, elected int32
+	var wg sync.WaitGroup
+	for i := 0; i < candidates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			kv := makeEtcdClient(t).(*Etcd)
+			defer kv.Close()
+
+			e, err := kv.NewElection("testElection", 5*time.Second)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer e.Close()
+
+			value := fmt.Sprintf("worker-%d", i)
+			if !assert.NoError(t, e.Campaign(ctx, value)) {
+				return
+			}
+			assert.Equal(t, int32(1), atomic.AddInt32(&active, 1))
+			atomic.AddInt32(&elected, 1)
+
+			leader, err := e.Leader(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, value, leader.Value)
+
+			select {
+			case <-observed[value]:
+			case <-time.After(10 * time.Second):
+				t.Errorf("%s not observed", value)
+			}
+			atomic.AddInt32(&active, -1)
+			assert.NoError(t, e.Resign(ctx))
+		}(i)
+	}
+
+	// Every leader is observed
+	seen := make(map[string]bool)
+	for len(seen) < candidates {
+		select {
+		case leader := <-leaders:
+			if !seen[leader.Value] {
+				seen[leader.Value] = true
+				close(observed[leader.Value])
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("missed leaders, saw %v", seen)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(candidates), elected)
+
+	stopObserving()
+	for range leaders {
+	}
+}
+
+func TestElectionClose(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	first, err := kv.NewElection("testElectionClose", 0)
+	assert.NoError(t, err)
+	second, err := kv.NewElection("testElectionClose", 0)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	assert.NoError(t, first.Campaign(ctx, "first"))
+
+	// Closing the leader hands the leadership over
+	elected := make(chan error)
+	go func() { elected <- second.Campaign(ctx, "second") }()
+	assert.NoError(t, first.Close())
+	select {
+	case err := <-elected:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership not handed over")
+	}
+
+	leader, err := second.Leader(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", leader.Value)
+}
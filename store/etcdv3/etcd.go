@@ -1,15 +1,39 @@
 package etcdv3
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"golang.org/x/net/context"
 
 	"github.com/YuleiXiao/kvstore"
 	"github.com/YuleiXiao/kvstore/store"
 	etcd "github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/clientv3/namespace"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	mvccpb "github.com/coreos/etcd/mvcc/mvccpb"
 )
 
+// maxTxnOps is the default limit of operations
+// etcd accepts in a single transaction
+const maxTxnOps = 128
+
+// defaultOperationTimeout bounds the calls made
+// with a context that has no deadline
+const defaultOperationTimeout = 5 * time.Second
+
+// defaultSessionTTL is the TTL in seconds of the
+// sessions backing locks, as used by etcd
+const defaultSessionTTL = 60
+
+// listPageSize is the number of keys List reads per
+// request, large directories are read in several pages
+const listPageSize = 1000
+
 // Register registers etcd to kvstore
 func Register() {
 	kvstore.AddStore(store.ETCDV3, New)
@@ -19,10 +43,60 @@ func Register() {
 // Store interface
 type Etcd struct {
 	client *etcd.Client
+
+	mu          sync.Mutex
+	watches     map[uint64]*watchState
+	lastWatchID uint64
+
+	// Bounded staleness of serializable reads, see staleness.go
+	maxStale   int64
+	clusterRev int64
+	staleReads uint64
+
+	logger         store.Logger
+	observer       store.Observer
+	warnValueBytes int
+
+	opTimeout time.Duration
+	config    store.ConfigSnapshot
+
+	// consistency of the reads by normalized key prefix
+	consistency map[string]store.Consistency
+
+	// ctx is cancelled by Close to end the background work of
+	// the store, the goroutines in background are waited for
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+
+	// sessions backing the locks, revoked by Close
+	sessions map[*concurrency.Session]struct{}
+
+	// closeOnce runs Close once, closeErr keeps its result
+	closeOnce sync.Once
+	closeErr  error
+
+	// namespace prefixing every key, empty when none
+	namespace string
 }
 
 type etcdLock struct {
-	mu *concurrency.Mutex
+	mu      *concurrency.Mutex
+	key     string
+	session *concurrency.Session
+	ttl     int
+	err     error
+
+	// extension is the lease holding the lock key
+	// after a call to Extend, if any
+	extension etcd.LeaseID
+
+	// heartbeat rewrites the lock key while it is held,
+	// stopped by closing stop
+	heartbeat time.Duration
+	owner     string
+	stop      chan struct{}
+	stopped   chan struct{}
 }
 
 // New creates a new Etcd client given a list
@@ -34,9 +108,11 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 
 	// Set options
 	if options != nil {
-		if options.TLS != nil {
-			cfg.TLS = options.TLS
+		tlsConfig, err := store.TLSConfig(options)
+		if err != nil {
+			return nil, err
 		}
+		cfg.TLS = tlsConfig
 		if options.ConnectionTimeout != 0 {
 			cfg.DialTimeout = options.ConnectionTimeout
 		}
@@ -44,6 +120,8 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 			cfg.Username = options.Username
 			cfg.Password = options.Password
 		}
+		cfg.AutoSyncInterval = options.AutoSyncInterval
+		cfg.RejectOldCluster = options.RejectOldCluster
 	}
 
 	c, err := etcd.New(*cfg)
@@ -51,8 +129,61 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 		return nil, err
 	}
 
+	// Every call goes through the namespaced KV, watcher and
+	// lease, locks and transactions included
+	var prefix string
+	if options != nil && store.Normalize(options.Namespace) != "/" {
+		prefix = store.Normalize(options.Namespace)
+		c.KV = namespace.NewKV(c.KV, prefix)
+		c.Watcher = namespace.NewWatcher(c.Watcher, prefix)
+		c.Lease = namespace.NewLease(c.Lease, prefix)
+	}
+
 	s := &Etcd{
-		client: c,
+		client:    c,
+		namespace: prefix,
+		watches:   make(map[uint64]*watchState),
+		sessions:  make(map[*concurrency.Session]struct{}),
+		logger:    nopLogger{},
+		opTimeout: defaultOperationTimeout,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if options != nil {
+		if options.Logger != nil {
+			s.logger = options.Logger
+		}
+		s.observer = options.Observer
+		s.warnValueBytes = options.WarnValueBytes
+		if options.OperationTimeout != 0 {
+			s.opTimeout = options.OperationTimeout
+		}
+		if len(options.Consistency) > 0 {
+			s.consistency = make(map[string]store.Consistency, len(options.Consistency))
+			for prefix, c := range options.Consistency {
+				s.consistency[store.Normalize(prefix)] = c
+			}
+		}
+	}
+
+	s.config = store.NewConfigSnapshot(addrs, options)
+	s.config.OperationTimeout = s.opTimeout
+	if s.config.StalenessRefresh == 0 && s.config.MaxStaleRevisions > 0 {
+		s.config.StalenessRefresh = defaultStalenessRefresh
+	}
+
+	if options != nil && options.WaitForReady > 0 {
+		if err := s.waitForReady(options.WaitForReady); err != nil {
+			s.cancel()
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if options != nil && options.MaxStaleRevisions > 0 {
+		s.maxStale = int64(options.MaxStaleRevisions)
+		s.background.Add(1)
+		go s.refreshRevision(options.StalenessRefresh)
 	}
 
 	return s, nil
@@ -61,6 +192,9 @@ func New(addrs []string, options *store.Config) (store.Store, error) {
 // Get the value at "key", returns the last modified
 // index to use in conjunction to Atomic calls
 func (s *Etcd) Get(ctx context.Context, key string) (pair *store.KVPair, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	pairs, err := s.get(ctx, key, false)
 	if err != nil {
 		return nil, err
@@ -69,58 +203,213 @@ func (s *Etcd) Get(ctx context.Context, key string) (pair *store.KVPair, err err
 	return pairs[0], nil
 }
 
-func (s *Etcd) get(ctx context.Context, key string, prefix bool) (pairs []*store.KVPair, err error) {
-	var resp *etcd.GetResponse
+func (s *Etcd) get(ctx context.Context, key string, prefix bool, extra ...etcd.OpOption) (pairs []*store.KVPair, err error) {
 	var opts []etcd.OpOption
 	if prefix {
-		opts = []etcd.OpOption{etcd.WithPrefix()}
+		opts = append(opts, etcd.WithPrefix())
 	}
+	opts = append(opts, extra...)
 
-	resp, err = s.client.Get(ctx, store.Normalize(key), opts...)
+	resp, err := s.read(ctx, key, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.Count == 0 {
-		return nil, store.ErrKeyNotFound
-	}
-
 	pairs = []*store.KVPair{}
 	for _, kv := range resp.Kvs {
-		pairs = append(pairs, &store.KVPair{
-			Key:     string(kv.Key),
-			Value:   string(kv.Value),
-			Index:   uint64(kv.ModRevision),
-			Version: uint64(kv.Version),
-			Lease:   uint64(kv.Lease),
-		})
+		pairs = append(pairs, newKVPair(kv))
 	}
 
 	return pairs, nil
 }
 
-// Put a value at "key"
-func (s *Etcd) Put(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+// read gets "key" with the consistency configured for it. It
+// fails with ErrKeyNotFound if nothing is found.
+func (s *Etcd) read(ctx context.Context, key string, opts ...etcd.OpOption) (*etcd.GetResponse, error) {
+	ctx = s.keyConsistency(ctx, key)
+	resp, err := s.client.Get(ctx, store.Normalize(key), append(s.readOptions(ctx), opts...)...)
+	if err == nil && s.tooStale(ctx, resp.Header.Revision) {
+		// The member serving the read lags too far behind,
+		// go through the quorum instead
+		resp, err = s.client.Get(ctx, store.Normalize(key), opts...)
+	}
+	if err == rpctypes.ErrCompacted {
+		return nil, store.ErrCompacted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return resp, nil
+}
+
+// withTimeout bounds calls made with a context without
+// deadline by the operation timeout
+func (s *Etcd) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || s.opTimeout < 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.opTimeout)
+}
+
+// writeTimeout bounds a write by the Timeout of opts if set,
+// by the operation timeout otherwise
+func (s *Etcd) writeTimeout(ctx context.Context, opts *store.WriteOptions) (context.Context, context.CancelFunc) {
+	if opts != nil && opts.Timeout > 0 {
+		return context.WithTimeout(ctx, opts.Timeout)
+	}
+	return s.withTimeout(ctx)
+}
+
+// contextError returns the error of ctx once it is done, the
+// error of a call is then only a consequence of it
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// waitForReady polls the status of the endpoints until one of
+// them reports a leader or the timeout elapses
+func (s *Etcd) waitForReady(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		if s.Status(ctx) == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return store.ErrNotReady
+		}
+	}
+}
+
+// Status checks the health of the cluster: it returns nil as
+// soon as an endpoint reports a leader, otherwise an error
+// giving the state of every endpoint
+func (s *Etcd) Status(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var failures []string
+	for _, endpoint := range s.client.Endpoints() {
+		resp, err := s.client.Status(ctx, endpoint)
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", endpoint, err))
+		case resp.Leader == 0:
+			failures = append(failures, fmt.Sprintf("%s: member %x has no leader", endpoint, resp.Header.MemberId))
+		default:
+			return nil
+		}
+	}
+	return fmt.Errorf("etcd cluster unhealthy, %s", strings.Join(failures, "; "))
+}
+
+// readOptions returns the options applied to every read,
+// according to the consistency carried by ctx
+func (s *Etcd) readOptions(ctx context.Context) []etcd.OpOption {
+	var opts []etcd.OpOption
+	if c, ok := store.ConsistencyFromContext(ctx); ok && c == store.Serializable {
+		opts = append(opts, etcd.WithSerializable())
+	}
+	return opts
+}
+
+// keyConsistency returns ctx carrying the consistency configured
+// for the longest prefix of key, unless ctx already carries one
+func (s *Etcd) keyConsistency(ctx context.Context, key string) context.Context {
+	if len(s.consistency) == 0 {
+		return ctx
+	}
+	if _, ok := store.ConsistencyFromContext(ctx); ok {
+		return ctx
+	}
+
 	key = store.Normalize(key)
-	if opts != nil {
+	best, found := "", false
+	for prefix := range s.consistency {
+		if strings.HasPrefix(key, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return ctx
+	}
+	return store.WithConsistency(ctx, s.consistency[best])
+}
+
+// newKVPair converts an etcd key value into a KVPair
+func newKVPair(kv *mvccpb.KeyValue) *store.KVPair {
+	return &store.KVPair{
+		Key:         string(kv.Key),
+		Value:       string(kv.Value),
+		Index:       uint64(kv.ModRevision),
+		Version:     uint64(kv.Version),
+		Lease:       uint64(kv.Lease),
+		CreateIndex: uint64(kv.CreateRevision),
+	}
+}
+
+// Put a value at "key", returns the pair written with
+// its new index
+func (s *Etcd) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
+	key = store.Normalize(key)
+	s.observeValue(key, value)
+
+	// The previous pair gives the version of the new one
+	putOpts := []etcd.OpOption{etcd.WithPrevKV()}
+	var lease etcd.LeaseID
+	if opts != nil && opts.TTL > 0 {
 		resp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
 		if err != nil {
-			return err
+			return nil, contextError(ctx, err)
 		}
-		_, err = s.client.Put(ctx, key, value, etcd.WithLease(resp.ID))
-		return err
+		lease = resp.ID
+		putOpts = append(putOpts, etcd.WithLease(lease))
 	}
 
-	_, err := s.client.Put(ctx, key, value)
-	return err
+	resp, err := s.client.Put(ctx, key, value, putOpts...)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	pair := &store.KVPair{
+		Key:         key,
+		Value:       value,
+		Index:       uint64(resp.Header.Revision),
+		Version:     1,
+		Lease:       uint64(lease),
+		CreateIndex: uint64(resp.Header.Revision),
+	}
+	if resp.PrevKv != nil {
+		pair.Version = uint64(resp.PrevKv.Version) + 1
+		pair.CreateIndex = uint64(resp.PrevKv.CreateRevision)
+	}
+	return pair, nil
 }
 
 // Update is an alias for Put with key exist
 func (s *Etcd) Update(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
 	key = store.Normalize(key)
+	s.observeValue(key, value)
 
 	req := etcd.OpPut(key, value)
-	if opts != nil {
+	if opts != nil && opts.TTL > 0 {
 		leaseResp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
 		if err != nil {
 			return err
@@ -144,10 +433,14 @@ func (s *Etcd) Update(ctx context.Context, key, value string, opts *store.WriteO
 
 // Create is an alias for Put with key not exist
 func (s *Etcd) Create(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
 	key = store.Normalize(key)
+	s.observeValue(key, value)
 
 	req := etcd.OpPut(key, value)
-	if opts != nil {
+	if opts != nil && opts.TTL > 0 {
 		leaseResp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
 		if err != nil {
 			return err
@@ -169,14 +462,107 @@ func (s *Etcd) Create(ctx context.Context, key, value string, opts *store.WriteO
 	return nil
 }
 
+// PutIfExists puts a value at "key" only if dependsOnKey exists,
+// both checked and written in a single transaction. It returns
+// ErrDependencyMissing, writing nothing, otherwise.
+func (s *Etcd) PutIfExists(ctx context.Context, key, value, dependsOnKey string, opts *store.WriteOptions) error {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
+	key = store.Normalize(key)
+	s.observeValue(key, value)
+
+	req := etcd.OpPut(key, value)
+	if opts != nil && opts.TTL > 0 {
+		leaseResp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
+		if err != nil {
+			return err
+		}
+
+		req = etcd.OpPut(key, value, etcd.WithLease(leaseResp.ID))
+	}
+
+	dependency := store.Normalize(dependsOnKey)
+	txn := s.client.Txn(ctx)
+	resp, err := txn.If(etcd.Compare(etcd.CreateRevision(dependency), "!=", 0)).Then(req).Commit()
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return store.ErrDependencyMissing
+	}
+
+	return nil
+}
+
+// GetOrCreate creates "key" with defaultValue if it does not
+// exist yet, and returns the current pair in the same round
+// trip. created reports whether this call created the key.
+func (s *Etcd) GetOrCreate(ctx context.Context, key, defaultValue string, opts *store.WriteOptions) (pair *store.KVPair, created bool, err error) {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
+	key = store.Normalize(key)
+
+	req := etcd.OpPut(key, defaultValue)
+	if opts != nil && opts.TTL > 0 {
+		leaseResp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
+		if err != nil {
+			return nil, false, err
+		}
+
+		req = etcd.OpPut(key, defaultValue, etcd.WithLease(leaseResp.ID))
+	}
+
+	txn := s.client.Txn(ctx)
+	resp, err := txn.If(etcd.Compare(etcd.CreateRevision(key), "=", 0)).
+		Then(req, etcd.OpGet(key)).
+		Else(etcd.OpGet(key)).
+		Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	rangeResp := resp.Responses[len(resp.Responses)-1].GetResponseRange()
+	if len(rangeResp.Kvs) == 0 {
+		// The key expired or was deleted right after the txn
+		return nil, false, store.ErrKeyNotFound
+	}
+
+	return newKVPair(rangeResp.Kvs[0]), resp.Succeeded, nil
+}
+
 // Delete a value at "key"
 func (s *Etcd) Delete(ctx context.Context, key string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	_, err := s.client.Delete(ctx, store.Normalize(key))
 	return err
 }
 
+// DeleteWithPrev deletes the value at "key" and returns the pair
+// it held, nil without error if the key did not exist
+func (s *Etcd) DeleteWithPrev(ctx context.Context, key string) (*store.KVPair, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.client.Delete(ctx, store.Normalize(key), etcd.WithPrevKV())
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.PrevKvs) == 0 {
+		return nil, nil
+	}
+	return newKVPair(resp.PrevKvs[0]), nil
+}
+
 // Exists checks if the key exists inside the store
 func (s *Etcd) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	_, err := s.Get(ctx, key)
 	if err != nil {
 		if err == store.ErrKeyNotFound {
@@ -190,8 +576,8 @@ func (s *Etcd) Exists(ctx context.Context, key string) (bool, error) {
 // Watch for changes on a "key"
 // It returns a channel that will receive changes or pass
 // on errors. Upon creation, the current value will first
-// be sent to the channel. Providing a non-nil stopCh can
-// be used to stop watching.
+// be sent to the channel. Cancelling ctx tears down the
+// underlying etcd watch, the channel is then closed.
 func (s *Etcd) Watch(ctx context.Context, key string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
 	return s.watch(ctx, key, false, opt)
 }
@@ -199,53 +585,220 @@ func (s *Etcd) Watch(ctx context.Context, key string, opt *store.WatchOptions) (
 // WatchTree watches for changes on a "directory"
 // It returns a channel that will receive changes or pass
 // on errors. Upon creating a watch, the current childs values
-// will be sent to the channel. Providing a non-nil stopCh can
-// be used to stop watching.
+// will be sent to the channel. Cancelling ctx tears down the
+// underlying etcd watch, the channel is then closed.
 func (s *Etcd) WatchTree(ctx context.Context, directory string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
 	return s.watch(ctx, directory, true, opt)
 }
 
 func (s *Etcd) watch(ctx context.Context, key string, prefix bool, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
-	var watchChan etcd.WatchChan
+	key = store.Normalize(key)
 	opts := []etcd.OpOption{etcd.WithPrevKV()}
 	if prefix {
 		opts = append(opts, etcd.WithPrefix())
 	}
+
+	var rev int64
 	if opt != nil {
-		opts = append(opts, etcd.WithRev(int64(opt.Index)))
+		rev = int64(opt.Index)
+
+		// Filtered on the server, the events are not even sent
+		if opt.FilterPut {
+			opts = append(opts, etcd.WithFilterPut())
+		}
+		if opt.FilterDelete {
+			opts = append(opts, etcd.WithFilterDelete())
+		}
+	}
+
+	// Seed the tracked keys before the watch starts so that a
+	// delete racing with the watch setup is still reconciled
+	var known *tracker
+	if prefix && opt != nil && opt.ReconcileInterval > 0 {
+		known = newTracker()
+		if err := known.seed(ctx, s.client, key); err != nil {
+			return nil, err
+		}
 	}
 
+	// Read the current values first, the watch resumes
+	// right after the revision they were read at
+	var initial *Iterator
+	if (opt == nil || !opt.SkipInitialValues) && rev == 0 {
+		var err error
+		if initial, err = s.initialValues(ctx, key, prefix, opt); err != nil {
+			return nil, err
+		}
+		rev = initial.rev + 1
+	}
+
+	// The watch is also cancelled when the store is closed
+	ctx, cancel := context.WithCancel(ctx)
 	watcher := etcd.NewWatcher(s.client)
-	watchChan = watcher.Watch(ctx, store.Normalize(key), opts...)
+	if s.namespace != "" {
+		watcher = namespace.NewWatcher(watcher, s.namespace)
+	}
+	watchChan := watcher.Watch(ctx, key, append(opts, etcd.WithRev(rev))...)
 
 	// resp is sending back events to the caller
 	resp := make(chan *store.WatchResponse)
+	state := s.addWatch(key, prefix, cancel)
 	go func() {
 		defer func() {
 			close(resp)
 		}()
 		defer func() {
+			cancel()
 			watcher.Close()
+			s.removeWatch(state)
 		}()
 
+		var tick <-chan time.Time
+		if known != nil {
+			ticker := time.NewTicker(opt.ReconcileInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		var seq uint64
+		send := func(r *store.WatchResponse) {
+			// Initial values and reconciled deletes are
+			// filtered here
+			if r.Error == nil && opt.Filters(r.Action) {
+				return
+			}
+			seq++
+			r.Seq = seq
+			if r.ReceivedAt.IsZero() {
+				r.ReceivedAt = time.Now()
+			}
+			resp <- r
+			s.delivered(state, r)
+			if known != nil {
+				known.observe(r)
+			}
+		}
+
+		if initial != nil {
+			for initial.Next() {
+				send(&store.WatchResponse{Action: store.ActionPut, Node: initial.Pair()})
+			}
+			if err := initial.Err(); err != nil {
+				send(&store.WatchResponse{Error: err})
+				return
+			}
+		}
+
+		var retry *backoff
 		for {
+			var ch etcd.WatchResponse
+			var ok bool
 			select {
-			case ch, ok := <-watchChan:
-				for _, e := range ch.Events {
-					resp <- s.makeWatchResponse(e, nil)
+			case ch, ok = <-watchChan:
+			case <-tick:
+				deletes, err := known.reconcile(ctx, s.client, key)
+				if err != nil {
+					// Try again on the next tick, the watch
+					// reports its own failures
+					continue
+				}
+				for _, r := range deletes {
+					send(r)
 				}
+				continue
+			}
+
+			received := time.Now()
+			for _, e := range ch.Events {
+				r := s.makeWatchResponse(e, nil)
+				r.ReceivedAt = received
+				send(r)
+				rev = e.Kv.ModRevision + 1
+			}
 
-				if !ok {
-					resp <- s.makeWatchResponse(nil, store.ErrWatchFail)
-					return
+			err := ch.Err()
+			if ok && err == nil {
+				if len(ch.Events) > 0 {
+					retry = nil
 				}
+				if ch.Header.Revision >= rev {
+					rev = ch.Header.Revision + 1
+				}
+				continue
+			}
+
+			// Ended by the caller or by Close
+			if ctx.Err() != nil {
+				send(s.makeWatchResponse(nil, store.ErrWatchFail))
+				return
+			}
+
+			// The failure is surfaced as is, compaction apart
+			// from the other ones
+			if err == nil {
+				err = store.ErrWatchFail
+			}
+			if err == rpctypes.ErrCompacted {
+				err = store.ErrCompacted
+			}
+
+			// Watching a compacted revision again fails the same
+			// way, a reconnection would spin forever
+			if opt == nil || !opt.Reconnect || err == store.ErrCompacted {
+				send(s.makeWatchResponse(nil, err))
+				return
+			}
+
+			// Wait before re-establishing the watch so that
+			// a failing cluster is not hammered
+			if retry == nil {
+				retry = newBackoff(opt.MaxBackoff)
+			}
+			s.logger.Warnf("kvstore: watch on %s failed, reconnecting: %v", key, err)
+			send(&store.WatchResponse{Action: store.ActionReconnect, Error: err})
+
+			select {
+			case <-time.After(retry.next()):
+			case <-ctx.Done():
+				send(s.makeWatchResponse(nil, store.ErrWatchFail))
+				return
 			}
+
+			watchChan = watcher.Watch(ctx, key, append(opts, etcd.WithRev(rev))...)
 		}
 	}()
 
 	return resp, nil
 }
 
+// initialValues returns an iterator over the initial values of
+// a watch, with its first page read so that its revision is
+// pinned. It fails with ErrInitialSnapshotTooLarge if there are
+// more than MaxInitialKeys values and paging is not allowed.
+func (s *Etcd) initialValues(ctx context.Context, key string, prefix bool, opt *store.WatchOptions) (*Iterator, error) {
+	if opt == nil {
+		opt = &store.WatchOptions{}
+	}
+	end := ""
+	if prefix {
+		end = etcd.GetPrefixRangeEnd(key)
+	}
+	it := &Iterator{s: s, ctx: ctx, next: key, end: end, pageSize: int64(opt.MaxInitialKeys)}
+
+	// One more key tells whether the bound is exceeded
+	bounded := opt.MaxInitialKeys > 0 && !opt.PagedInitialValues
+	if bounded {
+		it.pageSize++
+	}
+	if err := it.fetch(); err != nil {
+		return nil, err
+	}
+	if bounded && len(it.page) > opt.MaxInitialKeys {
+		return nil, store.ErrInitialSnapshotTooLarge
+	}
+	return it, nil
+}
+
 func (s *Etcd) makeWatchResponse(event *etcd.Event, err error) *store.WatchResponse {
 	if err != nil {
 		return &store.WatchResponse{Error: err}
@@ -257,61 +810,55 @@ func (s *Etcd) makeWatchResponse(event *etcd.Event, err error) *store.WatchRespo
 		action = store.ActionPut
 	case mvccpb.DELETE:
 		action = store.ActionDelete
+	default:
+		// Surfaced to the watcher rather than
+		// delivered as an event without action
+		return &store.WatchResponse{Error: store.ErrUnexpectedEvent}
 	}
 
+	// PrevKv is nil on the first write of a key
 	var preNode *store.KVPair
 	if event.PrevKv != nil {
-		preNode = &store.KVPair{
-			Key:     string(event.PrevKv.Key),
-			Value:   string(event.PrevKv.Value),
-			Index:   uint64(event.PrevKv.ModRevision),
-			Version: uint64(event.PrevKv.Version),
-			Lease:   uint64(event.PrevKv.Lease),
-		}
+		preNode = newKVPair(event.PrevKv)
 	}
 
 	return &store.WatchResponse{
 		Action:  action,
 		PreNode: preNode,
-		Node: &store.KVPair{
-			Key:     string(event.Kv.Key),
-			Value:   string(event.Kv.Value),
-			Index:   uint64(event.Kv.ModRevision),
-			Version: uint64(event.PrevKv.Version),
-			Lease:   uint64(event.PrevKv.Lease),
-		},
+		Node:    newKVPair(event.Kv),
 	}
 }
 
 // AtomicPut puts a value at "key" if the key has not been
 // modified in the meantime, throws an error if this is the case
 func (s *Etcd) AtomicPut(ctx context.Context, key, value string, previous *store.KVPair, opts *store.WriteOptions) error {
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
 	key = store.Normalize(key)
+	s.observeValue(key, value)
 
 	req := etcd.OpPut(key, value)
-	if opts != nil {
+	if opts != nil && opts.TTL > 0 {
 		leaseResp, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
 		if err != nil {
-			return err
+			return contextError(ctx, err)
 		}
 
 		req = etcd.OpPut(key, value, etcd.WithLease(leaseResp.ID))
 	}
 
-	cmp := []etcd.Cmp{}
+	var cmp etcd.Cmp
 	if previous == nil {
-		cmp = append(cmp, etcd.Compare(etcd.CreateRevision(key), "=", 0))
+		cmp = etcd.Compare(etcd.CreateRevision(key), "=", 0)
 	} else {
-		cmp = append(cmp, etcd.Compare(etcd.Value(key), "=", previous.Value))
-		if previous.Index != 0 {
-			cmp = append(cmp, etcd.Compare(etcd.ModRevision(key), "=", int64(previous.Index)))
-		}
+		cmp = previousCmp(key, previous)
 	}
 
 	txn := s.client.Txn(ctx)
-	resp, err := txn.If(cmp...).Then(req).Commit()
+	resp, err := txn.If(cmp).Then(req).Commit()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
 	if resp.Succeeded {
@@ -324,23 +871,32 @@ func (s *Etcd) AtomicPut(ctx context.Context, key, value string, previous *store
 	return store.ErrKeyModified
 }
 
+// previousCmp checks that key is unchanged since previous was
+// read. The revision is compared rather than the value, which
+// may have been rewritten identically meanwhile; the value is
+// only compared for pairs carrying no revision.
+func previousCmp(key string, previous *store.KVPair) etcd.Cmp {
+	if previous.Index == 0 {
+		return etcd.Compare(etcd.Value(key), "=", previous.Value)
+	}
+	return etcd.Compare(etcd.ModRevision(key), "=", int64(previous.Index))
+}
+
 // AtomicDelete deletes a value at "key" if the key
 // has not been modified in the meantime, throws an
 // error if this is the case
 func (s *Etcd) AtomicDelete(ctx context.Context, key string, previous *store.KVPair) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	key = store.Normalize(key)
 
 	if previous == nil {
 		return store.ErrPreviousNotSpecified
 	}
 
-	cmp := []etcd.Cmp{etcd.Compare(etcd.Value(key), "=", previous.Value)}
-	if previous.Index != 0 {
-		cmp = append(cmp, etcd.Compare(etcd.ModRevision(key), "=", int64(previous.Index)))
-	}
-
 	txn := s.client.Txn(ctx)
-	resp, err := txn.If(cmp...).Then(
+	resp, err := txn.If(previousCmp(key, previous)).Then(
 		etcd.OpDelete(key),
 	).Commit()
 
@@ -357,36 +913,553 @@ func (s *Etcd) AtomicDelete(ctx context.Context, key string, previous *store.KVP
 
 // List child nodes of a given directory
 func (s *Etcd) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
-	pairs, err := s.get(ctx, store.Normalize(directory), true)
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// Read page by page so that a large directory does not
+	// exceed the response size, at the revision of the first
+	// page for a consistent result
+	directory = store.Normalize(directory)
+	var pairs []*store.KVPair
+	var rev int64
+	after := ""
+	for {
+		page, next, pageRev, err := s.listPage(ctx, directory, listPageSize, after, rev)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, page...)
+		if next == "" {
+			break
+		}
+		rev, after = pageRev, next
+	}
+
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+// ListPage lists at most limit pairs under directory in key
+// order, starting after the key startAfter or at the first key
+// when empty. It also returns the key to pass as startAfter to
+// read the next page, empty once the directory is exhausted. The
+// limit is unbounded when not positive. An empty page fails with
+// ErrKeyNotFound.
+//
+// Every page is read at the latest revision, pages may thus
+// reflect changes made between them. See StableIterator for a
+// point-in-time iteration.
+func (s *Etcd) ListPage(ctx context.Context, directory string, limit int64, startAfter string) ([]*store.KVPair, string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pairs, next, _, err := s.listPage(ctx, store.Normalize(directory), limit, startAfter, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pairs) == 0 {
+		return nil, "", store.ErrKeyNotFound
+	}
+	return pairs, next, nil
+}
+
+// listPage reads a page of ListPage at rev, the latest revision
+// when zero, and returns the revision it was read at
+func (s *Etcd) listPage(ctx context.Context, directory string, limit int64, startAfter string, rev int64) ([]*store.KVPair, string, int64, error) {
+	from := directory
+	if startAfter >= directory {
+		from = startAfter + "\x00"
+	}
+	opts := []etcd.OpOption{etcd.WithRange(etcd.GetPrefixRangeEnd(directory))}
+	if limit > 0 {
+		opts = append(opts, etcd.WithLimit(limit))
+	}
+	if rev > 0 {
+		opts = append(opts, etcd.WithRev(rev))
+	}
+
+	ctx = s.keyConsistency(ctx, directory)
+	resp, err := s.client.Get(ctx, from, append(s.readOptions(ctx), opts...)...)
+	if err == nil && s.tooStale(ctx, resp.Header.Revision) {
+		resp, err = s.client.Get(ctx, from, opts...)
+	}
+	if err == rpctypes.ErrCompacted {
+		return nil, "", 0, store.ErrCompacted
+	}
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	var pairs []*store.KVPair
+	for _, kv := range resp.Kvs {
+		pairs = append(pairs, newKVPair(kv))
+	}
+
+	next := ""
+	if resp.More && len(resp.Kvs) > 0 {
+		next = string(resp.Kvs[len(resp.Kvs)-1].Key)
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	return pairs, next, rev, nil
+}
+
+// ListWithOptions lists the child nodes of a given directory like
+// List, tuned by opts which may be nil
+func (s *Etcd) ListWithOptions(ctx context.Context, directory string, opts *store.ListOptions) ([]*store.KVPair, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	ctx, extra := listOptions(ctx, opts)
+	return s.get(ctx, store.Normalize(directory), true, extra...)
+}
+
+// listOptions returns the context and the etcd
+// options applying opts to a read
+func listOptions(ctx context.Context, opts *store.ListOptions) (context.Context, []etcd.OpOption) {
+	if opts == nil {
+		return ctx, nil
+	}
+
+	var extra []etcd.OpOption
+	if opts.Serializable {
+		ctx = store.WithConsistency(ctx, store.Serializable)
+	}
+	if opts.Limit > 0 {
+		extra = append(extra, etcd.WithLimit(int64(opts.Limit)))
+	}
+	if opts.Descending {
+		extra = append(extra, etcd.WithSort(etcd.SortByKey, etcd.SortDescend))
+	}
+	if opts.Revision > 0 {
+		extra = append(extra, etcd.WithRev(int64(opts.Revision)))
+	}
+	if opts.KeysOnly {
+		extra = append(extra, etcd.WithKeysOnly())
+	}
+	return ctx, extra
+}
+
+// ListKeys lists the keys under directory without transferring
+// their values
+func (s *Etcd) ListKeys(ctx context.Context, directory string) ([]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pairs, err := s.get(ctx, store.Normalize(directory), true, etcd.WithKeysOnly())
 	if err != nil {
 		return nil, err
 	}
 
-	return pairs, nil
+	keys := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	return keys, nil
 }
 
 // DeleteTree deletes a range of keys under a given directory
 func (s *Etcd) DeleteTree(ctx context.Context, directory string) error {
-	_, err := s.client.Delete(ctx, store.Normalize(directory), etcd.WithPrefix())
+	_, err := s.DeleteTreeCount(ctx, directory)
 	return err
 }
 
+// DeleteTreeCount deletes the keys under directory and returns
+// how many were deleted. An empty directory would delete the
+// whole keyspace, it is refused with ErrEmptyDirectory.
+func (s *Etcd) DeleteTreeCount(ctx context.Context, directory string) (int64, error) {
+	directory = store.Normalize(directory)
+	if directory == "/" {
+		return 0, store.ErrEmptyDirectory
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.client.Delete(ctx, directory, etcd.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
+
+// DeleteTreePaged deletes the keys under directory in ranges of
+// at most batchSize keys, waiting pause between two ranges so that
+// deleting a huge directory does not overwhelm the cluster. It
+// returns the number of keys deleted, including on failure.
+func (s *Etcd) DeleteTreePaged(ctx context.Context, directory string, batchSize int, pause time.Duration) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultPageSize
+	}
+	directory = store.Normalize(directory)
+	if directory == "/" {
+		return 0, store.ErrEmptyDirectory
+	}
+	end := etcd.GetPrefixRangeEnd(directory)
+
+	deleted := 0
+	for {
+		resp, err := s.client.Get(ctx, directory, etcd.WithRange(end), etcd.WithKeysOnly(), etcd.WithLimit(int64(batchSize)))
+		if err != nil {
+			return deleted, err
+		}
+		if len(resp.Kvs) == 0 {
+			return deleted, nil
+		}
+
+		first, last := string(resp.Kvs[0].Key), string(resp.Kvs[len(resp.Kvs)-1].Key)
+		delResp, err := s.client.Delete(ctx, first, etcd.WithRange(last+"\x00"))
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(delResp.Deleted)
+
+		if !resp.More {
+			return deleted, nil
+		}
+		if pause > 0 {
+			select {
+			case <-time.After(pause):
+			case <-ctx.Done():
+				return deleted, ctx.Err()
+			}
+		}
+	}
+}
+
+// DeleteTreeIfMarker deletes the keys under directory only if
+// markerKey holds the expected value, in a single transaction.
+// It returns the number of keys deleted, or ErrKeyModified if
+// the marker changed or is missing. A marker located under the
+// directory is deleted along with it.
+func (s *Etcd) DeleteTreeIfMarker(ctx context.Context, directory, markerKey, expected string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.client.Txn(ctx).
+		If(etcd.Compare(etcd.Value(store.Normalize(markerKey)), "=", expected)).
+		Then(etcd.OpDelete(store.Normalize(directory), etcd.WithPrefix())).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, store.ErrKeyModified
+	}
+	return int(resp.Responses[0].GetResponseDeleteRange().Deleted), nil
+}
+
+// ReplaceTree atomically replaces the content of a directory
+// with newPairs, whose keys are relative to the directory. The
+// replacement only happens if no key under the directory was
+// modified after expectedRev, otherwise ErrKeyModified is
+// returned. Deleted keys are not detected by the comparison.
+//
+// The whole replacement is a single transaction, the removed
+// and written keys together must not exceed maxTxnOps.
+func (s *Etcd) ReplaceTree(ctx context.Context, directory string, newPairs map[string]string, expectedRev uint64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	directory = store.Normalize(directory)
+
+	// etcd refuses a prefix delete overlapping a put in the
+	// same txn, so only the keys going away are deleted
+	resp, err := s.client.Get(ctx, directory, etcd.WithPrefix(), etcd.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+
+	var ops []etcd.Op
+	keys := make(map[string]bool, len(newPairs))
+	for k, v := range newPairs {
+		key := store.Normalize(directory + "/" + k)
+		keys[key] = true
+		ops = append(ops, etcd.OpPut(key, v))
+	}
+	for _, kv := range resp.Kvs {
+		if !keys[string(kv.Key)] {
+			ops = append(ops, etcd.OpDelete(string(kv.Key)))
+		}
+	}
+
+	if len(ops) > maxTxnOps {
+		return store.ErrTooManyOperations
+	}
+
+	cmp := etcd.Compare(etcd.ModRevision(directory), "<", int64(expectedRev)+1).WithPrefix()
+	txnResp, err := s.client.Txn(ctx).If(cmp).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+
+	if !txnResp.Succeeded {
+		return store.ErrKeyModified
+	}
+
+	return nil
+}
+
 // NewLock creates a lock for a given key.
 // The returned Locker is not held and must be acquired
 // with `.Lock`. The Value is optional.
 func (s *Etcd) NewLock(key string, opt *store.LockOptions) store.Locker {
-	var session *concurrency.Session
+	ttl := defaultSessionTTL
+	if opt != nil && opt.TTL > 0 {
+		ttl = int(opt.TTL.Seconds())
+	}
+
+	session, err := concurrency.NewSession(s.client, concurrency.WithTTL(ttl))
+	if err != nil {
+		return &etcdLock{err: err}
+	}
+	s.trackSession(session)
+	l := &etcdLock{
+		mu:      concurrency.NewMutex(session, key),
+		key:     key,
+		session: session,
+		ttl:     ttl,
+	}
 	if opt != nil {
-		session, _ = concurrency.NewSession(s.client, concurrency.WithTTL(int(opt.TTL.Seconds())))
-	} else {
-		session, _ = concurrency.NewSession(s.client)
+		l.heartbeat = opt.Heartbeat
+		l.owner = opt.Value
+		if opt.RenewLock != nil {
+			go func() {
+				// Stop renewing the session lease, the lock
+				// then expires with it after ttl
+				select {
+				case <-opt.RenewLock:
+					session.Orphan()
+				case <-session.Done():
+				}
+			}()
+		}
+	}
+	return l
+}
+
+// Lock attempts to acquire the lock and blocks while
+// doing so. It returns the error encountered while
+// creating the lock session, if any.
+func (l *etcdLock) Lock(ctx context.Context) error {
+	if l.err != nil {
+		return l.err
+	}
+	if err := l.mu.Lock(ctx); err != nil {
+		return err
 	}
-	return concurrency.NewMutex(session, key)
+	return l.acquired(ctx)
+}
+
+// TryLock acquires the lock only if nobody holds it nor waits
+// for it, without blocking. It returns false if the lock is
+// taken.
+func (l *etcdLock) TryLock(ctx context.Context) (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+
+	// Same waiter key as the mutex, created only if the
+	// lock prefix is empty
+	prefix := l.key + "/"
+	key := fmt.Sprintf("%s%x", prefix, l.session.Lease())
+	resp, err := l.session.Client().Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(prefix), "=", 0).WithPrefix()).
+		Then(etcd.OpPut(key, "", etcd.WithLease(l.session.Lease()))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	if !resp.Succeeded {
+		return false, nil
+	}
+
+	// The key is the oldest under the prefix, the mutex
+	// takes it over without waiting
+	if err := l.mu.Lock(ctx); err != nil {
+		l.session.Client().Delete(context.Background(), key)
+		return false, err
+	}
+	if err := l.acquired(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// acquired sets up a lock that was just taken: its value is
+// written and its heartbeat started
+func (l *etcdLock) acquired(ctx context.Context) error {
+	if l.owner != "" && l.heartbeat == 0 {
+		if err := l.write(ctx, l.owner); err != nil {
+			l.mu.Unlock(context.Background())
+			return err
+		}
+	}
+	if l.heartbeat > 0 {
+		if err := l.beat(ctx); err != nil {
+			l.mu.Unlock(context.Background())
+			return err
+		}
+		l.stop = make(chan struct{})
+		l.stopped = make(chan struct{})
+		go l.heartbeats()
+	}
+	return nil
+}
+
+// beat writes a fresh LockHeartbeat under the lock key,
+// keeping the lease the key is attached to
+func (l *etcdLock) beat(ctx context.Context) error {
+	value, err := json.Marshal(store.LockHeartbeat{Owner: l.owner, Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	return l.write(ctx, string(value))
+}
+
+// write sets the value of the held lock key, so that other
+// clients can read who holds it
+func (l *etcdLock) write(ctx context.Context, value string) error {
+	key := l.mu.Key()
+	resp, err := l.session.Client().Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(key), ">", 0)).
+		Then(etcd.OpPut(key, value, etcd.WithIgnoreLease())).
+		Commit()
+	if err == nil && !resp.Succeeded {
+		err = store.ErrLockNotHeld
+	}
+	return err
+}
+
+// heartbeats beats until the lock is released or its
+// session expires
+func (l *etcdLock) heartbeats() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
+		case <-l.session.Done():
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.heartbeat)
+		err := l.beat(ctx)
+		cancel()
+		if err == store.ErrLockNotHeld {
+			return
+		}
+	}
+}
+
+// Unlock releases the lock. Failing to release it is
+// reported, since other waiters would stay blocked until
+// the session expires.
+func (l *etcdLock) Unlock(ctx context.Context) error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.stop != nil {
+		close(l.stop)
+		<-l.stopped
+		l.stop = nil
+	}
+	if err := l.mu.Unlock(ctx); err != nil {
+		return err
+	}
+	if l.extension != 0 {
+		l.session.Client().Revoke(ctx, l.extension)
+		l.extension = 0
+	}
+	return nil
+}
+
+// Session returns the session the lock key is attached to,
+// nil if it could not be created
+func (l *etcdLock) Session() *concurrency.Session {
+	return l.session
+}
+
+// Close revokes the lock session, releasing the lock at once
+// if it is held. The lock cannot be used afterwards.
+func (l *etcdLock) Close() error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.stop != nil {
+		close(l.stop)
+		<-l.stopped
+		l.stop = nil
+	}
+	if l.extension != 0 {
+		l.session.Client().Revoke(context.Background(), l.extension)
+		l.extension = 0
+	}
+	return l.session.Close()
+}
+
+// Extend keeps the lock for at least ttl from now, even if the
+// session stops being renewed. The session lease is refreshed
+// and, when ttl is longer than the session TTL, the lock key is
+// moved to a dedicated lease of ttl.
+func (l *etcdLock) Extend(ctx context.Context, ttl time.Duration) error {
+	if l.err != nil {
+		return l.err
+	}
+	key := l.mu.Key()
+	if key == "" {
+		return store.ErrLockNotHeld
+	}
+
+	client := l.session.Client()
+	if _, err := client.KeepAliveOnce(ctx, l.session.Lease()); err != nil {
+		return err
+	}
+
+	secs := int64(ttl.Seconds())
+	if secs <= int64(l.ttl) {
+		return nil
+	}
+
+	lease, err := client.Grant(ctx, secs)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(key), ">", 0)).
+		Then(etcd.OpPut(key, "", etcd.WithLease(lease.ID), etcd.WithIgnoreValue())).
+		Commit()
+	if err == nil && !resp.Succeeded {
+		err = store.ErrLockNotHeld
+	}
+	if err != nil {
+		client.Revoke(ctx, lease.ID)
+		return err
+	}
+
+	if l.extension != 0 {
+		client.Revoke(ctx, l.extension)
+	}
+	l.extension = lease.ID
+	return nil
 }
 
 // Compact compacts etcd KV history before the given rev.
-func (s *Etcd) Compact(ctx context.Context, rev uint64, wait bool) error {
-	if wait {
+// When physical is set the call blocks until the space
+// of the compacted revisions is reclaimed.
+func (s *Etcd) Compact(ctx context.Context, rev uint64, physical bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if physical {
 		_, err := s.client.Compact(ctx, int64(rev), etcd.WithCompactPhysical())
 		return err
 	}
@@ -394,6 +1467,37 @@ func (s *Etcd) Compact(ctx context.Context, rev uint64, wait bool) error {
 	return err
 }
 
+// CompactRevision returns the revision the history was last
+// compacted at, 0 if it never was. etcd does not report it
+// directly: a watch of the whole keyspace from revision 1 either
+// replays the first write or is cancelled with the compaction
+// revision, in its first response.
+func (s *Etcd) CompactRevision(ctx context.Context) (uint64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, "/", etcd.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	// Nothing was ever written, there is no history
+	if resp.Header.Revision <= 1 {
+		return 0, nil
+	}
+
+	wresp, ok := <-s.client.Watch(ctx, "\x00", etcd.WithFromKey(), etcd.WithRev(1))
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return 0, store.ErrWatchFail
+	}
+	if wresp.CompactRevision > 0 {
+		return uint64(wresp.CompactRevision), nil
+	}
+	return 0, wresp.Err()
+}
+
 // NewTxn creates a transaction Txn.
 func (s *Etcd) NewTxn(ctx context.Context) (store.Txn, error) {
 	return &txn{
@@ -402,8 +1506,69 @@ func (s *Etcd) NewTxn(ctx context.Context) (store.Txn, error) {
 	}, nil
 }
 
-// Close closes the client connection
-func (s *Etcd) Close() {
-	s.client.Close()
-	return
+// Config returns a copy of the effective settings of the
+// store, defaults included and the password redacted
+func (s *Etcd) Config() store.ConfigSnapshot {
+	config := s.config
+	config.Endpoints = append([]string(nil), s.config.Endpoints...)
+	return config
+}
+
+// Raw returns the underlying etcd v3 client. It is an escape
+// hatch for etcd specific features not covered by the Store
+// interface, code using it is tied to this backend. With a
+// Namespace configured, the KV, Watcher and Lease of the client
+// are confined to it.
+func (s *Etcd) Raw() *etcd.Client {
+	return s.client
+}
+
+// trackSession records session until it is closed or
+// orphaned, so that Close can revoke it
+func (s *Etcd) trackSession(session *concurrency.Session) {
+	s.mu.Lock()
+	s.sessions[session] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-session.Done()
+		s.mu.Lock()
+		delete(s.sessions, session)
+		s.mu.Unlock()
+	}()
+}
+
+// Close cancels the watches, stops the registrations and
+// revokes the lock sessions, releasing the locks held, then
+// closes the client connection. Closing again is a no-op that
+// returns the first result.
+func (s *Etcd) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+	return s.closeErr
+}
+
+func (s *Etcd) close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	for _, w := range s.watches {
+		w.cancel()
+	}
+	sessions := make([]*concurrency.Session, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	// The leases are revoked while the client is still open
+	for _, session := range sessions {
+		if err := session.Close(); err != nil {
+			s.logger.Warnf("kvstore: revoking lock session %x: %v", session.Lease(), err)
+		}
+	}
+	s.background.Wait()
+
+	return s.client.Close()
 }
@@ -1,12 +1,23 @@
 package etcdv3
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"golang.org/x/net/context"
+
 	"github.com/YuleiXiao/kvstore"
 	"github.com/YuleiXiao/kvstore/store"
 	"github.com/YuleiXiao/kvstore/testutils"
+	etcd "github.com/coreos/etcd/clientv3"
+	mvccpb "github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,3 +67,1679 @@ func TestEtcdStore(t *testing.T) {
 	testutils.RunTestLockTTLV3(t, kv, lockKV)
 	testutils.RunTestTTL(t, kv, ttlKV)
 }
+
+func TestGetOrCreate(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	key := "testGetOrCreate"
+	ctx := context.Background()
+	kv.Delete(ctx, key)
+	defer kv.Delete(ctx, key)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created []string
+		values  []string
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := fmt.Sprintf("value%d", i)
+			pair, ok, err := kv.GetOrCreate(ctx, key, value, nil)
+			assert.NoError(t, err)
+			if !assert.NotNil(t, pair) {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				assert.Equal(t, value, pair.Value)
+				created = append(created, value)
+			}
+			values = append(values, pair.Value)
+		}(i)
+	}
+	wg.Wait()
+
+	// Exactly one caller creates, everybody sees its value
+	if assert.Len(t, created, 1) {
+		for _, v := range values {
+			assert.Equal(t, created[0], v)
+		}
+	}
+
+	pair, ok, err := kv.GetOrCreate(ctx, key, "other", nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, created[0], pair.Value)
+}
+
+func TestPrefixConsistency(t *testing.T) {
+	kv, err := New([]string{client}, &store.Config{
+		ConnectionTimeout: 3 * time.Second,
+		Username:          "test",
+		Password:          "very-secure",
+		Consistency: map[string]store.Consistency{
+			"cache":        store.Serializable,
+			"cache/strong": store.Linearizable,
+		},
+	})
+	assert.NoError(t, err)
+	s := kv.(*Etcd)
+	defer s.Close()
+
+	ctx := context.Background()
+	serializable := func(ctx context.Context, key string) bool {
+		return etcd.OpGet(key, s.readOptions(s.keyConsistency(ctx, key))...).IsSerializable()
+	}
+
+	assert.True(t, serializable(ctx, "cache/meta"))
+	assert.True(t, serializable(ctx, "/cache"))
+	assert.False(t, serializable(ctx, "cache/strong/counter"))
+	assert.False(t, serializable(ctx, "counters/hits"))
+
+	// The context takes precedence over the prefixes
+	assert.False(t, serializable(store.WithConsistency(ctx, store.Linearizable), "cache/meta"))
+	assert.True(t, serializable(store.WithConsistency(ctx, store.Serializable), "counters/hits"))
+
+	key := "cache/testPrefixConsistency"
+	_, err = s.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+	defer s.Delete(ctx, key)
+
+	pair, err := s.Get(ctx, key)
+	assert.NoError(t, err)
+	if assert.NotNil(t, pair) {
+		assert.Equal(t, "value", pair.Value)
+	}
+}
+
+func TestPutIfExists(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testPutIfExists")
+
+	// Dependency absent, nothing is written
+	err := kv.PutIfExists(ctx, "testPutIfExists/service", "up", "testPutIfExists/db", nil)
+	assert.Equal(t, store.ErrDependencyMissing, err)
+	_, err = kv.Get(ctx, "testPutIfExists/service")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	_, err = kv.Put(ctx, "testPutIfExists/db", "up", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.PutIfExists(ctx, "testPutIfExists/service", "up", "testPutIfExists/db", nil))
+	pair, err := kv.Get(ctx, "testPutIfExists/service")
+	assert.NoError(t, err)
+	assert.Equal(t, "up", pair.Value)
+}
+
+func TestPairRevisions(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	key := "testPairRevisions"
+	defer kv.Delete(ctx, key)
+
+	created, err := kv.Put(ctx, key, "same", nil)
+	assert.NoError(t, err)
+	first, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Index, first.Index)
+	assert.Equal(t, first.Index, first.CreateIndex)
+	assert.Equal(t, created.CreateIndex, first.CreateIndex)
+
+	// Writing the same value still moves the index
+	updated, err := kv.Put(ctx, key, "same", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first.CreateIndex, updated.CreateIndex)
+	second, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Index, second.Index)
+	assert.True(t, second.Index > first.Index)
+	assert.Equal(t, first.CreateIndex, second.CreateIndex)
+
+	// so that a writer holding the first read loses
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicPut(ctx, key, "other", first, nil))
+	assert.NoError(t, kv.AtomicPut(ctx, key, "other", second, nil))
+}
+
+func TestAtomicComparesRevision(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+	other := makeEtcdClient(t)
+	defer other.Close()
+
+	ctx := context.Background()
+	key := "testAtomicComparesRevision"
+	defer kv.Delete(ctx, key)
+
+	_, err := kv.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+
+	// Another client rewrites the very same value
+	_, err = other.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicPut(ctx, key, "new", pair, nil))
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicDelete(ctx, key, pair))
+
+	// Only the revision matters, not the value held by the caller
+	pair, err = kv.Get(ctx, key)
+	assert.NoError(t, err)
+	stale := *pair
+	stale.Value = "outdated"
+	assert.NoError(t, kv.AtomicPut(ctx, key, "new", &stale, nil))
+
+	pair, err = kv.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.AtomicDelete(ctx, key, pair))
+}
+
+func TestAtomicNormalizesKey(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.Delete(ctx, "testAtomicNormalizesKey")
+
+	_, err := kv.Put(ctx, "/testAtomicNormalizesKey", "v1", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, "/testAtomicNormalizesKey")
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.AtomicPut(ctx, "testAtomicNormalizesKey/", "v2", pair, nil))
+	pair, err = kv.Get(ctx, "testAtomicNormalizesKey")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", pair.Value)
+
+	assert.NoError(t, kv.AtomicDelete(ctx, "/testAtomicNormalizesKey", pair))
+	exists, err := kv.Exists(ctx, "testAtomicNormalizesKey")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestZeroTTLNoLease(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testZeroTTLNoLease")
+
+	opts := &store.WriteOptions{}
+	pair, err := kv.Put(ctx, "testZeroTTLNoLease/put", "v", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), pair.Lease)
+
+	assert.NoError(t, kv.AtomicPut(ctx, "testZeroTTLNoLease/atomic", "v", nil, opts))
+	assert.NoError(t, kv.Create(ctx, "testZeroTTLNoLease/create", "v", opts))
+	assert.NoError(t, kv.Update(ctx, "testZeroTTLNoLease/create", "v2", opts))
+
+	for _, key := range []string{"put", "atomic", "create"} {
+		pair, err := kv.Get(ctx, "testZeroTTLNoLease/"+key)
+		assert.NoError(t, err)
+		if assert.NotNil(t, pair) {
+			assert.Equal(t, uint64(0), pair.Lease, key)
+		}
+	}
+}
+
+func TestDeleteWithPrev(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	key := "testDeleteWithPrev"
+
+	put, err := kv.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+
+	prev, err := kv.DeleteWithPrev(ctx, key)
+	assert.NoError(t, err)
+	if assert.NotNil(t, prev) {
+		assert.Equal(t, "/"+key, prev.Key)
+		assert.Equal(t, "value", prev.Value)
+		assert.Equal(t, put.Index, prev.Index)
+	}
+	exists, err := kv.Exists(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	prev, err = kv.DeleteWithPrev(ctx, key)
+	assert.NoError(t, err)
+	assert.Nil(t, prev)
+}
+
+func TestListWithOptions(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	dir := "testListWithOptions"
+	defer kv.DeleteTree(ctx, dir)
+
+	var first *store.KVPair
+	for i := 0; i < 5; i++ {
+		pair, err := kv.Put(ctx, fmt.Sprintf("%s/%d", dir, i), fmt.Sprint(i), nil)
+		assert.NoError(t, err)
+		if first == nil {
+			first = pair
+		}
+	}
+
+	op := func(opts *store.ListOptions) etcd.Op {
+		ctx, extra := listOptions(ctx, opts)
+		return etcd.OpGet(dir, append(kv.readOptions(ctx), extra...)...)
+	}
+	assert.False(t, op(nil).IsSerializable())
+	assert.False(t, op(&store.ListOptions{}).IsSerializable())
+	assert.True(t, op(&store.ListOptions{Serializable: true}).IsSerializable())
+
+	keys := func(pairs []*store.KVPair) []string {
+		var keys []string
+		for _, pair := range pairs {
+			keys = append(keys, strings.TrimPrefix(pair.Key, "/"+dir+"/"))
+		}
+		return keys
+	}
+
+	// The zero options list like List
+	pairs, err := kv.List(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, keys(pairs))
+	pairs, err = kv.ListWithOptions(ctx, dir, &store.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, keys(pairs))
+
+	pairs, err = kv.ListWithOptions(ctx, dir, &store.ListOptions{Serializable: true, Limit: 2, Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "3"}, keys(pairs))
+
+	pairs, err = kv.ListWithOptions(ctx, dir, &store.ListOptions{Revision: first.Index})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0"}, keys(pairs))
+
+	// Values are not fetched
+	pairs, err = kv.ListWithOptions(ctx, dir, &store.ListOptions{KeysOnly: true, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "1"}, keys(pairs))
+	for _, pair := range pairs {
+		assert.Empty(t, pair.Value)
+		assert.NotZero(t, pair.Index)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	dir := "testListKeys"
+	defer kv.DeleteTree(ctx, dir)
+
+	_, err := kv.ListKeys(ctx, dir)
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	large := strings.Repeat("x", 1<<16)
+	for _, key := range []string{"a", "b/c"} {
+		_, err := kv.Put(ctx, dir+"/"+key, large, nil)
+		assert.NoError(t, err)
+	}
+
+	keys, err := kv.ListKeys(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/testListKeys/a", "/testListKeys/b/c"}, keys)
+}
+
+func TestListPage(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	dir := "testListPage"
+	defer kv.DeleteTree(ctx, dir)
+
+	for i := 0; i < 6; i++ {
+		_, err := kv.Put(ctx, fmt.Sprintf("%s/%d", dir, i), fmt.Sprint(i), nil)
+		assert.NoError(t, err)
+	}
+	_, err := kv.Put(ctx, "testListPagf/outside", "v", nil)
+	assert.NoError(t, err)
+	defer kv.Delete(ctx, "testListPagf/outside")
+
+	pages := func(limit int64) [][]string {
+		var pages [][]string
+		after := ""
+		for {
+			pairs, next, err := kv.ListPage(ctx, dir, limit, after)
+			if !assert.NoError(t, err) {
+				return pages
+			}
+			var page []string
+			for _, pair := range pairs {
+				page = append(page, pair.Value)
+			}
+			pages = append(pages, page)
+			if next == "" {
+				return pages
+			}
+			after = next
+		}
+	}
+
+	// An exact multiple ends without an empty page
+	assert.Equal(t, [][]string{{"0", "1", "2"}, {"3", "4", "5"}}, pages(3))
+	// A partial final page
+	assert.Equal(t, [][]string{{"0", "1", "2", "3"}, {"4", "5"}}, pages(4))
+	assert.Equal(t, [][]string{{"0", "1", "2", "3", "4", "5"}}, pages(0))
+
+	_, _, err = kv.ListPage(ctx, "testListPageMissing", 3, "")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestListManyPages(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	dir := "testListManyPages"
+	defer kv.DeleteTree(ctx, dir)
+
+	for i := 0; i < listPageSize+1; i++ {
+		_, err := kv.Put(ctx, fmt.Sprintf("%s/%04d", dir, i), "v", nil)
+		assert.NoError(t, err)
+	}
+
+	pairs, err := kv.List(ctx, dir)
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, listPageSize+1) {
+		assert.Equal(t, fmt.Sprintf("/%s/%04d", dir, listPageSize), pairs[listPageSize].Key)
+	}
+}
+
+func TestReadConsistency(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	op := etcd.OpGet("key", kv.readOptions(ctx)...)
+	assert.False(t, op.IsSerializable())
+
+	ctx = store.WithConsistency(ctx, store.Serializable)
+	op = etcd.OpGet("key", kv.readOptions(ctx)...)
+	assert.True(t, op.IsSerializable())
+
+	key := "testReadConsistency"
+	_, err := kv.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+	defer kv.Delete(ctx, key)
+
+	pair, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+	if assert.NotNil(t, pair) {
+		assert.Equal(t, "value", pair.Value)
+	}
+}
+
+func TestWatchReconnect(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	key := "testWatchReconnect"
+	ctx := context.Background()
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := kv.Watch(wctx, key, &store.WatchOptions{
+		Reconnect:  true,
+		MaxBackoff: time.Second,
+	})
+	assert.NoError(t, err)
+
+	// Without its client the watch keeps failing, compaction
+	// apart which ends it
+	kv.client.Close()
+
+	var arrivals []time.Time
+	for len(arrivals) < 4 {
+		select {
+		case e := <-events:
+			assert.Equal(t, store.ActionReconnect, e.Action)
+			assert.Error(t, e.Error)
+			arrivals = append(arrivals, time.Now())
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout reached")
+		}
+	}
+
+	for i := 2; i < len(arrivals); i++ {
+		prev := arrivals[i-1].Sub(arrivals[i-2])
+		cur := arrivals[i].Sub(arrivals[i-1])
+		assert.True(t, cur > prev, "retry interval should grow: %v <= %v", cur, prev)
+	}
+
+	cancel()
+	for e := range events {
+		if e.Action != store.ActionReconnect {
+			assert.Equal(t, store.ErrWatchFail, e.Error)
+		}
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	kv := makeEtcdClient(t)
+
+	// With a lock session to revoke
+	lock := kv.NewLock("testCloseTwice", nil)
+	assert.NoError(t, lock.Lock(context.Background()))
+
+	assert.NoError(t, kv.Close())
+	assert.NoError(t, kv.Close())
+}
+
+func TestUnlockFailure(t *testing.T) {
+	kv := makeEtcdClient(t)
+
+	lock := kv.NewLock("testUnlockFailure", nil)
+	assert.NoError(t, lock.Lock(context.Background()))
+
+	// The lock key cannot be released once the client is gone
+	kv.Close()
+	assert.Error(t, lock.Unlock(context.Background()))
+
+	// Creating a lock on a closed client reports the failure
+	lock = kv.NewLock("testUnlockFailure", nil)
+	assert.Error(t, lock.Lock(context.Background()))
+	assert.Error(t, lock.Unlock(context.Background()))
+}
+
+func TestLockExtend(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testLockExtend", &store.LockOptions{TTL: 2 * time.Second})
+	assert.Equal(t, store.ErrLockNotHeld, lock.Extend(ctx, 6*time.Second))
+
+	assert.NoError(t, lock.Lock(ctx))
+	assert.NoError(t, lock.Extend(ctx, 6*time.Second))
+
+	// Stop renewing the session, only the extension
+	// keeps the lock past the original TTL
+	l := lock.(*etcdLock)
+	l.session.Orphan()
+	time.Sleep(4 * time.Second)
+
+	resp, err := kv.client.Get(ctx, l.mu.Key())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Count)
+
+	// Nobody else can take it meanwhile
+	tctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	other := kv.NewLock("testLockExtend", nil)
+	assert.Error(t, other.Lock(tctx))
+
+	assert.NoError(t, lock.Unlock(ctx))
+	assert.NoError(t, other.Lock(ctx))
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestLockHeartbeat(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testLockHeartbeat", &store.LockOptions{
+		Value:     "node-1",
+		Heartbeat: 200 * time.Millisecond,
+	})
+	assert.NoError(t, lock.Lock(ctx))
+	key := lock.(*etcdLock).mu.Key()
+
+	read := func() store.LockHeartbeat {
+		var hb store.LockHeartbeat
+		resp, err := kv.client.Get(ctx, key)
+		if assert.NoError(t, err) && assert.Equal(t, int64(1), resp.Count) {
+			assert.NoError(t, json.Unmarshal(resp.Kvs[0].Value, &hb))
+		}
+		return hb
+	}
+
+	first := read()
+	assert.Equal(t, "node-1", first.Owner)
+	assert.False(t, first.Time.IsZero())
+
+	time.Sleep(500 * time.Millisecond)
+	second := read()
+	assert.Equal(t, "node-1", second.Owner)
+	assert.True(t, second.Time.After(first.Time))
+
+	// The heartbeat survives an extension
+	assert.NoError(t, lock.Extend(ctx, 2*defaultSessionTTL*time.Second))
+	assert.Equal(t, "node-1", read().Owner)
+
+	assert.NoError(t, lock.Unlock(ctx))
+	resp, err := kv.client.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), resp.Count)
+}
+
+func TestLockExpiresAfterCrash(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	renew := make(chan struct{})
+	lock := kv.NewLock("testLockExpiresAfterCrash", &store.LockOptions{
+		Value:     "node-1",
+		TTL:       2 * time.Second,
+		RenewLock: renew,
+	})
+	assert.NoError(t, lock.Lock(ctx))
+
+	// The holder can be read from the lock key
+	resp, err := kv.client.Get(ctx, lock.(*etcdLock).mu.Key())
+	if assert.NoError(t, err) && assert.Equal(t, int64(1), resp.Count) {
+		assert.Equal(t, "node-1", string(resp.Kvs[0].Value))
+	}
+
+	// The holder crashes without unlocking
+	close(renew)
+
+	start := time.Now()
+	other := kv.NewLock("testLockExpiresAfterCrash", nil)
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	assert.NoError(t, other.Lock(tctx))
+	assert.True(t, time.Since(start) >= time.Second, "lock taken before the TTL elapsed")
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestLockContextSession(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	release, err := store.LockContext(context.Background(), kv, "testLockContextSession", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, release())
+
+	// The session of the lock is revoked with it
+	for i := 0; i < 50; i++ {
+		kv.mu.Lock()
+		n := len(kv.sessions)
+		kv.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("lock session leaked")
+}
+
+func TestLockClose(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testLockClose", nil)
+	assert.NoError(t, lock.Lock(ctx))
+	assert.NoError(t, lock.(*etcdLock).Close())
+
+	// The session is revoked, the lock is free right away
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	other := kv.NewLock("testLockClose", nil)
+	assert.NoError(t, other.Lock(tctx))
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestStoreClose(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	other := makeEtcdClient(t)
+	defer other.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testStoreClose", nil)
+	assert.NoError(t, lock.Lock(ctx))
+	events, err := kv.Watch(ctx, "testStoreClose/watched", &store.WatchOptions{Reconnect: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Close())
+
+	// The watch fails and is closed
+	var errs []error
+	for e := range events {
+		errs = append(errs, e.Error)
+	}
+	assert.Equal(t, []error{store.ErrWatchFail}, errs)
+	assert.Empty(t, kv.WatchStats())
+
+	// The lock session is revoked, the lock is free right away
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	free := other.NewLock("testStoreClose", nil)
+	assert.NoError(t, free.Lock(tctx))
+	assert.NoError(t, free.Unlock(ctx))
+}
+
+func TestTryLock(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testTryLock", &store.LockOptions{Value: "node-1"})
+	ok, err := lock.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	resp, err := kv.client.Get(ctx, lock.(*etcdLock).mu.Key())
+	if assert.NoError(t, err) && assert.Equal(t, int64(1), resp.Count) {
+		assert.Equal(t, "node-1", string(resp.Kvs[0].Value))
+	}
+
+	// Contended, the attempt fails right away
+	other := kv.NewLock("testTryLock", nil)
+	start := time.Now()
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// It leaves no waiter key behind
+	resp, err = kv.client.Get(ctx, "testTryLock/", etcd.WithPrefix(), etcd.WithCountOnly())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Count)
+
+	assert.NoError(t, lock.Unlock(ctx))
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestNamespacedLock(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, tenant := range []string{"testNamespacedLock/a", "testNamespacedLock/b"} {
+		lock := store.WithNamespace(kv, tenant).NewLock("resource", nil)
+		assert.NoError(t, lock.Lock(ctx))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(500 * time.Millisecond)
+			assert.NoError(t, lock.Unlock(context.Background()))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWatchResponsePreNode(t *testing.T) {
+	kv := &Etcd{}
+
+	// First write of a key
+	r := kv.makeWatchResponse(&etcd.Event{
+		Type: mvccpb.PUT,
+		Kv:   &mvccpb.KeyValue{Key: []byte("/key"), Value: []byte("v1"), ModRevision: 5, Version: 1, Lease: 7},
+	}, nil)
+	assert.Nil(t, r.PreNode)
+	assert.Equal(t, &store.KVPair{Key: "/key", Value: "v1", Index: 5, Version: 1, Lease: 7}, r.Node)
+
+	r = kv.makeWatchResponse(&etcd.Event{
+		Type:   mvccpb.PUT,
+		Kv:     &mvccpb.KeyValue{Key: []byte("/key"), Value: []byte("v2"), ModRevision: 6, Version: 2},
+		PrevKv: &mvccpb.KeyValue{Key: []byte("/key"), Value: []byte("v1"), ModRevision: 5, Version: 1, Lease: 7},
+	}, nil)
+	assert.Equal(t, &store.KVPair{Key: "/key", Value: "v1", Index: 5, Version: 1, Lease: 7}, r.PreNode)
+	assert.Equal(t, &store.KVPair{Key: "/key", Value: "v2", Index: 6, Version: 2}, r.Node)
+}
+
+func TestWatchResponseUnexpectedEvent(t *testing.T) {
+	kv := &Etcd{}
+	r := kv.makeWatchResponse(&etcd.Event{Type: 42, Kv: &mvccpb.KeyValue{Key: []byte("/key")}}, nil)
+	assert.Equal(t, store.ErrUnexpectedEvent, r.Error)
+	assert.Nil(t, r.Node)
+}
+
+func TestReplaceTree(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	dir := "testReplaceTree"
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, dir)
+
+	_, err := kv.Put(ctx, dir+"/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, dir+"/b", "b", nil)
+	assert.NoError(t, err)
+	b, err := kv.Get(ctx, dir+"/b")
+	assert.NoError(t, err)
+
+	err = kv.ReplaceTree(ctx, dir, map[string]string{"c": "c", "d": "d"}, b.Index)
+	assert.NoError(t, err)
+
+	pairs, err := kv.List(ctx, dir)
+	assert.NoError(t, err)
+	values := map[string]string{}
+	for _, pair := range pairs {
+		values[pair.Key] = pair.Value
+	}
+	assert.Equal(t, map[string]string{"/" + dir + "/c": "c", "/" + dir + "/d": "d"}, values)
+
+	// A concurrent modification aborts the replacement
+	_, err = kv.Put(ctx, dir+"/c", "modified", nil)
+	assert.NoError(t, err)
+	err = kv.ReplaceTree(ctx, dir, map[string]string{"e": "e"}, b.Index)
+	assert.Equal(t, store.ErrKeyModified, err)
+
+	pair, err := kv.Get(ctx, dir+"/c")
+	assert.NoError(t, err)
+	assert.Equal(t, "modified", pair.Value)
+
+	exists, err := kv.Exists(ctx, dir+"/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestCompact(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	key := "testCompact"
+	ctx := context.Background()
+	defer kv.Delete(ctx, key)
+
+	_, err := kv.Put(ctx, key, "v1", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, key, "v2", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Compact(ctx, pair.Index, true))
+
+	// Compacting again at the same revision is refused
+	assert.Error(t, kv.Compact(ctx, pair.Index, false))
+}
+
+func TestCompactRevision(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	key := "testCompactRevision"
+	ctx := context.Background()
+	defer kv.Delete(ctx, key)
+
+	for _, value := range []string{"v1", "v2", "v3"} {
+		_, err := kv.Put(ctx, key, value, nil)
+		assert.NoError(t, err)
+	}
+	pair, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Compact(ctx, pair.Index-1, false))
+	rev, err := kv.CompactRevision(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, pair.Index-1, rev)
+
+	// Later writes do not move the floor
+	_, err = kv.Put(ctx, key, "v4", nil)
+	assert.NoError(t, err)
+	rev, err = kv.CompactRevision(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, pair.Index-1, rev)
+}
+
+func TestRaw(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	key := "testRaw"
+	ctx := context.Background()
+	defer kv.Delete(ctx, key)
+
+	_, err := kv.Put(ctx, key, "value", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, key)
+	assert.NoError(t, err)
+
+	resp, err := kv.Raw().Get(ctx, store.Normalize(key))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Count)
+	assert.True(t, resp.Header.Revision >= int64(pair.Index))
+}
+
+func TestWatchTreeReconcile(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer kv.DeleteTree(context.Background(), "testWatchTreeReconcile")
+
+	_, err := kv.Put(ctx, "testWatchTreeReconcile/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testWatchTreeReconcile/b", "b", nil)
+	assert.NoError(t, err)
+
+	// Start the watch far in the future so the real delete
+	// event is never delivered, only the reconcile can see it
+	pair, err := kv.Get(ctx, "testWatchTreeReconcile/b")
+	assert.NoError(t, err)
+	events, err := kv.WatchTree(ctx, "testWatchTreeReconcile", &store.WatchOptions{
+		Index:             pair.Index + 1000,
+		ReconcileInterval: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Delete(ctx, "testWatchTreeReconcile/a"))
+
+	select {
+	case event := <-events:
+		assert.NoError(t, event.Error)
+		assert.Equal(t, store.ActionDelete, event.Action)
+		assert.Equal(t, "/testWatchTreeReconcile/a", event.Node.Key)
+		assert.Equal(t, "a", event.PreNode.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no synthetic delete received")
+	}
+
+	// The key is no longer tracked, it must not be reported twice
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestBoundedStaleness(t *testing.T) {
+	kv, err := New([]string{client}, &store.Config{
+		ConnectionTimeout: 3 * time.Second,
+		Username:          "test",
+		Password:          "very-secure",
+		MaxStaleRevisions: 10,
+		StalenessRefresh:  time.Hour,
+	})
+	assert.NoError(t, err)
+	s := kv.(*Etcd)
+	defer s.Close()
+
+	ctx := context.Background()
+	defer s.Delete(ctx, "testBoundedStaleness")
+	_, err = s.Put(ctx, "testBoundedStaleness", "value", nil)
+	assert.NoError(t, err)
+
+	serializable := store.WithConsistency(ctx, store.Serializable)
+
+	// Within the bound the serializable answer is used as is
+	pair, err := s.Get(serializable, "testBoundedStaleness")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&s.staleReads))
+
+	// Pretend the cluster moved far ahead of the member serving
+	// the read, the read must fall back to the quorum
+	s.observeRevision(int64(pair.Index) + 1000)
+	pair, err = s.Get(serializable, "testBoundedStaleness")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", pair.Value)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&s.staleReads))
+
+	// Linearizable reads are never checked
+	_, err = s.Get(ctx, "testBoundedStaleness")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&s.staleReads))
+}
+
+func TestWatchInitialValues(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := "testWatchInitialValues"
+	defer kv.DeleteTree(context.Background(), dir)
+
+	for _, key := range []string{"a", "b"} {
+		_, err := kv.Put(ctx, dir+"/"+key, key, nil)
+		assert.NoError(t, err)
+	}
+
+	events, err := kv.WatchTree(ctx, dir, nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, dir+"/c", "c", nil)
+	assert.NoError(t, err)
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-events:
+			assert.Equal(t, store.ActionPut, e.Action)
+			assert.Equal(t, uint64(i+1), e.Seq)
+			keys = append(keys, e.Node.Key)
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timeout reached")
+		}
+	}
+	assert.Equal(t, []string{"/" + dir + "/a", "/" + dir + "/b", "/" + dir + "/c"}, keys)
+
+	// A single key gets its current value first
+	events, err = kv.Watch(ctx, dir+"/a", nil)
+	assert.NoError(t, err)
+	select {
+	case e := <-events:
+		assert.Nil(t, e.PreNode)
+		assert.Equal(t, "a", e.Node.Value)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout reached")
+	}
+
+	// Unless only the changes are asked for
+	events, err = kv.Watch(ctx, dir+"/a", &store.WatchOptions{SkipInitialValues: true})
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, dir+"/a", "a2", nil)
+	assert.NoError(t, err)
+	select {
+	case e := <-events:
+		assert.Equal(t, "a", e.PreNode.Value)
+		assert.Equal(t, "a2", e.Node.Value)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout reached")
+	}
+}
+
+func TestWatchMaxInitialKeys(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := "testWatchMaxInitialKeys"
+	defer kv.DeleteTree(context.Background(), dir)
+
+	for i := 0; i < 25; i++ {
+		_, err := kv.Put(ctx, fmt.Sprintf("%s/%02d", dir, i), "v", nil)
+		assert.NoError(t, err)
+	}
+
+	// Too many keys fail the watch
+	_, err := kv.WatchTree(ctx, dir, &store.WatchOptions{MaxInitialKeys: 10})
+	assert.Equal(t, store.ErrInitialSnapshotTooLarge, err)
+
+	// The bound itself is accepted
+	events, err := kv.WatchTree(ctx, dir, &store.WatchOptions{MaxInitialKeys: 25})
+	assert.NoError(t, err)
+	e := <-events
+	assert.Equal(t, "/"+dir+"/00", e.Node.Key)
+
+	// or the values are sent page by page, none missed
+	events, err = kv.WatchTree(ctx, dir, &store.WatchOptions{
+		MaxInitialKeys:     10,
+		PagedInitialValues: true,
+	})
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, dir+"/25", "v", nil)
+	assert.NoError(t, err)
+
+	for i := 0; i < 26; i++ {
+		select {
+		case e := <-events:
+			assert.Equal(t, fmt.Sprintf("/%s/%02d", dir, i), e.Node.Key)
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timeout reached")
+		}
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	dir := "testWatchResume"
+	defer kv.DeleteTree(context.Background(), dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := kv.WatchTree(ctx, dir, nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(context.Background(), dir+"/a", "a1", nil)
+	assert.NoError(t, err)
+
+	// The consumer saves the revision of the last event
+	// it handled, then stops
+	e := <-events
+	assert.Equal(t, "a1", e.Node.Value)
+	saved := e.Node.Index
+	cancel()
+
+	// Changes made while nobody watches
+	bg := context.Background()
+	_, err = kv.Put(bg, dir+"/a", "a2", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(bg, dir+"/b", "b1", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Delete(bg, dir+"/a"))
+
+	ctx, cancel = context.WithCancel(bg)
+	defer cancel()
+	events, err = kv.WatchTree(ctx, dir, &store.WatchOptions{Index: saved + 1})
+	assert.NoError(t, err)
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case e := <-events:
+			assert.NoError(t, e.Error)
+			assert.True(t, e.Node.Index > saved)
+			got = append(got, e.Action+" "+e.Node.Key+" "+e.Node.Value)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missed events, got %v", got)
+		}
+	}
+	assert.Equal(t, []string{
+		"PUT /testWatchResume/a a2",
+		"PUT /testWatchResume/b b1",
+		"DELETE /testWatchResume/a ",
+	}, got)
+}
+
+func TestWatchFilter(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	dir := "testWatchFilter"
+	bg := context.Background()
+	defer kv.DeleteTree(bg, dir)
+	_, err := kv.Put(bg, dir+"/a", "a", nil)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(bg)
+	defer cancel()
+	deletes, err := kv.WatchTree(ctx, dir, &store.WatchOptions{FilterPut: true})
+	assert.NoError(t, err)
+	puts, err := kv.WatchTree(ctx, dir, &store.WatchOptions{FilterDelete: true})
+	assert.NoError(t, err)
+
+	_, err = kv.Put(bg, dir+"/b", "b", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Delete(bg, dir+"/a"))
+	_, err = kv.Put(bg, dir+"/c", "c", nil)
+	assert.NoError(t, err)
+
+	next := func(events <-chan *store.WatchResponse) string {
+		select {
+		case e := <-events:
+			assert.NoError(t, e.Error)
+			return e.Action + " " + e.Node.Key
+		case <-time.After(5 * time.Second):
+			t.Fatal("missed event")
+		}
+		return ""
+	}
+
+	// Neither the initial value nor the writes are delivered
+	assert.Equal(t, "DELETE /testWatchFilter/a", next(deletes))
+	assert.Equal(t, "PUT /testWatchFilter/a", next(puts))
+	assert.Equal(t, "PUT /testWatchFilter/b", next(puts))
+	assert.Equal(t, "PUT /testWatchFilter/c", next(puts))
+
+	assert.NoError(t, kv.Delete(bg, dir+"/b"))
+	assert.Equal(t, "DELETE /testWatchFilter/b", next(deletes))
+}
+
+func TestWatchCompacted(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := "testWatchCompacted"
+	defer kv.Delete(context.Background(), key)
+
+	first, err := kv.Put(ctx, key, "v1", nil)
+	assert.NoError(t, err)
+	last, err := kv.Put(ctx, key, "v2", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Compact(ctx, last.Index, false))
+
+	// etcd cancels the watch, which fails once with the
+	// compaction and is closed, even when reconnecting
+	for _, opt := range []*store.WatchOptions{
+		{Index: first.Index},
+		{Index: first.Index, Reconnect: true},
+	} {
+		events, err := kv.Watch(ctx, key, opt)
+		assert.NoError(t, err)
+
+		var errs []error
+		timeout := time.After(5 * time.Second)
+	loop:
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					break loop
+				}
+				errs = append(errs, e.Error)
+			case <-timeout:
+				t.Fatal("watch channel not closed")
+			}
+		}
+		assert.Equal(t, []error{store.ErrCompacted}, errs)
+	}
+}
+
+func TestWatchReceivedAt(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer kv.Delete(context.Background(), "testWatchReceivedAt")
+	_, err := kv.Put(ctx, "testWatchReceivedAt", "init", nil)
+	assert.NoError(t, err)
+
+	events, err := kv.Watch(ctx, "testWatchReceivedAt", &store.WatchOptions{SkipInitialValues: true})
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	before := time.Now()
+	_, err = kv.Put(ctx, "testWatchReceivedAt", "value", nil)
+	assert.NoError(t, err)
+
+	select {
+	case event := <-events:
+		assert.NoError(t, event.Error)
+		assert.False(t, event.ReceivedAt.Before(before))
+		assert.WithinDuration(t, time.Now(), event.ReceivedAt, time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	kv, err := New([]string{client}, &store.Config{
+		Username:     "test",
+		Password:     "very-secure",
+		WaitForReady: 3 * time.Second,
+	})
+	assert.NoError(t, err)
+	kv.Close()
+
+	// Nothing listens there, no leader can ever be found
+	start := time.Now()
+	_, err = New([]string{"localhost:1"}, &store.Config{
+		WaitForReady: 300 * time.Millisecond,
+	})
+	assert.Equal(t, store.ErrNotReady, err)
+	assert.WithinDuration(t, start.Add(300*time.Millisecond), time.Now(), time.Second)
+}
+
+func TestStatus(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+	assert.NoError(t, kv.Status(context.Background()))
+
+	down, err := New([]string{"localhost:1"}, &store.Config{OperationTimeout: 300 * time.Millisecond})
+	assert.NoError(t, err)
+	defer down.Close()
+	err = down.Status(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "localhost:1")
+	}
+}
+
+// TestWaitForReadyDelayed needs a cluster that elects its leader
+// some time after the test starts, e.g. started right before
+// running the test. Its endpoint is read from the environment.
+func TestWaitForReadyDelayed(t *testing.T) {
+	endpoint := os.Getenv("KVSTORE_DELAYED_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("KVSTORE_DELAYED_ENDPOINT not set")
+	}
+
+	kv, err := New([]string{endpoint}, &store.Config{
+		WaitForReady: 30 * time.Second,
+	})
+	assert.NoError(t, err)
+	if err == nil {
+		kv.Close()
+	}
+}
+
+// TestWatchEndpointFailover needs a cluster of several members
+// whose client endpoints are read from the environment, comma
+// separated. The test stops the first member with the command
+// in KVSTORE_STOP_MEMBER and expects the watch to carry on
+// through another one.
+func TestWatchEndpointFailover(t *testing.T) {
+	endpoints := strings.Split(os.Getenv("KVSTORE_CLUSTER_ENDPOINTS"), ",")
+	stop := os.Getenv("KVSTORE_STOP_MEMBER")
+	if len(endpoints) < 2 || stop == "" {
+		t.Skip("KVSTORE_CLUSTER_ENDPOINTS or KVSTORE_STOP_MEMBER not set")
+	}
+
+	kv, err := New(endpoints, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer kv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	events, err := kv.Watch(ctx, "testWatchEndpointFailover", &store.WatchOptions{
+		Reconnect:  true,
+		MaxBackoff: time.Second,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, exec.Command("sh", "-c", stop).Run())
+
+	// Writes go through another member, the watch must see them
+	writer, err := New(endpoints[1:], nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer writer.Close()
+	go func() {
+		for ctx.Err() == nil {
+			writer.Put(ctx, "testWatchEndpointFailover", "value", nil)
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+
+	for e := range events {
+		if e.Action == store.ActionPut {
+			assert.Equal(t, "value", e.Node.Value)
+			return
+		}
+	}
+	t.Fatal("watch closed without resuming")
+}
+
+func TestWatchCancel(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	for _, opt := range []*store.WatchOptions{nil, {Reconnect: true}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := kv.WatchTree(ctx, "testWatchCancel", opt)
+		assert.NoError(t, err)
+		assert.Len(t, kv.WatchStats(), 1)
+
+		cancel()
+
+		// No reconnection is attempted, the watch
+		// fails once and the channel is closed
+		var last *store.WatchResponse
+		timeout := time.After(5 * time.Second)
+	loop:
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					break loop
+				}
+				assert.NotEqual(t, store.ActionReconnect, event.Action)
+				last = event
+			case <-timeout:
+				t.Fatal("watch channel not closed")
+			}
+		}
+		if assert.NotNil(t, last) {
+			assert.Equal(t, store.ErrWatchFail, last.Error)
+		}
+
+		// The etcd watch itself is gone
+		assert.Empty(t, kv.WatchStats())
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	kv, err := New([]string{client}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultOperationTimeout, kv.(*Etcd).opTimeout)
+	kv.Close()
+
+	// Nothing listens there, calls must not hang
+	kv, err = New([]string{"localhost:1"}, &store.Config{
+		OperationTimeout: 300 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	ctx := context.Background()
+	start := time.Now()
+	_, err = kv.Get(ctx, "testOperationTimeout")
+	assert.Error(t, err)
+	_, err = kv.Put(ctx, "testOperationTimeout", "value", nil)
+	assert.Error(t, err)
+	_, err = kv.List(ctx, "testOperationTimeout")
+	assert.Error(t, err)
+	assert.WithinDuration(t, start, time.Now(), 3*time.Second)
+
+	// A deadline set by the caller takes precedence
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start = time.Now()
+	_, err = kv.Get(ctx, "testOperationTimeout")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) > 900*time.Millisecond)
+}
+
+func TestCallContextCancel(t *testing.T) {
+	kv, err := New([]string{"localhost:1"}, &store.Config{OperationTimeout: -1})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	// Without any timeout, cancelling the context of
+	// the call is what aborts it
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = kv.Get(ctx, "testCallContextCancel")
+	assert.Error(t, err)
+	_, err = kv.Put(ctx, "testCallContextCancel", "value", nil)
+	assert.Error(t, err)
+	assert.Error(t, kv.Delete(ctx, "testCallContextCancel"))
+	assert.WithinDuration(t, start, time.Now(), 3*time.Second)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	kv, err := New([]string{"localhost:1"}, &store.Config{OperationTimeout: -1})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	// The timeout of the write bounds it on its own
+	ctx := context.Background()
+	opts := &store.WriteOptions{Timeout: 300 * time.Millisecond}
+	start := time.Now()
+	_, err = kv.Put(ctx, "testWriteTimeout", "value", opts)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, kv.AtomicPut(ctx, "testWriteTimeout", "value", nil, opts))
+	assert.WithinDuration(t, start, time.Now(), 3*time.Second)
+
+	// So does a cancelled context, whose error is returned
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = kv.Put(ctx, "testWriteTimeout", "value", &store.WriteOptions{Timeout: time.Minute})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestHelpersTimeout(t *testing.T) {
+	kv, err := New([]string{"localhost:1"}, &store.Config{
+		OperationTimeout: 300 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+	s := kv.(*Etcd)
+
+	// Calls without deadline get the operation timeout,
+	// nothing listens there so they all time out
+	ctx := context.Background()
+	counter, err := s.WindowedCounter("testHelpersTimeout/counter", time.Minute)
+	assert.NoError(t, err)
+	calls := map[string]func() error{
+		"Swap": func() error { return s.Swap(ctx, "testHelpersTimeout/a", "testHelpersTimeout/b") },
+		"GCOlderThan": func() error {
+			_, err := s.GCOlderThan(ctx, "testHelpersTimeout", time.Hour, func(*store.KVPair) (time.Time, error) {
+				return time.Time{}, nil
+			})
+			return err
+		},
+		"ListChangedSince": func() error {
+			_, err := s.ListChangedSince(ctx, "testHelpersTimeout", 1)
+			return err
+		},
+		"SnapshotPrefix": func() error {
+			_, _, err := s.SnapshotPrefix(ctx, "testHelpersTimeout")
+			return err
+		},
+		"ReadSet.Get": func() error {
+			_, err := s.NewReadSet(ctx).Get("testHelpersTimeout/a")
+			return err
+		},
+		"ReadSet.Commit": func() error {
+			return s.NewReadSet(ctx).Commit(map[string]string{"testHelpersTimeout/a": "a"})
+		},
+		"WindowedCounter.Incr": func() error {
+			_, err := counter.Incr(ctx, 1)
+			return err
+		},
+		"WindowedCounter.Value": func() error {
+			_, err := counter.Value(ctx)
+			return err
+		},
+		"ExistsMany": func() error {
+			_, err := s.ExistsMany(ctx, []string{"testHelpersTimeout/a"})
+			return err
+		},
+		"ListWithLease": func() error {
+			_, err := s.ListWithLease(ctx, "testHelpersTimeout")
+			return err
+		},
+	}
+	for name, call := range calls {
+		start := time.Now()
+		assert.Error(t, call(), name)
+		assert.WithinDuration(t, start, time.Now(), 2*time.Second, name)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	config := kv.Config()
+	assert.Equal(t, []string{client}, config.Endpoints)
+	assert.Equal(t, 3*time.Second, config.ConnectionTimeout)
+	assert.Equal(t, defaultOperationTimeout, config.OperationTimeout)
+	assert.False(t, config.TLS)
+	assert.Equal(t, "test", config.Username)
+	assert.Equal(t, "[REDACTED]", config.Password)
+	assert.NotContains(t, fmt.Sprintf("%+v", config), "very-secure")
+
+	// The snapshot is a copy
+	config.Endpoints[0] = "changed"
+	assert.Equal(t, []string{client}, kv.Config().Endpoints)
+
+	// TLS files that cannot be loaded fail the creation
+	_, err := New([]string{client}, &store.Config{
+		ClientTLS: &store.ClientTLSConfig{CACertFile: "testConfig/missing.pem"},
+	})
+	assert.Error(t, err)
+}
+
+func TestAutoSync(t *testing.T) {
+	kv, err := New([]string{client}, &store.Config{
+		ConnectionTimeout: 3 * time.Second,
+		Username:          "test",
+		Password:          "very-secure",
+		AutoSyncInterval:  100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+	assert.Equal(t, 100*time.Millisecond, kv.(*Etcd).Config().AutoSyncInterval)
+
+	// The endpoints are replaced by the URLs the members advertise
+	c := kv.(*Etcd).client
+	members, err := c.MemberList(context.Background())
+	assert.NoError(t, err)
+	var urls []string
+	for _, m := range members.Members {
+		urls = append(urls, m.ClientURLs...)
+	}
+	for i := 0; i < 50 && c.Endpoints()[0] == client; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, urls, c.Endpoints())
+}
+
+func TestNamespace(t *testing.T) {
+	namespaced := func(ns string) *Etcd {
+		kv, err := New([]string{client}, &store.Config{
+			ConnectionTimeout: 3 * time.Second,
+			Username:          "test",
+			Password:          "very-secure",
+			Namespace:         ns,
+		})
+		if err != nil {
+			t.Fatalf("cannot create store: %v", err)
+		}
+		return kv.(*Etcd)
+	}
+	a := namespaced("testNamespace/a")
+	defer a.Close()
+	b := namespaced("testNamespace/b")
+	defer b.Close()
+	root := makeEtcdClient(t)
+	defer root.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer root.DeleteTree(context.Background(), "testNamespace")
+
+	events, err := a.WatchTree(ctx, "app", nil)
+	assert.NoError(t, err)
+
+	pair, err := a.Put(ctx, "app/key", "v", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/app/key", pair.Key)
+
+	// Invisible from the other namespace
+	_, err = b.List(ctx, "app")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+	_, err = b.Get(ctx, "app/key")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	pairs, err := a.List(ctx, "app")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, "/app/key", pairs[0].Key)
+	}
+	e := <-events
+	assert.Equal(t, "/app/key", e.Node.Key)
+
+	// The key lives under the namespace
+	pair, err = root.Get(ctx, "testNamespace/a/app/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", pair.Value)
+
+	// Locks do not contend across namespaces
+	lockA := a.NewLock("app/lock", nil)
+	assert.NoError(t, lockA.Lock(ctx))
+	ok, err := b.NewLock("app/lock", nil).TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, lockA.Unlock(ctx))
+
+	assert.Equal(t, "testNamespace/a", a.Config().Namespace)
+}
+
+func TestDeleteTreeIfMarker(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testDeleteTreeIfMarker")
+
+	_, err := kv.Put(ctx, "testDeleteTreeIfMarker/version", "v2", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testDeleteTreeIfMarker/v1/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testDeleteTreeIfMarker/v1/b", "b", nil)
+	assert.NoError(t, err)
+
+	// Someone rolled forward, the old tree is kept
+	n, err := kv.DeleteTreeIfMarker(ctx, "testDeleteTreeIfMarker/v1", "testDeleteTreeIfMarker/version", "v1")
+	assert.Equal(t, store.ErrKeyModified, err)
+	assert.Equal(t, 0, n)
+	_, err = kv.Get(ctx, "testDeleteTreeIfMarker/v1/a")
+	assert.NoError(t, err)
+
+	// A missing marker never matches
+	_, err = kv.DeleteTreeIfMarker(ctx, "testDeleteTreeIfMarker/v1", "testDeleteTreeIfMarker/missing", "")
+	assert.Equal(t, store.ErrKeyModified, err)
+
+	n, err = kv.DeleteTreeIfMarker(ctx, "testDeleteTreeIfMarker/v1", "testDeleteTreeIfMarker/version", "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = kv.List(ctx, "testDeleteTreeIfMarker/v1")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
+
+func TestDeleteTreeCount(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c/d"} {
+		_, err := kv.Put(ctx, "testDeleteTreeCount/"+key, "value", nil)
+		assert.NoError(t, err)
+	}
+
+	n, err := kv.DeleteTreeCount(ctx, "testDeleteTreeCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = kv.DeleteTreeCount(ctx, "testDeleteTreeCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// The whole keyspace is never deleted
+	for _, directory := range []string{"", "/", "//"} {
+		_, err = kv.DeleteTreeCount(ctx, directory)
+		assert.Equal(t, store.ErrEmptyDirectory, err)
+		assert.Equal(t, store.ErrEmptyDirectory, kv.DeleteTree(ctx, directory))
+		_, err = kv.DeleteTreePaged(ctx, directory, 0, 0)
+		assert.Equal(t, store.ErrEmptyDirectory, err)
+	}
+}
+
+func TestDeleteTreePaged(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testDeleteTreePaged")
+
+	// Seed the keys with a few large transactions
+	const count = 2000
+	for i := 0; i < count; i += maxTxnOps {
+		var ops []etcd.Op
+		for j := i; j < i+maxTxnOps && j < count; j++ {
+			ops = append(ops, etcd.OpPut(fmt.Sprintf("/testDeleteTreePaged/%04d", j), "value"))
+		}
+		_, err := kv.client.Txn(ctx).Then(ops...).Commit()
+		assert.NoError(t, err)
+	}
+	_, err := kv.Put(ctx, "testDeleteTreeSibling", "kept", nil)
+	assert.NoError(t, err)
+	defer kv.Delete(ctx, "testDeleteTreeSibling")
+
+	n, err := kv.DeleteTreePaged(ctx, "testDeleteTreePaged/", 150, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, count, n)
+
+	_, err = kv.List(ctx, "testDeleteTreePaged/")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+	_, err = kv.Get(ctx, "testDeleteTreeSibling")
+	assert.NoError(t, err)
+
+	n, err = kv.DeleteTreePaged(ctx, "testDeleteTreePaged/", 150, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,92 @@
+package etcdv3
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	mvccpb "github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// GCOlderThan deletes the keys under directory whose timestamp, as
+// returned by extract, is older than age. Deletes are batched in
+// transactions and a key modified since it was read is kept. It
+// returns the number of keys deleted, an extract error stops the
+// collection.
+func (s *Etcd) GCOlderThan(ctx context.Context, directory string, age time.Duration, extract func(*store.KVPair) (time.Time, error)) (int, error) {
+	rctx, cancel := s.withTimeout(ctx)
+	resp, err := s.client.Get(rctx, store.Normalize(directory), etcd.WithPrefix())
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-age)
+	var (
+		stale   []*mvccpb.KeyValue
+		deleted int
+	)
+	for _, kv := range resp.Kvs {
+		created, err := extract(newKVPair(kv))
+		if err != nil {
+			return deleted, err
+		}
+		if !created.Before(deadline) {
+			continue
+		}
+
+		stale = append(stale, kv)
+		if len(stale) == maxTxnOps {
+			n, err := s.deleteUnmodified(ctx, stale)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+			stale = stale[:0]
+		}
+	}
+
+	n, err := s.deleteUnmodified(ctx, stale)
+	return deleted + n, err
+}
+
+// deleteUnmodified deletes the given keys in a single transaction
+// provided none was modified. Otherwise the keys are deleted one by
+// one so that only the modified ones are kept.
+func (s *Etcd) deleteUnmodified(ctx context.Context, kvs []*mvccpb.KeyValue) (int, error) {
+	if len(kvs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := s.writeTimeout(ctx, nil)
+	defer cancel()
+
+	cmps := make([]etcd.Cmp, 0, len(kvs))
+	ops := make([]etcd.Op, 0, len(kvs))
+	for _, kv := range kvs {
+		cmps = append(cmps, etcd.Compare(etcd.ModRevision(string(kv.Key)), "=", kv.ModRevision))
+		ops = append(ops, etcd.OpDelete(string(kv.Key)))
+	}
+
+	resp, err := s.client.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return 0, err
+	}
+	if resp.Succeeded {
+		return len(kvs), nil
+	}
+
+	deleted := 0
+	for i := range kvs {
+		resp, err := s.client.Txn(ctx).If(cmps[i]).Then(ops[i]).Commit()
+		if err != nil {
+			return deleted, err
+		}
+		if resp.Succeeded {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
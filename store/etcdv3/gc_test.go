@@ -0,0 +1,76 @@
+package etcdv3
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCOlderThan(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testGCOlderThan")
+
+	// Values are unix timestamps, the keys name their age in hours
+	now := time.Now()
+	for _, hours := range []int{0, 1, 5, 25, 48} {
+		created := now.Add(-time.Duration(hours) * time.Hour).Unix()
+		key := fmt.Sprintf("testGCOlderThan/%d", hours)
+		_, err := kv.Put(ctx, key, strconv.FormatInt(created, 10), nil)
+		assert.NoError(t, err)
+	}
+
+	extract := func(pair *store.KVPair) (time.Time, error) {
+		sec, err := strconv.ParseInt(pair.Value, 10, 64)
+		return time.Unix(sec, 0), err
+	}
+
+	n, err := kv.GCOlderThan(ctx, "testGCOlderThan", 24*time.Hour, extract)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	pairs, err := kv.List(ctx, "testGCOlderThan")
+	assert.NoError(t, err)
+	var keys []string
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	assert.Equal(t, []string{"/testGCOlderThan/0", "/testGCOlderThan/1", "/testGCOlderThan/5"}, keys)
+
+	// Extraction failures stop the collection
+	_, err = kv.Put(ctx, "testGCOlderThan/bad", "not a timestamp", nil)
+	assert.NoError(t, err)
+	_, err = kv.GCOlderThan(ctx, "testGCOlderThan", time.Minute, extract)
+	assert.Error(t, err)
+}
+
+func TestGCOlderThanBatches(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testGCOlderThanBatches")
+
+	// More keys than a single transaction accepts
+	for i := 0; i < maxTxnOps+10; i++ {
+		_, err := kv.Put(ctx, fmt.Sprintf("testGCOlderThanBatches/%d", i), "", nil)
+		assert.NoError(t, err)
+	}
+
+	n, err := kv.GCOlderThan(ctx, "testGCOlderThanBatches", 0, func(*store.KVPair) (time.Time, error) {
+		return time.Time{}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, maxTxnOps+10, n)
+
+	_, err = kv.List(ctx, "testGCOlderThanBatches")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+}
@@ -0,0 +1,78 @@
+package etcdv3
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// PutIndexed writes "key" along with secondary index entries in a
+// single transaction. Every index key holds the normalized primary
+// key as its value, so that listing an index prefix leads back to
+// the data. A TTL in opts applies to the index entries as well.
+// Writing a key twice fails with ErrDuplicateKey.
+func (s *Etcd) PutIndexed(ctx context.Context, key, value string, indexKeys []string, opts *store.WriteOptions) error {
+	if len(indexKeys)+1 > maxTxnOps {
+		return store.ErrTooManyOperations
+	}
+	if err := checkDuplicates(append([]string{key}, indexKeys...)); err != nil {
+		return err
+	}
+
+	ctx, cancel := s.writeTimeout(ctx, opts)
+	defer cancel()
+
+	key = store.Normalize(key)
+	s.observeValue(key, value)
+
+	var putOpts []etcd.OpOption
+	if opts != nil && opts.TTL > 0 {
+		lease, err := s.client.Grant(ctx, int64(opts.TTL.Seconds()))
+		if err != nil {
+			return err
+		}
+		putOpts = append(putOpts, etcd.WithLease(lease.ID))
+	}
+
+	ops := []etcd.Op{etcd.OpPut(key, value, putOpts...)}
+	for _, indexKey := range indexKeys {
+		ops = append(ops, etcd.OpPut(store.Normalize(indexKey), key, putOpts...))
+	}
+
+	_, err := s.client.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+// DeleteIndexed deletes "key" and its secondary index entries in
+// a single transaction. It returns ErrKeyNotFound, deleting
+// nothing, if the primary key does not exist.
+func (s *Etcd) DeleteIndexed(ctx context.Context, key string, indexKeys []string) error {
+	if len(indexKeys)+1 > maxTxnOps {
+		return store.ErrTooManyOperations
+	}
+	if err := checkDuplicates(append([]string{key}, indexKeys...)); err != nil {
+		return err
+	}
+	key = store.Normalize(key)
+
+	ops := []etcd.Op{etcd.OpDelete(key)}
+	for _, indexKey := range indexKeys {
+		ops = append(ops, etcd.OpDelete(store.Normalize(indexKey)))
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.client.Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(key), ">", 0)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return store.ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package etcdv3
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutIndexed(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testPutIndexed")
+
+	indexes := []string{
+		"testPutIndexed/by-color/red/1",
+		"testPutIndexed/by-size/large/1",
+	}
+	assert.NoError(t, kv.PutIndexed(ctx, "testPutIndexed/items/1", "red large item", indexes, nil))
+
+	item, err := kv.Get(ctx, "testPutIndexed/items/1")
+	assert.NoError(t, err)
+
+	// Index entries point back to the item and are
+	// written in the same revision
+	for _, index := range indexes {
+		pair, err := kv.Get(ctx, index)
+		assert.NoError(t, err)
+		assert.Equal(t, "/testPutIndexed/items/1", pair.Value)
+		assert.Equal(t, item.Index, pair.Index)
+	}
+
+	assert.NoError(t, kv.DeleteIndexed(ctx, "testPutIndexed/items/1", indexes))
+	for _, key := range append(indexes, "testPutIndexed/items/1") {
+		exists, err := kv.Exists(ctx, key)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	}
+
+	// Nothing is deleted when the primary key is missing
+	_, err = kv.Put(ctx, "testPutIndexed/by-color/red/2", "/testPutIndexed/items/2", nil)
+	assert.NoError(t, err)
+	err = kv.DeleteIndexed(ctx, "testPutIndexed/items/2", []string{"testPutIndexed/by-color/red/2"})
+	assert.Equal(t, store.ErrKeyNotFound, err)
+	exists, err := kv.Exists(ctx, "testPutIndexed/by-color/red/2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestIndexedDuplicateKey(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testIndexedDuplicateKey")
+
+	err := kv.PutIndexed(ctx, "testIndexedDuplicateKey/items/1", "item", []string{
+		"testIndexedDuplicateKey/by-color/red/1",
+		"/testIndexedDuplicateKey/by-color/red/1/",
+	}, nil)
+	assert.Equal(t, store.ErrDuplicateKey, err)
+
+	// Nothing was written
+	exists, err := kv.Exists(ctx, "testIndexedDuplicateKey/items/1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// An index entry cannot overwrite the primary key either
+	err = kv.PutIndexed(ctx, "testIndexedDuplicateKey/items/1", "item", []string{"testIndexedDuplicateKey/items/1"}, nil)
+	assert.Equal(t, store.ErrDuplicateKey, err)
+	err = kv.DeleteIndexed(ctx, "testIndexedDuplicateKey/items/1", []string{"testIndexedDuplicateKey/items/1"})
+	assert.Equal(t, store.ErrDuplicateKey, err)
+}
@@ -0,0 +1,141 @@
+package etcdv3
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// defaultPageSize is the number of keys fetched per
+// page when iterating
+const defaultPageSize = 100
+
+// Iterator walks the keys of a directory in key order, page by
+// page, at a fixed revision
+type Iterator struct {
+	s        *Etcd
+	ctx      context.Context
+	end      string
+	next     string
+	rev      int64
+	pageSize int64
+
+	page []*store.KVPair
+	pair *store.KVPair
+	done bool
+	err  error
+}
+
+// StableIterator returns an iterator over the keys under
+// directory. The revision is pinned by the first page read, every
+// following page is read at that same revision: the iteration is
+// a point-in-time view, changes made meanwhile are not seen and
+// cannot shift the pages. pageSize defaults to 100 when not
+// positive.
+//
+// The iteration fails with ErrCompacted if the pinned revision
+// is compacted before it is over.
+func (s *Etcd) StableIterator(ctx context.Context, directory string, pageSize int) *Iterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	directory = store.Normalize(directory)
+	return &Iterator{
+		s:        s,
+		ctx:      ctx,
+		next:     directory,
+		end:      etcd.GetPrefixRangeEnd(directory),
+		pageSize: int64(pageSize),
+	}
+}
+
+// Next advances to the next pair, it returns false once the
+// iteration is over or failed
+func (it *Iterator) Next() bool {
+	if len(it.page) == 0 && !it.done && it.err == nil {
+		it.err = it.fetch()
+	}
+	if len(it.page) == 0 || it.err != nil {
+		it.pair = nil
+		return false
+	}
+
+	it.pair, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Pair returns the current pair
+func (it *Iterator) Pair() *store.KVPair {
+	return it.pair
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Revision returns the revision the iteration is pinned at,
+// zero until the first page is read
+func (it *Iterator) Revision() uint64 {
+	return uint64(it.rev)
+}
+
+func (it *Iterator) fetch() error {
+	opts := []etcd.OpOption{
+		etcd.WithRange(it.end),
+		etcd.WithLimit(it.pageSize),
+		etcd.WithRev(it.rev),
+	}
+	ctx, cancel := it.s.withTimeout(it.ctx)
+	defer cancel()
+
+	resp, err := it.s.client.Get(ctx, it.next, opts...)
+	if err == rpctypes.ErrCompacted {
+		return store.ErrCompacted
+	}
+	if err != nil {
+		return err
+	}
+
+	if it.rev == 0 {
+		it.rev = resp.Header.Revision
+	}
+	for _, kv := range resp.Kvs {
+		it.page = append(it.page, newKVPair(kv))
+	}
+
+	if !resp.More || len(resp.Kvs) == 0 {
+		it.done = true
+	} else {
+		it.next = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+	return nil
+}
+
+// SnapshotPrefix reads every key under directory at a single
+// revision, paging through the prefix with StableIterator, and
+// returns them as a map of keys to values along with that
+// revision. The map is a point-in-time view of the prefix even
+// if it changes during the read.
+func (s *Etcd) SnapshotPrefix(ctx context.Context, directory string) (map[string]string, int64, error) {
+	return snapshot(s.StableIterator(ctx, directory, 0), nil)
+}
+
+// snapshot drains it into a map, visit is called with every
+// pair read if not nil
+func snapshot(it *Iterator, visit func(*store.KVPair)) (map[string]string, int64, error) {
+	values := make(map[string]string)
+	for it.Next() {
+		pair := it.Pair()
+		values[pair.Key] = pair.Value
+		if visit != nil {
+			visit(pair)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, 0, err
+	}
+	return values, int64(it.Revision()), nil
+}
@@ -0,0 +1,104 @@
+package etcdv3
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStableIterator(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testStableIterator")
+
+	for i := 0; i < 10; i++ {
+		_, err := kv.Put(ctx, fmt.Sprintf("testStableIterator/%02d", i), "old", nil)
+		assert.NoError(t, err)
+	}
+
+	it := kv.StableIterator(ctx, "testStableIterator", 3)
+	var keys []string
+	for it.Next() {
+		pair := it.Pair()
+		keys = append(keys, pair.Key)
+		assert.Equal(t, "old", pair.Value)
+
+		// Mutate the directory while iterating, the
+		// iteration must not notice
+		if len(keys) == 1 {
+			assert.NoError(t, kv.Delete(ctx, "testStableIterator/05"))
+			_, err := kv.Put(ctx, "testStableIterator/03", "new", nil)
+			assert.NoError(t, err)
+			_, err = kv.Put(ctx, "testStableIterator/04a", "new", nil)
+			assert.NoError(t, err)
+			_, err = kv.Put(ctx, "testStableIterator/99", "new", nil)
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, it.Err())
+	assert.NotZero(t, it.Revision())
+
+	var expected []string
+	for i := 0; i < 10; i++ {
+		expected = append(expected, fmt.Sprintf("/testStableIterator/%02d", i))
+	}
+	assert.Equal(t, expected, keys)
+
+	// An empty directory ends right away
+	it = kv.StableIterator(ctx, "testStableIterator/missing", 0)
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
+
+func TestSnapshotPrefix(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	dir := "testSnapshotPrefix"
+	defer kv.DeleteTree(ctx, dir)
+
+	want := map[string]string{}
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("%s/%02d", dir, i)
+		_, err := kv.Put(ctx, key, "old", nil)
+		assert.NoError(t, err)
+		want["/"+key] = "old"
+	}
+
+	// Mutate the prefix once the first page is read
+	mutated := false
+	values, rev, err := snapshot(kv.StableIterator(ctx, dir, 2), func(*store.KVPair) {
+		if mutated {
+			return
+		}
+		mutated = true
+		kv.Put(ctx, dir+"/04", "new", nil)
+		kv.Put(ctx, dir+"/05", "new", nil)
+		kv.Delete(ctx, dir+"/03")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, want, values)
+
+	// The revision returned is the one of the view
+	resp, err := kv.client.Get(ctx, "/"+dir, etcd.WithPrefix(), etcd.WithRev(rev))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), resp.Count)
+
+	values, _, err = kv.SnapshotPrefix(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", values["/"+dir+"/04"])
+	assert.Len(t, values, 5)
+
+	values, rev, err = kv.SnapshotPrefix(ctx, "testSnapshotPrefixMissing")
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+	assert.NotZero(t, rev)
+}
@@ -0,0 +1,247 @@
+package etcdv3
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// ListWithLease lists the child nodes of a given directory
+// along with the remaining TTL of their lease. Keys sharing
+// a lease only cost a single lease lookup.
+func (s *Etcd) ListWithLease(ctx context.Context, directory string) ([]*store.LeasedPair, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pairs, err := s.List(ctx, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	ttls := make(map[uint64]time.Duration)
+	leased := make([]*store.LeasedPair, 0, len(pairs))
+	for _, pair := range pairs {
+		if pair.Lease == 0 {
+			leased = append(leased, &store.LeasedPair{KVPair: pair})
+			continue
+		}
+
+		ttl, ok := ttls[pair.Lease]
+		if !ok {
+			if ttl, err = s.leaseTTL(ctx, pair.Lease); err != nil {
+				return nil, err
+			}
+			if ttl < 0 {
+				ttl = 0
+			}
+			ttls[pair.Lease] = ttl
+		}
+		leased = append(leased, &store.LeasedPair{KVPair: pair, TTL: ttl})
+	}
+
+	return leased, nil
+}
+
+// TimeToLive returns the remaining time to live of the lease
+// attached to "key". It fails with ErrNoLease if the key never
+// expires, and with ErrKeyNotFound if it does not exist or its
+// lease has just expired. etcd counts whole seconds, a key in
+// its last second reports zero.
+func (s *Etcd) TimeToLive(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pair, err := s.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if pair.Lease == 0 {
+		return 0, store.ErrNoLease
+	}
+
+	ttl, err := s.leaseTTL(ctx, pair.Lease)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, store.ErrKeyNotFound
+	}
+	return ttl, nil
+}
+
+// leaseTTL returns the remaining time to live of lease, negative
+// once it has expired
+func (s *Etcd) leaseTTL(ctx context.Context, lease uint64) (time.Duration, error) {
+	resp, err := s.client.TimeToLive(ctx, etcd.LeaseID(lease))
+	if err != nil {
+		return 0, err
+	}
+
+	// An expired lease reports a negative TTL, a lease
+	// with less than a second left a zero one
+	if resp.TTL < 0 {
+		return -1, nil
+	}
+	return time.Duration(resp.TTL) * time.Second, nil
+}
+
+// Register writes "key" bound to a lease of the given ttl and
+// keeps it alive in the background until stop is called. If
+// the lease is lost or the key deleted, the key is registered
+// again. stop revokes the lease, which deletes the key, and so
+// does closing the store.
+func (s *Etcd) Register(ctx context.Context, key, value string, ttl time.Duration) (stop func(), err error) {
+	key = store.Normalize(key)
+
+	leaseID, rev, err := s.register(ctx, key, value, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	regCtx, cancel := context.WithCancel(s.ctx)
+	done := make(chan struct{})
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer close(done)
+		s.keepRegistered(regCtx, key, value, ttl, leaseID, rev)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	return stop, nil
+}
+
+// register puts "key" with a new lease, returning the lease
+// and the revision of the write
+func (s *Etcd) register(ctx context.Context, key, value string, ttl time.Duration) (etcd.LeaseID, int64, error) {
+	ctx, cancel := s.writeTimeout(ctx, nil)
+	defer cancel()
+
+	lease, err := s.client.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	resp, err := s.client.Put(ctx, key, value, etcd.WithLease(lease.ID))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return lease.ID, resp.Header.Revision, nil
+}
+
+func (s *Etcd) keepRegistered(ctx context.Context, key, value string, ttl time.Duration, leaseID etcd.LeaseID, rev int64) {
+	for {
+		s.holdRegistration(ctx, key, leaseID, rev)
+		if ctx.Err() != nil {
+			revokeCtx, cancel := s.withTimeout(context.Background())
+			if _, err := s.client.Revoke(revokeCtx, leaseID); err != nil {
+				s.logger.Warnf("kvstore: revoking the lease of %s: %v", key, err)
+			}
+			cancel()
+			return
+		}
+
+		// The registration is lost, create it again
+		s.logger.Warnf("kvstore: registration of %s lost, registering it again", key)
+		s.client.Revoke(ctx, leaseID)
+		retry := newBackoff(ttl)
+		for {
+			var err error
+			leaseID, rev, err = s.register(ctx, key, value, ttl)
+			if err == nil {
+				break
+			}
+			s.logger.Errorf("kvstore: registering %s: %v", key, err)
+
+			select {
+			case <-time.After(retry.next()):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// holdRegistration keeps the lease alive and returns once
+// the lease is lost, the key deleted or ctx is done
+func (s *Etcd) holdRegistration(ctx context.Context, key string, leaseID etcd.LeaseID, rev int64) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keepAlive, err := s.client.KeepAlive(ctx, leaseID)
+	if err != nil {
+		return
+	}
+	deleted := s.client.Watch(ctx, key, etcd.WithRev(rev+1), etcd.WithFilterPut())
+
+	for {
+		select {
+		case _, ok := <-keepAlive:
+			if !ok {
+				return
+			}
+		case resp, ok := <-deleted:
+			if !ok || len(resp.Events) > 0 || resp.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// LeaseStatus reports the outcome of a lease keepalive
+type LeaseStatus struct {
+	// TTL is the lease TTL granted by the last keepalive
+	TTL time.Duration
+
+	// Error is set when the lease can no longer be kept
+	// alive, it is always the last status sent
+	Error error
+}
+
+// LeaseKeepAlive keeps the lease id alive until ctx is done and
+// reports every keepalive on the returned channel. When the
+// keepalive fails, because the lease was revoked, expired or the
+// cluster was unreachable for too long, a status holding
+// ErrLeaseLost is sent and the channel is closed. The channel is
+// closed without error once ctx is done.
+//
+// Statuses are dropped while the receiver is busy, except for
+// the final one.
+func (s *Etcd) LeaseKeepAlive(ctx context.Context, id uint64) (<-chan LeaseStatus, error) {
+	keepAlive, err := s.client.KeepAlive(ctx, etcd.LeaseID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(chan LeaseStatus, 1)
+	go func() {
+		defer close(status)
+		for resp := range keepAlive {
+			select {
+			case status <- LeaseStatus{TTL: time.Duration(resp.TTL) * time.Second}:
+			default:
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case status <- LeaseStatus{Error: store.ErrLeaseLost}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return status, nil
+}
@@ -0,0 +1,208 @@
+package etcdv3
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListWithLease(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testListWithLease")
+
+	_, err := kv.Put(ctx, "testListWithLease/leased", "a", &store.WriteOptions{TTL: 30 * time.Second})
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListWithLease/plain", "b", nil)
+	assert.NoError(t, err)
+
+	pairs, err := kv.ListWithLease(ctx, "testListWithLease")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+
+	for _, pair := range pairs {
+		switch pair.Key {
+		case "/testListWithLease/leased":
+			assert.NotZero(t, pair.Lease)
+			assert.True(t, pair.TTL > 0 && pair.TTL <= 30*time.Second, "unexpected ttl %v", pair.TTL)
+		case "/testListWithLease/plain":
+			assert.Zero(t, pair.Lease)
+			assert.Zero(t, pair.TTL)
+		default:
+			t.Errorf("unexpected key %s", pair.Key)
+		}
+	}
+}
+
+func TestTimeToLive(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testTimeToLive")
+
+	_, err := kv.Put(ctx, "testTimeToLive/leased", "a", &store.WriteOptions{TTL: 30 * time.Second})
+	assert.NoError(t, err)
+	ttl, err := kv.TimeToLive(ctx, "testTimeToLive/leased")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 25*time.Second && ttl <= 30*time.Second, "ttl %v", ttl)
+
+	_, err = kv.Put(ctx, "testTimeToLive/plain", "b", nil)
+	assert.NoError(t, err)
+	_, err = kv.TimeToLive(ctx, "testTimeToLive/plain")
+	assert.Equal(t, store.ErrNoLease, err)
+
+	_, err = kv.TimeToLive(ctx, "testTimeToLive/missing")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	// The last second of a live key reports zero
+	_, err = kv.Put(ctx, "testTimeToLive/short", "c", &store.WriteOptions{TTL: 2 * time.Second})
+	assert.NoError(t, err)
+	var zero bool
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		ttl, err := kv.TimeToLive(ctx, "testTimeToLive/short")
+		if err == store.ErrKeyNotFound {
+			break
+		}
+		assert.NoError(t, err)
+		if ttl == 0 {
+			zero = true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(t, zero, "no zero TTL seen before the key expired")
+}
+
+func TestRegisterKey(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	key := "testRegister"
+	ctx := context.Background()
+	defer kv.Delete(ctx, key)
+
+	stop, err := kv.Register(ctx, key, "node", 5*time.Second)
+	assert.NoError(t, err)
+
+	waitKey := func(exists bool) *store.KVPair {
+		for i := 0; i < 50; i++ {
+			pair, err := kv.Get(ctx, key)
+			if (err == nil) == exists {
+				return pair
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("key %s exists should be %v", key, exists)
+		return nil
+	}
+
+	pair := waitKey(true)
+	assert.Equal(t, "node", pair.Value)
+	assert.NotZero(t, pair.Lease)
+
+	// Losing the lease registers the key again
+	_, err = kv.client.Revoke(ctx, etcd.LeaseID(pair.Lease))
+	assert.NoError(t, err)
+	time.Sleep(500 * time.Millisecond)
+	pair2 := waitKey(true)
+	assert.NotEqual(t, pair.Lease, pair2.Lease)
+
+	// So does deleting the key
+	assert.NoError(t, kv.Delete(ctx, key))
+	time.Sleep(500 * time.Millisecond)
+	waitKey(true)
+
+	// Stopping removes the key for good
+	stop()
+	waitKey(false)
+	time.Sleep(500 * time.Millisecond)
+	waitKey(false)
+}
+
+func TestRegisterClosed(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	other := makeEtcdClient(t)
+	defer other.Close()
+
+	key := "testRegisterClosed"
+	ctx := context.Background()
+	defer other.Delete(ctx, key)
+
+	stop, err := kv.Register(ctx, key, "node", time.Second)
+	assert.NoError(t, err)
+	_, err = other.Get(ctx, key)
+	assert.NoError(t, err)
+
+	// The registration ends with the store, the key expires
+	kv.Close()
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("registration still running after close")
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err = other.Get(ctx, key); err == store.ErrKeyNotFound {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("key should expire after close, got %v", err)
+}
+
+func TestLeaseKeepAlive(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lease, err := kv.client.Grant(ctx, 5)
+	assert.NoError(t, err)
+
+	status, err := kv.LeaseKeepAlive(ctx, uint64(lease.ID))
+	assert.NoError(t, err)
+
+	select {
+	case st := <-status:
+		assert.NoError(t, st.Error)
+		assert.Equal(t, 5*time.Second, st.TTL)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no keepalive reported")
+	}
+
+	// The lease disappears behind our back
+	_, err = kv.client.Revoke(ctx, lease.ID)
+	assert.NoError(t, err)
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case st, ok := <-status:
+			if !ok {
+				t.Fatal("channel closed without reporting the loss")
+			}
+			if st.Error == nil {
+				continue
+			}
+			assert.Equal(t, store.ErrLeaseLost, st.Error)
+			_, ok = <-status
+			assert.False(t, ok)
+			return
+		case <-timeout:
+			t.Fatal("lease loss not reported")
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package etcdv3
+
+// nopLogger is the Logger of a store configured without
+// one, it discards everything
+type nopLogger struct{}
+
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+
+// observeValue reports the size of a value written to key and
+// warns when it goes over the configured soft limit
+func (s *Etcd) observeValue(key, value string) {
+	if s.observer != nil {
+		s.observer.ObserveValueSize(key, len(value))
+	}
+	if s.warnValueBytes > 0 && len(value) > s.warnValueBytes {
+		s.logger.Warnf("kvstore: value of %s is %d bytes, over the %d bytes warning threshold",
+			key, len(value), s.warnValueBytes)
+	}
+}
@@ -0,0 +1,127 @@
+package etcdv3
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is both a Logger and an Observer
+type recorder struct {
+	mu       sync.Mutex
+	warnings []string
+	sizes    map[string]int
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {}
+
+func (r *recorder) Warnf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) ObserveValueSize(key string, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sizes[key] = size
+}
+
+func TestWarnValueBytes(t *testing.T) {
+	rec := &recorder{sizes: make(map[string]int)}
+	kv, err := New([]string{client}, &store.Config{
+		ConnectionTimeout: 3 * time.Second,
+		Username:          "test",
+		Password:          "very-secure",
+		Logger:            rec,
+		Observer:          rec,
+		WarnValueBytes:    16,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testWarnValueBytes")
+
+	_, err = kv.Put(ctx, "testWarnValueBytes/small", "small", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rec.warnings)
+
+	// Large values are written nonetheless
+	large := strings.Repeat("x", 17)
+	_, err = kv.Put(ctx, "testWarnValueBytes/large", large, nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, "testWarnValueBytes/large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, pair.Value)
+
+	if assert.Len(t, rec.warnings, 1) {
+		assert.Contains(t, rec.warnings[0], "/testWarnValueBytes/large")
+	}
+	assert.Equal(t, map[string]int{
+		"/testWarnValueBytes/small": 5,
+		"/testWarnValueBytes/large": 17,
+	}, rec.sizes)
+}
+
+func TestLoggerDiagnostics(t *testing.T) {
+	rec := &recorder{sizes: make(map[string]int)}
+	kv, err := New([]string{client}, &store.Config{
+		ConnectionTimeout: 3 * time.Second,
+		Username:          "test",
+		Password:          "very-secure",
+		Logger:            rec,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	ctx := context.Background()
+	key := "testLoggerDiagnostics"
+	defer kv.Delete(ctx, key)
+
+	stop, err := kv.(*Etcd).Register(ctx, key, "node", 5*time.Second)
+	assert.NoError(t, err)
+	defer stop()
+
+	// Losing the registration is reported
+	assert.NoError(t, kv.Delete(ctx, key))
+	for i := 0; i < 50; i++ {
+		rec.mu.Lock()
+		n := len(rec.warnings)
+		rec.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if assert.Len(t, rec.warnings, 1) {
+		assert.Contains(t, rec.warnings[0], "registration of /testLoggerDiagnostics lost")
+	}
+}
+
+func TestNoLogger(t *testing.T) {
+	kv, err := New([]string{client}, &store.Config{
+		Username:       "test",
+		Password:       "very-secure",
+		WarnValueBytes: 1,
+	})
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.Delete(ctx, "testNoLogger")
+
+	// Diagnostics are discarded
+	_, err = kv.Put(ctx, "testNoLogger", "large", nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,94 @@
+package etcdv3
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// ReadSet records the keys read during a read-compute-write
+// flow so that the writes can be conditioned on none of them
+// having changed meanwhile
+type ReadSet struct {
+	s   *Etcd
+	ctx context.Context
+	rev int64
+
+	// reads maps the normalized keys read
+	// to their mod revision, zero if missing
+	reads map[string]int64
+}
+
+// NewReadSet returns an empty read set. All the reads of the set
+// are made at the revision of the first one, so that they observe
+// a consistent view of the store.
+func (s *Etcd) NewReadSet(ctx context.Context) *ReadSet {
+	return &ReadSet{
+		s:     s,
+		ctx:   ctx,
+		reads: make(map[string]int64),
+	}
+}
+
+// Get reads key and records it in the set. A missing key fails
+// with ErrKeyNotFound but is recorded all the same: the commit
+// then requires it to still be missing.
+func (rs *ReadSet) Get(key string) (*store.KVPair, error) {
+	key = store.Normalize(key)
+	ctx, cancel := rs.s.withTimeout(rs.ctx)
+	defer cancel()
+
+	resp, err := rs.s.client.Get(ctx, key, etcd.WithRev(rs.rev))
+	if err == rpctypes.ErrCompacted {
+		return nil, store.ErrCompacted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rs.rev == 0 {
+		rs.rev = resp.Header.Revision
+	}
+	if len(resp.Kvs) == 0 {
+		rs.reads[key] = 0
+		return nil, store.ErrKeyNotFound
+	}
+	rs.reads[key] = resp.Kvs[0].ModRevision
+	return newKVPair(resp.Kvs[0]), nil
+}
+
+// Revision returns the revision the reads are made at,
+// zero until the first read
+func (rs *ReadSet) Revision() uint64 {
+	return uint64(rs.rev)
+}
+
+// Commit atomically puts writes, provided none of the keys read
+// was modified, created or deleted since it was read. It fails
+// with ErrKeyModified otherwise, in which case nothing is written.
+func (rs *ReadSet) Commit(writes map[string]string) error {
+	cmps := make([]etcd.Cmp, 0, len(rs.reads))
+	for key, rev := range rs.reads {
+		cmps = append(cmps, etcd.Compare(etcd.ModRevision(key), "=", rev))
+	}
+	ops := make([]etcd.Op, 0, len(writes))
+	for key, value := range writes {
+		key = store.Normalize(key)
+		rs.s.observeValue(key, value)
+		ops = append(ops, etcd.OpPut(key, value))
+	}
+
+	ctx, cancel := rs.s.writeTimeout(rs.ctx, nil)
+	defer cancel()
+
+	resp, err := rs.s.client.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return store.ErrKeyModified
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package etcdv3
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSet(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testReadSet")
+
+	_, err := kv.Put(ctx, "testReadSet/from", "10", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testReadSet/to", "0", nil)
+	assert.NoError(t, err)
+
+	rs := kv.NewReadSet(ctx)
+	from, err := rs.Get("testReadSet/from")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", from.Value)
+	_, err = rs.Get("testReadSet/to")
+	assert.NoError(t, err)
+	assert.NotZero(t, rs.Revision())
+
+	assert.NoError(t, rs.Commit(map[string]string{
+		"testReadSet/from": "5",
+		"testReadSet/to":   "5",
+	}))
+	pair, err := kv.Get(ctx, "testReadSet/to")
+	assert.NoError(t, err)
+	assert.Equal(t, "5", pair.Value)
+
+	// A concurrent write to a read key fails the commit
+	rs = kv.NewReadSet(ctx)
+	_, err = rs.Get("testReadSet/from")
+	assert.NoError(t, err)
+	_, err = rs.Get("testReadSet/to")
+	assert.NoError(t, err)
+
+	_, err = kv.Put(ctx, "testReadSet/to", "100", nil)
+	assert.NoError(t, err)
+
+	err = rs.Commit(map[string]string{"testReadSet/from": "0"})
+	assert.Equal(t, store.ErrKeyModified, err)
+	pair, err = kv.Get(ctx, "testReadSet/from")
+	assert.NoError(t, err)
+	assert.Equal(t, "5", pair.Value)
+
+	// Missing keys must stay missing
+	rs = kv.NewReadSet(ctx)
+	_, err = rs.Get("testReadSet/missing")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	_, err = kv.Put(ctx, "testReadSet/missing", "created", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, store.ErrKeyModified, rs.Commit(map[string]string{"testReadSet/from": "0"}))
+}
@@ -0,0 +1,77 @@
+package etcdv3
+
+import (
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// tracker remembers the keys a tree watcher has been told about
+// so that deletes missed by the watch can be synthesized later
+type tracker struct {
+	keys map[string]*store.KVPair
+}
+
+func newTracker() *tracker {
+	return &tracker{keys: make(map[string]*store.KVPair)}
+}
+
+// seed records the keys currently under the directory
+func (t *tracker) seed(ctx context.Context, client *etcd.Client, directory string) error {
+	resp, err := client.Get(ctx, directory, etcd.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		t.keys[string(kv.Key)] = newKVPair(kv)
+	}
+	return nil
+}
+
+// observe updates the tracked set from a delivered response
+func (t *tracker) observe(r *store.WatchResponse) {
+	if r.Node == nil {
+		return
+	}
+	switch r.Action {
+	case store.ActionPut:
+		t.keys[r.Node.Key] = r.Node
+	case store.ActionDelete:
+		delete(t.keys, r.Node.Key)
+	}
+}
+
+// reconcile re-lists the directory and returns a synthetic DELETE
+// for every tracked key that is gone from the store
+func (t *tracker) reconcile(ctx context.Context, client *etcd.Client, directory string) ([]*store.WatchResponse, error) {
+	resp, err := client.Get(ctx, directory, etcd.WithPrefix(), etcd.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		present[string(kv.Key)] = true
+	}
+
+	var gone []string
+	for key := range t.keys {
+		if !present[key] {
+			gone = append(gone, key)
+		}
+	}
+	sort.Strings(gone)
+
+	deletes := make([]*store.WatchResponse, 0, len(gone))
+	for _, key := range gone {
+		deletes = append(deletes, &store.WatchResponse{
+			Action:  store.ActionDelete,
+			PreNode: t.keys[key],
+			Node:    &store.KVPair{Key: key},
+		})
+	}
+	return deletes, nil
+}
@@ -0,0 +1,69 @@
+package etcdv3
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// defaultStalenessRefresh is how often the cluster
+// revision is refreshed when no interval is configured
+const defaultStalenessRefresh = time.Second
+
+// refreshRevision keeps clusterRev up to date with linearizable
+// reads until the store is closed
+func (s *Etcd) refreshRevision(interval time.Duration) {
+	defer s.background.Done()
+
+	if interval <= 0 {
+		interval = defaultStalenessRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := s.client.Get(s.ctx, "/", etcd.WithCountOnly())
+		if err == nil {
+			s.observeRevision(resp.Header.Revision)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// observeRevision records rev as the cluster revision
+// if it is newer than the one already known
+func (s *Etcd) observeRevision(rev int64) {
+	for {
+		cur := atomic.LoadInt64(&s.clusterRev)
+		if rev <= cur || atomic.CompareAndSwapInt64(&s.clusterRev, cur, rev) {
+			return
+		}
+	}
+}
+
+// tooStale reports whether a serializable read served at rev
+// lags the cluster by more than the configured bound
+func (s *Etcd) tooStale(ctx context.Context, rev int64) bool {
+	if s.maxStale == 0 {
+		return false
+	}
+	if c, ok := store.ConsistencyFromContext(ctx); !ok || c != store.Serializable {
+		// Linearizable reads are the freshest we can get
+		s.observeRevision(rev)
+		return false
+	}
+	if atomic.LoadInt64(&s.clusterRev)-rev > s.maxStale {
+		atomic.AddUint64(&s.staleReads, 1)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package etcdv3
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// Swap atomically exchanges the values of keyA and keyB. Both
+// keys must exist, the exchange fails with ErrKeyModified if
+// either of them changes between the read and the write. Each
+// key keeps its own lease.
+func (s *Etcd) Swap(ctx context.Context, keyA, keyB string) error {
+	keyA, keyB = store.Normalize(keyA), store.Normalize(keyB)
+
+	ctx, cancel := s.writeTimeout(ctx, nil)
+	defer cancel()
+
+	resp, err := s.client.Txn(ctx).Then(etcd.OpGet(keyA), etcd.OpGet(keyB)).Commit()
+	if err != nil {
+		return err
+	}
+
+	var pairs []*store.KVPair
+	for _, r := range resp.Responses {
+		kvs := r.GetResponseRange().Kvs
+		if len(kvs) == 0 {
+			return store.ErrKeyNotFound
+		}
+		pairs = append(pairs, newKVPair(kvs[0]))
+	}
+
+	return s.swapPairs(ctx, pairs[0], pairs[1])
+}
+
+// swapPairs writes the value of a to b and the value of b to a,
+// provided neither was modified since they were read
+func (s *Etcd) swapPairs(ctx context.Context, a, b *store.KVPair) error {
+	resp, err := s.client.Txn(ctx).If(
+		etcd.Compare(etcd.ModRevision(a.Key), "=", int64(a.Index)),
+		etcd.Compare(etcd.ModRevision(b.Key), "=", int64(b.Index)),
+	).Then(
+		etcd.OpPut(a.Key, b.Value, etcd.WithIgnoreLease()),
+		etcd.OpPut(b.Key, a.Value, etcd.WithIgnoreLease()),
+	).Commit()
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return store.ErrKeyModified
+	}
+	return nil
+}
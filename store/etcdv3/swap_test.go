@@ -0,0 +1,68 @@
+package etcdv3
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwap(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testSwap")
+
+	_, err := kv.Put(ctx, "testSwap/current", "blue", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testSwap/next", "green", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Swap(ctx, "testSwap/current", "testSwap/next"))
+
+	current, err := kv.Get(ctx, "testSwap/current")
+	assert.NoError(t, err)
+	assert.Equal(t, "green", current.Value)
+	next, err := kv.Get(ctx, "testSwap/next")
+	assert.NoError(t, err)
+	assert.Equal(t, "blue", next.Value)
+
+	// Both keys are written in the same revision
+	assert.Equal(t, current.Index, next.Index)
+
+	assert.Equal(t, store.ErrKeyNotFound, kv.Swap(ctx, "testSwap/current", "testSwap/missing"))
+}
+
+func TestSwapConcurrentModification(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testSwapConcurrent")
+
+	_, err := kv.Put(ctx, "testSwapConcurrent/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testSwapConcurrent/b", "b", nil)
+	assert.NoError(t, err)
+
+	a, err := kv.Get(ctx, "testSwapConcurrent/a")
+	assert.NoError(t, err)
+	b, err := kv.Get(ctx, "testSwapConcurrent/b")
+	assert.NoError(t, err)
+
+	// b changes between the read and the write
+	_, err = kv.Put(ctx, "testSwapConcurrent/b", "changed", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, store.ErrKeyModified, kv.swapPairs(ctx, a, b))
+
+	// Nothing was written
+	a, err = kv.Get(ctx, "testSwapConcurrent/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", a.Value)
+	b, err = kv.Get(ctx, "testSwapConcurrent/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", b.Value)
+}
@@ -3,6 +3,7 @@ package etcdv3
 import (
 	"github.com/YuleiXiao/kvstore/store"
 	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 
 	"golang.org/x/net/context"
 )
@@ -28,6 +29,12 @@ func (t *txn) Begin() {
 
 func (t *txn) Commit() (*store.TxnResponse, error) {
 	resp, err := t.txn.If(t.cmp...).Then(t.success...).Else(t.Fail...).Commit()
+	switch err {
+	case rpctypes.ErrDuplicateKey:
+		return nil, store.ErrDuplicateKey
+	case rpctypes.ErrTooManyOps:
+		return nil, store.ErrTooManyOperations
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -44,13 +51,7 @@ func (t *txn) Commit() (*store.TxnResponse, error) {
 			//TODO: Is there anything need handle here
 		} else if rangeResp := r.GetResponseRange(); rangeResp != nil {
 			for _, kv := range rangeResp.Kvs {
-				opResp.Pairs = append(opResp.Pairs, &store.KVPair{
-					Key:     string(kv.Key),
-					Value:   string(kv.Value),
-					Index:   uint64(kv.ModRevision),
-					Version: uint64(kv.Version),
-					Lease:   uint64(kv.Lease),
-				})
+				opResp.Pairs = append(opResp.Pairs, newKVPair(kv))
 			}
 		}
 		txnResp.Responses = append(txnResp.Responses, opResp)
@@ -77,7 +78,7 @@ func (t *txn) IfModifyRevision(key, operator string, revision uint64) {
 
 func (t *txn) Put(key, value string, options *store.WriteOptions) {
 	var op etcd.Op
-	if options != nil {
+	if options != nil && options.TTL > 0 {
 		leaseResp, err := t.client.Grant(t.ctx, int64(options.TTL.Seconds()))
 		if err != nil {
 			return
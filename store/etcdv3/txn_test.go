@@ -171,3 +171,93 @@ func testTxn(t *testing.T, kv store.Store) {
 		t.Errorf("txn list result not correct. %v", resp)
 	}
 }
+
+func TestTxnDuplicateKey(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+
+	txn, err := kv.NewTxn(context.Background())
+	if err != nil {
+		t.Fatalf("Txn should be supported in etcdv3. %v", err)
+	}
+
+	txn.Begin()
+	txn.Put("/txn/duplicate", "a", nil)
+	txn.Put("/txn/duplicate", "b", nil)
+	if _, err := txn.Commit(); err != store.ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey, got %v", err)
+	}
+}
+
+func TestAtomicMulti(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+	ctx := context.Background()
+
+	kv.DeleteTree(ctx, "testAtomicMulti")
+	job, err := kv.Put(ctx, "testAtomicMulti/pending/job", "payload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.AtomicMulti(ctx, kv, []store.TxnOp{
+		{Key: "testAtomicMulti/pending/job", Delete: true, Previous: job},
+		{Key: "testAtomicMulti/running/job", Value: job.Value, Create: true},
+	})
+	if err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if _, err := kv.Get(ctx, "testAtomicMulti/pending/job"); err != store.ErrKeyNotFound {
+		t.Fatalf("pending job should be deleted, got %v", err)
+	}
+	running, err := kv.Get(ctx, "testAtomicMulti/running/job")
+	if err != nil || running.Value != "payload" {
+		t.Fatalf("running job should be written, got %v %v", running, err)
+	}
+
+	// The stale compare fails the whole transaction
+	err = store.AtomicMulti(ctx, kv, []store.TxnOp{
+		{Key: "testAtomicMulti/done/job", Value: "payload"},
+		{Key: "testAtomicMulti/running/job", Delete: true, Previous: job},
+	})
+	if err != store.ErrKeyModified {
+		t.Fatalf("expected ErrKeyModified, got %v", err)
+	}
+	if _, err := kv.Get(ctx, "testAtomicMulti/done/job"); err != store.ErrKeyNotFound {
+		t.Fatalf("nothing should be written, got %v", err)
+	}
+
+	kv.DeleteTree(ctx, "testAtomicMulti")
+}
+
+func TestChunkedMulti(t *testing.T) {
+	kv := makeEtcdClient(t)
+	defer kv.Close()
+	ctx := context.Background()
+
+	var ops []store.TxnOp
+	for i := 0; i < 300; i++ {
+		ops = append(ops, store.TxnOp{Key: fmt.Sprintf("testChunkedMulti/%03d", i), Value: "v", Create: true})
+	}
+
+	// A single transaction exceeds the limit of etcd
+	if err := store.AtomicMulti(ctx, kv, ops); err != store.ErrTooManyOperations {
+		t.Fatalf("expected ErrTooManyOperations, got %v", err)
+	}
+	if err := store.ChunkedMulti(ctx, kv, ops, 0); err != nil {
+		t.Fatalf("chunked multi failed: %v", err)
+	}
+	pairs, err := kv.List(ctx, "testChunkedMulti")
+	if err != nil || len(pairs) != len(ops) {
+		t.Fatalf("expected %d pairs, got %d %v", len(ops), len(pairs), err)
+	}
+
+	// A prefix delete is a single operation whatever the
+	// number of keys
+	if err := kv.DeleteTree(ctx, "testChunkedMulti"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := kv.List(ctx, "testChunkedMulti"); err != store.ErrKeyNotFound {
+		t.Fatalf("no key should be left, got %v", err)
+	}
+}
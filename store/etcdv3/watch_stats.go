@@ -0,0 +1,78 @@
+package etcdv3
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// WatchStat is a snapshot of the state of an active watch
+type WatchStat struct {
+	Key       string
+	Prefix    bool
+	Since     time.Time
+	Revision  uint64 // last revision delivered to the consumer
+	Delivered uint64 // number of responses delivered
+}
+
+// watchState tracks an active watch, guarded by Etcd.mu
+type watchState struct {
+	id     uint64
+	stat   WatchStat
+	cancel context.CancelFunc
+}
+
+func (s *Etcd) addWatch(key string, prefix bool, cancel context.CancelFunc) *watchState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastWatchID++
+	w := &watchState{
+		id:     s.lastWatchID,
+		cancel: cancel,
+		stat:   WatchStat{Key: key, Prefix: prefix, Since: time.Now()},
+	}
+	s.watches[w.id] = w
+	return w
+}
+
+func (s *Etcd) removeWatch(w *watchState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.watches, w.id)
+}
+
+// delivered records a response handed to the consumer
+func (s *Etcd) delivered(w *watchState, r *store.WatchResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.stat.Delivered = r.Seq
+	if r.Node != nil && r.Node.Index > w.stat.Revision {
+		w.stat.Revision = r.Node.Index
+	}
+}
+
+// WatchStats returns a snapshot of the watches currently
+// active on the store, ordered by creation. It is meant
+// for troubleshooting leaked or lagging watchers.
+func (s *Etcd) WatchStats() []WatchStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]uint64, 0, len(s.watches))
+	for id := range s.watches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	stats := make([]WatchStat, 0, len(ids))
+	for _, id := range ids {
+		stats = append(stats, s.watches[id].stat)
+	}
+	return stats
+}
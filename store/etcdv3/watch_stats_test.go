@@ -0,0 +1,69 @@
+package etcdv3
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchStats(t *testing.T) {
+	kv := makeEtcdClient(t).(*Etcd)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testWatchStats")
+	_, err := kv.Put(ctx, "testWatchStats/key", "init", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, kv.WatchStats())
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	events1, err := kv.Watch(ctx1, "testWatchStats/key", &store.WatchOptions{SkipInitialValues: true})
+	assert.NoError(t, err)
+
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+	_, err = kv.WatchTree(ctx2, "testWatchStats/dir", nil)
+	assert.NoError(t, err)
+
+	stats := kv.WatchStats()
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, "/testWatchStats/key", stats[0].Key)
+		assert.False(t, stats[0].Prefix)
+		assert.Equal(t, "/testWatchStats/dir", stats[1].Key)
+		assert.True(t, stats[1].Prefix)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = kv.Put(ctx, "testWatchStats/key", "value", nil)
+	assert.NoError(t, err)
+	pair, err := kv.Get(ctx, "testWatchStats/key")
+	assert.NoError(t, err)
+
+	select {
+	case <-events1:
+	case <-time.After(4 * time.Second):
+		t.Fatal("Timeout reached")
+	}
+
+	// Stats are updated once the event is handed over
+	time.Sleep(100 * time.Millisecond)
+	stats = kv.WatchStats()
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, uint64(1), stats[0].Delivered)
+		assert.Equal(t, pair.Index, stats[0].Revision)
+	}
+
+	// Stopping a watch removes it
+	cancel1()
+	for range events1 {
+	}
+	stats = kv.WatchStats()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, "/testWatchStats/dir", stats[0].Key)
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"math/rand"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// FaultRule describes the calls failed by WithFaultInjection
+type FaultRule struct {
+	Op  string // name of the Store method failed, e.g. "Get", all when empty
+	Key string // only fail calls on this key or directory, all when empty
+	Err error  // error returned by the failed calls
+
+	// Count is the number of calls failed, after which the rule
+	// stops matching. Unlimited when zero.
+	Count int
+
+	// Probability a matching call fails, calls always fail when
+	// zero. Draws come from a source seeded with Seed so that a
+	// run can be reproduced.
+	Probability float64
+	Seed        int64
+}
+
+type fault struct {
+	rule  FaultRule
+	rand  *rand.Rand
+	fired int
+}
+
+// match tells whether the call op on key must fail
+func (f *fault) match(op, key string) bool {
+	if f.rule.Op != "" && f.rule.Op != op {
+		return false
+	}
+	if f.rule.Key != "" && Normalize(f.rule.Key) != Normalize(key) {
+		return false
+	}
+	if f.rule.Count > 0 && f.fired >= f.rule.Count {
+		return false
+	}
+	if f.rule.Probability > 0 && f.rand.Float64() >= f.rule.Probability {
+		return false
+	}
+	f.fired++
+	return true
+}
+
+type faultStore struct {
+	Store
+
+	mu     sync.Mutex
+	faults []*fault
+}
+
+// WithFaultInjection wraps s so that calls matching one of rules
+// fail with the rule error instead of reaching the backend. Rules
+// are tried in order, the first one matching fails the call.
+// Meant for testing the resilience of callers, e.g. their retries.
+func WithFaultInjection(s Store, rules []FaultRule) Store {
+	fs := &faultStore{Store: s}
+	for _, rule := range rules {
+		fs.faults = append(fs.faults, &fault{
+			rule: rule,
+			rand: rand.New(rand.NewSource(rule.Seed)),
+		})
+	}
+	return fs
+}
+
+// inject returns the error of the first rule matching the call
+func (s *faultStore) inject(op, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.faults {
+		if f.match(op, key) {
+			return f.rule.Err
+		}
+	}
+	return nil
+}
+
+func (s *faultStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	if err := s.inject("Put", key); err != nil {
+		return nil, err
+	}
+	return s.Store.Put(ctx, key, value, options)
+}
+
+func (s *faultStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	if err := s.inject("Get", key); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, key)
+}
+
+func (s *faultStore) Delete(ctx context.Context, key string) error {
+	if err := s.inject("Delete", key); err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+func (s *faultStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := s.inject("Exists", key); err != nil {
+		return false, err
+	}
+	return s.Store.Exists(ctx, key)
+}
+
+func (s *faultStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	if err := s.inject("Update", key); err != nil {
+		return err
+	}
+	return s.Store.Update(ctx, key, value, opts)
+}
+
+func (s *faultStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	if err := s.inject("Create", key); err != nil {
+		return err
+	}
+	return s.Store.Create(ctx, key, value, opts)
+}
+
+func (s *faultStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	if err := s.inject("Watch", key); err != nil {
+		return nil, err
+	}
+	return s.Store.Watch(ctx, key, opt)
+}
+
+func (s *faultStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	if err := s.inject("WatchTree", directory); err != nil {
+		return nil, err
+	}
+	return s.Store.WatchTree(ctx, directory, opt)
+}
+
+func (s *faultStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	if err := s.inject("List", directory); err != nil {
+		return nil, err
+	}
+	return s.Store.List(ctx, directory)
+}
+
+func (s *faultStore) DeleteTree(ctx context.Context, directory string) error {
+	if err := s.inject("DeleteTree", directory); err != nil {
+		return err
+	}
+	return s.Store.DeleteTree(ctx, directory)
+}
+
+func (s *faultStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	if err := s.inject("AtomicPut", key); err != nil {
+		return err
+	}
+	return s.Store.AtomicPut(ctx, key, value, previous, options)
+}
+
+func (s *faultStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	if err := s.inject("AtomicDelete", key); err != nil {
+		return err
+	}
+	return s.Store.AtomicDelete(ctx, key, previous)
+}
+
+func (s *faultStore) Compact(ctx context.Context, rev uint64, physical bool) error {
+	if err := s.inject("Compact", ""); err != nil {
+		return err
+	}
+	return s.Store.Compact(ctx, rev, physical)
+}
+
+func (s *faultStore) CompactRevision(ctx context.Context) (uint64, error) {
+	if err := s.inject("CompactRevision", ""); err != nil {
+		return 0, err
+	}
+	return s.Store.CompactRevision(ctx)
+}
+
+func (s *faultStore) Status(ctx context.Context) error {
+	if err := s.inject("Status", ""); err != nil {
+		return err
+	}
+	return s.Store.Status(ctx)
+}
+
+func (s *faultStore) NewTxn(ctx context.Context) (Txn, error) {
+	if err := s.inject("NewTxn", ""); err != nil {
+		return nil, err
+	}
+	return s.Store.NewTxn(ctx)
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFaultInjection(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+	_, err := backend.Put(ctx, "key", "value", nil)
+	assert.NoError(t, err)
+
+	unreachable := errors.New("unreachable")
+	kv := WithFaultInjection(backend, []FaultRule{
+		{Op: "Get", Err: unreachable, Count: 2},
+		{Op: "Put", Key: "/readonly", Err: ErrCallNotSupported},
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := kv.Get(ctx, "key")
+		assert.Equal(t, unreachable, err)
+	}
+	pair, err := kv.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", pair.Value)
+
+	_, err = kv.Put(ctx, "readonly", "value", nil)
+	assert.Equal(t, ErrCallNotSupported, err)
+
+	// Other calls go through
+	_, err = kv.Put(ctx, "other", "value", nil)
+	assert.NoError(t, err)
+}
+
+func TestWithFaultInjectionProbability(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+	backend.Put(ctx, "key", "value", nil)
+
+	run := func() []bool {
+		kv := WithFaultInjection(backend, []FaultRule{
+			{Err: errors.New("flaky"), Probability: 0.5, Seed: 42},
+		})
+		var failed []bool
+		for i := 0; i < 50; i++ {
+			_, err := kv.Get(ctx, "key")
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	// The same seed fails the same calls
+	first := run()
+	assert.Equal(t, first, run())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// FoldFunc folds a watch response into the state, returning the
+// new state. The states delivered are shared with the consumer,
+// a fold must thus return a new value rather than mutate state.
+type FoldFunc func(state interface{}, e *WatchResponse) interface{}
+
+// WatchFold starts the watch described by spec and folds every
+// response into a running state, starting from initial. Rather
+// than the raw responses, the state is delivered at most once per
+// interval and only when it changed since the last delivery. The
+// pending state is delivered when the watch ends, the channel is
+// closed right after or as soon as ctx is done. An interval that
+// is not positive fails with ErrInvalidInterval.
+func WatchFold(ctx context.Context, s Store, spec WatchSpec, initial interface{}, fold FoldFunc, interval time.Duration) (<-chan interface{}, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+
+	var events <-chan *WatchResponse
+	var err error
+	if spec.Tree {
+		events, err = s.WatchTree(ctx, spec.Key, spec.Options)
+	} else {
+		events, err = s.Watch(ctx, spec.Key, spec.Options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(chan interface{})
+	go func() {
+		defer close(resp)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		state := initial
+		dirty, due := false, false
+		for {
+			// Deliver only once the interval elapsed
+			// and something was folded meanwhile
+			var out chan<- interface{}
+			if dirty && due {
+				out = resp
+			}
+
+			select {
+			case e, ok := <-events:
+				if !ok {
+					if dirty {
+						select {
+						case resp <- state:
+						case <-ctx.Done():
+						}
+					}
+					return
+				}
+				if spec.Filter == nil || spec.Filter(e) {
+					state = fold(state, e)
+					dirty = true
+				}
+			case <-ticker.C:
+				due = true
+			case out <- state:
+				dirty, due = false, false
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return resp, nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countPuts(state interface{}, e *WatchResponse) interface{} {
+	if e.Action == ActionPut {
+		return state.(int) + 1
+	}
+	return state
+}
+
+func TestWatchFold(t *testing.T) {
+	feed := make(chan *WatchResponse, 10)
+	kv := &watchStore{events: feed}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := WatchFold(ctx, kv, WatchSpec{Key: "app"}, 0, countPuts, 0)
+	assert.Equal(t, ErrInvalidInterval, err)
+
+	interval := 100 * time.Millisecond
+	states, err := WatchFold(ctx, kv, WatchSpec{Key: "app"}, 0, countPuts, interval)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		feed <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/app"}}
+	}
+	feed <- &WatchResponse{Action: ActionDelete, Node: &KVPair{Key: "/app"}}
+
+	// The folded value comes once, after the interval
+	assert.Equal(t, 5, <-states)
+	assert.True(t, time.Since(start) >= interval)
+
+	// Nothing is delivered while nothing changes
+	select {
+	case s := <-states:
+		t.Fatalf("unexpected state %v", s)
+	case <-time.After(2 * interval):
+	}
+
+	feed <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/app"}}
+	assert.Equal(t, 6, <-states)
+
+	// The pending state is flushed when the watch ends
+	feed <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/app"}}
+	close(feed)
+	assert.Equal(t, 7, <-states)
+	_, ok := <-states
+	assert.False(t, ok)
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// hashMarker separates the kept part of a hashed key from its hash
+const hashMarker = "#sha1-"
+
+// hashedValue is stored in place of the value of a hashed key
+type hashedValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type hashingStore struct {
+	Store
+	keep int
+}
+
+// WithKeyHashing wraps s so that keys longer than keep bytes, once
+// normalized, are stored under their first keep bytes followed by
+// a hash of the whole key. The original key is kept next to the
+// value so that reads, lists and watches return logical keys.
+//
+// Keys sharing their first keep bytes share a prefix in the
+// backend, directory operations on a longer directory are run on
+// that prefix and filtered.
+func WithKeyHashing(s Store, keep int) Store {
+	if keep < 1 {
+		keep = 1
+	}
+	return &hashingStore{Store: s, keep: keep}
+}
+
+func (s *hashingStore) hashed(key string) bool {
+	return len(Normalize(key)) > s.keep
+}
+
+func (s *hashingStore) key(key string) string {
+	key = Normalize(key)
+	if len(key) <= s.keep {
+		return key
+	}
+	sum := sha1.Sum([]byte(key))
+	return key[:s.keep] + hashMarker + hex.EncodeToString(sum[:])
+}
+
+func (s *hashingStore) value(key, value string) string {
+	if !s.hashed(key) {
+		return value
+	}
+	data, _ := json.Marshal(hashedValue{Key: Normalize(key), Value: value})
+	return string(data)
+}
+
+// unhashPair restores the logical key and value of a pair
+func unhashPair(pair *KVPair) *KVPair {
+	if pair == nil || !strings.Contains(pair.Key, hashMarker) {
+		return pair
+	}
+	var v hashedValue
+	if json.Unmarshal([]byte(pair.Value), &v) == nil && v.Key != "" {
+		pair.Key = v.Key
+		pair.Value = v.Value
+	}
+	return pair
+}
+
+// dir returns the backend directory to scan for directory,
+// and whether its results must be filtered
+func (s *hashingStore) dir(directory string) (string, bool) {
+	directory = Normalize(directory)
+	if len(directory) <= s.keep {
+		return directory, false
+	}
+	return directory[:s.keep], true
+}
+
+func (s *hashingStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	pair, err := s.Store.Put(ctx, s.key(key), s.value(key, value), options)
+	return unhashPair(pair), err
+}
+
+func (s *hashingStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	pair, err := s.Store.Get(ctx, s.key(key))
+	return unhashPair(pair), err
+}
+
+func (s *hashingStore) Delete(ctx context.Context, key string) error {
+	return s.Store.Delete(ctx, s.key(key))
+}
+
+func (s *hashingStore) Exists(ctx context.Context, key string) (bool, error) {
+	return s.Store.Exists(ctx, s.key(key))
+}
+
+func (s *hashingStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Update(ctx, s.key(key), s.value(key, value), opts)
+}
+
+func (s *hashingStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Create(ctx, s.key(key), s.value(key, value), opts)
+}
+
+func (s *hashingStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	return s.Store.AtomicPut(ctx, s.key(key), s.value(key, value), previous, options)
+}
+
+func (s *hashingStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	return s.Store.AtomicDelete(ctx, s.key(key), previous)
+}
+
+func (s *hashingStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	dir, filter := s.dir(directory)
+	all, err := s.Store.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []*KVPair
+	for _, pair := range all {
+		pair = unhashPair(pair)
+		if filter && !strings.HasPrefix(pair.Key, Normalize(directory)) {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if len(pairs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+func (s *hashingStore) DeleteTree(ctx context.Context, directory string) error {
+	if _, filter := s.dir(directory); !filter {
+		return s.Store.DeleteTree(ctx, directory)
+	}
+
+	// The backend prefix holds keys outside of the
+	// directory, delete the matching ones one by one
+	pairs, err := s.List(ctx, directory)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if err := s.Store.Delete(ctx, s.key(pair.Key)); err != nil && err != ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *hashingStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	events, err := s.Store.Watch(ctx, s.key(key), opt)
+	if err != nil {
+		return nil, err
+	}
+	return unhashEvents(events, ""), nil
+}
+
+func (s *hashingStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	dir, filter := s.dir(directory)
+	events, err := s.Store.WatchTree(ctx, dir, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if filter {
+		prefix = Normalize(directory)
+	}
+	return unhashEvents(events, prefix), nil
+}
+
+// unhashEvents forwards events with their logical keys, dropping
+// the ones whose key is not under prefix when it is set. Deletes
+// carry no value to restore the key from, it is taken from the
+// PreNode or else from the keys seen earlier by the watch.
+func unhashEvents(events <-chan *WatchResponse, prefix string) <-chan *WatchResponse {
+	resp := make(chan *WatchResponse)
+	go func() {
+		defer close(resp)
+		keys := make(map[string]string)
+		for e := range events {
+			unhashKeys(e, keys)
+			if prefix != "" && e.Error == nil && !watchedKey(e, prefix) {
+				continue
+			}
+			resp <- e
+		}
+	}()
+	return resp
+}
+
+// unhashKeys restores the logical keys of e, keys maps the hashed
+// keys seen so far to their logical key
+func unhashKeys(e *WatchResponse, keys map[string]string) {
+	for _, pair := range []*KVPair{e.PreNode, e.Node} {
+		if pair == nil || !strings.Contains(pair.Key, hashMarker) {
+			continue
+		}
+		hashed := pair.Key
+		if unhashPair(pair).Key != hashed {
+			keys[hashed] = pair.Key
+		} else if key, ok := keys[hashed]; ok {
+			pair.Key = key
+		}
+		if pair == e.Node && e.Action == ActionDelete {
+			delete(keys, hashed)
+		}
+	}
+}
+
+func watchedKey(e *WatchResponse, prefix string) bool {
+	for _, pair := range []*KVPair{e.Node, e.PreNode} {
+		if pair != nil && strings.HasPrefix(pair.Key, prefix) {
+			return true
+		}
+	}
+	return false
+}
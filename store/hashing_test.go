@@ -0,0 +1,92 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithKeyHashing(t *testing.T) {
+	backend := newMapStore()
+	kv := WithKeyHashing(backend, 16)
+	ctx := context.Background()
+
+	long := "files/" + strings.Repeat("very-long-path/", 20) + "file.txt"
+	_, err := kv.Put(ctx, long, "content", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "files/short", "short", nil)
+	assert.NoError(t, err)
+
+	// The backend key is bounded
+	for key := range backend.data {
+		assert.True(t, len(key) <= 16+len(hashMarker)+40, key)
+	}
+	assert.Equal(t, "short", backend.data["/files/short"].Value)
+
+	pair, err := kv.Get(ctx, long)
+	assert.NoError(t, err)
+	assert.Equal(t, Normalize(long), pair.Key)
+	assert.Equal(t, "content", pair.Value)
+
+	pairs, err := kv.List(ctx, "files")
+	assert.NoError(t, err)
+	keys := map[string]string{}
+	for _, pair := range pairs {
+		keys[pair.Key] = pair.Value
+	}
+	assert.Equal(t, map[string]string{
+		Normalize(long): "content",
+		"/files/short":  "short",
+	}, keys)
+
+	// Directories longer than the kept part are filtered
+	pairs, err = kv.List(ctx, "files/very-long-path/very-long-path")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, Normalize(long), pairs[0].Key)
+	}
+
+	_, err = kv.List(ctx, "files/very-long-path/other")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Atomic operations work on the logical pair
+	assert.NoError(t, kv.AtomicPut(ctx, long, "updated", pair, nil))
+	pair, err = kv.Get(ctx, long)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", pair.Value)
+}
+
+func TestKeyHashingWatchDelete(t *testing.T) {
+	backend := &feedStore{}
+	kv := WithKeyHashing(backend, 16).(*hashingStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := "files/very-long-path"
+	long := Normalize(dir + "/" + strings.Repeat("x", 40))
+	other := Normalize(dir + "/" + strings.Repeat("y", 40))
+	events, err := kv.WatchTree(ctx, dir, nil)
+	assert.NoError(t, err)
+
+	in := backend.input(long[:16])
+	in <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: kv.key(long), Value: kv.value(long, "v")}}
+	// The key is restored from the PreNode
+	pre := &KVPair{Key: kv.key(long), Value: kv.value(long, "v")}
+	in <- &WatchResponse{Action: ActionDelete, Node: &KVPair{Key: kv.key(long)}, PreNode: pre}
+	// Or from the put seen earlier when there is none
+	in <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: kv.key(other), Value: kv.value(other, "v")}}
+	in <- &WatchResponse{Action: ActionDelete, Node: &KVPair{Key: kv.key(other)}}
+
+	for _, key := range []string{long, long, other, other} {
+		select {
+		case e := <-events:
+			assert.Equal(t, key, e.Node.Key)
+		case <-time.After(time.Second):
+			t.Fatalf("no event for %s", key)
+		}
+	}
+}
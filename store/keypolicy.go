@@ -0,0 +1,122 @@
+package store
+
+import (
+	"golang.org/x/net/context"
+)
+
+// KeyPolicy validates a key, returning an error to reject it
+type KeyPolicy func(key string) error
+
+type keyPolicyStore struct {
+	Store
+	policy KeyPolicy
+	reads  bool
+}
+
+// WithKeyPolicy wraps s so that every key written is checked
+// against policy before reaching the backend. Rejected keys
+// fail with ErrInvalidKey. When reads is set, keys of Get,
+// Exists, List and watches are checked as well.
+//
+// Keys used in transactions and locks are not checked.
+func WithKeyPolicy(s Store, policy KeyPolicy, reads bool) Store {
+	return &keyPolicyStore{Store: s, policy: policy, reads: reads}
+}
+
+func (s *keyPolicyStore) check(key string) error {
+	if s.policy(key) != nil {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+func (s *keyPolicyStore) checkRead(key string) error {
+	if !s.reads {
+		return nil
+	}
+	return s.check(key)
+}
+
+func (s *keyPolicyStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	if err := s.check(key); err != nil {
+		return nil, err
+	}
+	return s.Store.Put(ctx, key, value, options)
+}
+
+func (s *keyPolicyStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	if err := s.checkRead(key); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, key)
+}
+
+func (s *keyPolicyStore) Delete(ctx context.Context, key string) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+func (s *keyPolicyStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := s.checkRead(key); err != nil {
+		return false, err
+	}
+	return s.Store.Exists(ctx, key)
+}
+
+func (s *keyPolicyStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.Store.Update(ctx, key, value, opts)
+}
+
+func (s *keyPolicyStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.Store.Create(ctx, key, value, opts)
+}
+
+func (s *keyPolicyStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	if err := s.checkRead(key); err != nil {
+		return nil, err
+	}
+	return s.Store.Watch(ctx, key, opt)
+}
+
+func (s *keyPolicyStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	if err := s.checkRead(directory); err != nil {
+		return nil, err
+	}
+	return s.Store.WatchTree(ctx, directory, opt)
+}
+
+func (s *keyPolicyStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	if err := s.checkRead(directory); err != nil {
+		return nil, err
+	}
+	return s.Store.List(ctx, directory)
+}
+
+func (s *keyPolicyStore) DeleteTree(ctx context.Context, directory string) error {
+	if err := s.check(directory); err != nil {
+		return err
+	}
+	return s.Store.DeleteTree(ctx, directory)
+}
+
+func (s *keyPolicyStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.Store.AtomicPut(ctx, key, value, previous, options)
+}
+
+func (s *keyPolicyStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.Store.AtomicDelete(ctx, key, previous)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordStore records the keys reaching the backend
+type recordStore struct {
+	Store
+	keys []string
+}
+
+func (s *recordStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	s.keys = append(s.keys, key)
+	return &KVPair{Key: key, Value: value}, nil
+}
+
+func (s *recordStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	s.keys = append(s.keys, key)
+	return &KVPair{Key: key}, nil
+}
+
+func (s *recordStore) DeleteTree(ctx context.Context, directory string) error {
+	s.keys = append(s.keys, directory)
+	return nil
+}
+
+func TestWithKeyPolicy(t *testing.T) {
+	policy := func(key string) error {
+		if !strings.HasPrefix(key, "app/") {
+			return errors.New("missing app prefix")
+		}
+		return nil
+	}
+
+	backend := &recordStore{}
+	kv := WithKeyPolicy(backend, policy, false)
+	ctx := context.Background()
+
+	_, err := kv.Put(ctx, "app/foo", "bar", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "foo", "bar", nil)
+	assert.Equal(t, ErrInvalidKey, err)
+	assert.Equal(t, ErrInvalidKey, kv.DeleteTree(ctx, "other"))
+
+	// Reads are not checked by default
+	_, err = kv.Get(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app/foo", "foo"}, backend.keys)
+
+	backend = &recordStore{}
+	kv = WithKeyPolicy(backend, policy, true)
+	_, err = kv.Get(ctx, "foo")
+	assert.Equal(t, ErrInvalidKey, err)
+	_, err = kv.Get(ctx, "app/foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app/foo"}, backend.keys)
+}
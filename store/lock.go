@@ -0,0 +1,57 @@
+package store
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// LockContext acquires the lock on key and ties it to ctx: the lock
+// is released as soon as ctx is done or the returned release func
+// is called, whichever happens first. Calling release more than
+// once is safe, every call returns the error of the release,
+// including when it was released by ctx.
+//
+// A lock implementing io.Closer, such as the etcd v3 one holding a
+// session, is closed once released or if it cannot be acquired.
+func LockContext(ctx context.Context, s Store, key string, opts *LockOptions) (release func() error, err error) {
+	lock := s.NewLock(key, opts)
+	if err := lock.Lock(ctx); err != nil {
+		closeLocker(lock)
+		return nil, err
+	}
+
+	var once sync.Once
+	var releaseErr error
+	done := make(chan struct{})
+	release = func() error {
+		once.Do(func() {
+			close(done)
+			// ctx may already be cancelled, unlock must still go through
+			releaseErr = lock.Unlock(context.Background())
+			if err := closeLocker(lock); releaseErr == nil {
+				releaseErr = err
+			}
+		})
+		return releaseErr
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			release()
+		case <-done:
+		}
+	}()
+
+	return release, nil
+}
+
+// closeLocker closes lock if it holds resources of its own
+func closeLocker(lock Locker) error {
+	if c, ok := lock.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
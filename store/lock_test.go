@@ -0,0 +1,142 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockStore hands out in-memory locks, one per key
+type lockStore struct {
+	Store
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+type chanLock chan struct{}
+
+func (l chanLock) Lock(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l chanLock) Unlock(ctx context.Context) error {
+	<-l
+	return nil
+}
+
+func (l chanLock) TryLock(ctx context.Context) (bool, error) {
+	select {
+	case l <- struct{}{}:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (l chanLock) Extend(ctx context.Context, ttl time.Duration) error {
+	return nil
+}
+
+func (s *lockStore) NewLock(key string, opt *LockOptions) Locker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks == nil {
+		s.locks = make(map[string]chan struct{})
+	}
+	if _, ok := s.locks[key]; !ok {
+		s.locks[key] = make(chan struct{}, 1)
+	}
+	return chanLock(s.locks[key])
+}
+
+func TestLockContext(t *testing.T) {
+	s := &lockStore{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := LockContext(ctx, s, "lock", nil)
+	assert.NoError(t, err)
+
+	// Held: a second acquirer times out
+	tctx, tcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = LockContext(tctx, s, "lock", nil)
+	tcancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Cancelling the owner's context releases the lock
+	cancel()
+	tctx, tcancel = context.WithTimeout(context.Background(), time.Second)
+	defer tcancel()
+	release, err := LockContext(tctx, s, "lock", nil)
+	assert.NoError(t, err)
+
+	// Explicit release, twice is a no-op
+	release()
+	release()
+	release, err = LockContext(tctx, s, "lock", nil)
+	assert.NoError(t, err)
+	release()
+}
+
+// closingLock is a chanLock holding a resource to close
+type closingLock struct {
+	chanLock
+	closed    int
+	unlockErr error
+}
+
+func (l *closingLock) Unlock(ctx context.Context) error {
+	l.chanLock.Unlock(ctx)
+	return l.unlockErr
+}
+
+func (l *closingLock) Close() error {
+	l.closed++
+	return nil
+}
+
+type closingStore struct {
+	Store
+	lock *closingLock
+}
+
+func (s *closingStore) NewLock(key string, opt *LockOptions) Locker {
+	return s.lock
+}
+
+func TestLockContextClose(t *testing.T) {
+	s := &closingStore{lock: &closingLock{chanLock: make(chan struct{}, 1)}}
+	ctx := context.Background()
+
+	release, err := LockContext(ctx, s, "lock", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, release())
+	assert.Equal(t, 1, s.lock.closed)
+
+	// Failing to acquire closes the lock as well
+	s.lock.chanLock <- struct{}{}
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = LockContext(tctx, s, "lock", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 2, s.lock.closed)
+	<-s.lock.chanLock
+
+	// The unlock error is returned by every call
+	s.lock.unlockErr = errors.New("unlock failed")
+	release, err = LockContext(ctx, s, "lock", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, s.lock.unlockErr, release())
+	assert.Equal(t, s.lock.unlockErr, release())
+	assert.Equal(t, 3, s.lock.closed)
+}
@@ -0,0 +1,159 @@
+package mock
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// defaultLockTTL is the TTL of a lock whose options give none
+const defaultLockTTL = 60 * time.Second
+
+// Lock is the store.Locker of the mock Store. Like an etcd
+// mutex, the holder writes its Value under the key of the lock
+// followed by its own id, and locking again a held Lock returns
+// right away.
+type Lock struct {
+	s      *Store
+	key    string
+	holder string
+	value  string
+	ttl    time.Duration
+
+	// expiry releases the lock once RenewLock is closed,
+	// expired then fails any further locking
+	expiry  *time.Timer
+	expired bool
+}
+
+// NewLock creates a lock for a given key.
+// The returned Locker is not held and must be acquired
+// with `.Lock`. The Value is optional. Closing RenewLock
+// stands for a crashed holder: the lock is released once
+// its TTL elapses.
+func (s *Store) NewLock(key string, opt *store.LockOptions) store.Locker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastLease++
+	key = store.Normalize(key)
+	l := &Lock{
+		s:      s,
+		key:    key,
+		holder: fmt.Sprintf("%s/%x", key, s.lastLease),
+		ttl:    defaultLockTTL,
+	}
+	if opt != nil {
+		l.value = opt.Value
+		if opt.TTL > 0 {
+			l.ttl = opt.TTL
+		}
+		if opt.RenewLock != nil {
+			go func() {
+				<-opt.RenewLock
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				l.expiry = time.AfterFunc(l.ttl, l.expire)
+			}()
+		}
+	}
+	return l
+}
+
+// Lock acquires the lock, blocking until it is free or
+// ctx is done
+func (l *Lock) Lock(ctx context.Context) error {
+	for {
+		l.s.mu.Lock()
+		ok, err := l.acquire()
+		free := l.s.lockFree
+		l.s.mu.Unlock()
+		if ok || err != nil {
+			return err
+		}
+
+		select {
+		case <-free:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryLock acquires the lock if it is free, without
+// blocking. It returns false if the lock is held.
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	return l.acquire()
+}
+
+// Unlock releases the lock, unlocking a lock that is
+// not held does nothing
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	if l.s.locks[l.key] == l {
+		l.release()
+	}
+	return nil
+}
+
+// Extend pushes the release of a crashed holder to ttl
+// from now, locks are not released otherwise
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	if l.s.locks[l.key] != l {
+		return store.ErrLockNotHeld
+	}
+	if l.expiry != nil && ttl > 0 {
+		l.expiry.Reset(ttl)
+	}
+	return nil
+}
+
+// acquire takes the lock if it is free, l.s.mu must be held
+func (l *Lock) acquire() (bool, error) {
+	if l.expired {
+		return false, store.ErrCannotLock
+	}
+	switch l.s.locks[l.key] {
+	case l:
+		return true, nil
+	case nil:
+		l.s.locks[l.key] = l
+		l.s.rev++
+		l.s.put(l.holder, l.value, nil)
+		return true, nil
+	}
+	return false, nil
+}
+
+// release frees the lock and wakes up the waiters,
+// l.s.mu must be held
+func (l *Lock) release() {
+	delete(l.s.locks, l.key)
+	if _, ok := l.s.data[l.holder]; ok {
+		l.s.rev++
+		l.s.delete(l.holder)
+	}
+	close(l.s.lockFree)
+	l.s.lockFree = make(chan struct{})
+}
+
+// expire releases the lock of a crashed holder
+func (l *Lock) expire() {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	l.expired = true
+	if l.s.locks[l.key] == l {
+		l.release()
+	}
+}
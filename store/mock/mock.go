@@ -0,0 +1,375 @@
+// Package mock provides an in-memory store.Store, so that code
+// depending on the store can be unit tested deterministically
+// without a cluster.
+package mock
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// ErrFutureRevision is thrown when compacting at a revision
+// the store has not reached yet
+var ErrFutureRevision = errors.New("Required revision is a future revision")
+
+// Store is an in-memory store.Store mimicking etcd v3: every
+// write bumps a single revision counter, which gives the Index
+// of the pairs and drives the atomic calls and transactions.
+// Keys written with a TTL are removed by a timer once it
+// elapses. Watches are fed from the history of the changes, so
+// that they can start at a past revision until it is compacted.
+//
+// The history is only trimmed by Compact. A Store is safe for
+// concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	rev       uint64
+	compacted uint64
+	lastLease uint64
+	data      map[string]*entry
+	history   []*change
+	watchers  map[*watcher]struct{}
+	locks     map[string]*Lock
+	lockFree  chan struct{}
+}
+
+type entry struct {
+	pair  store.KVPair
+	timer *time.Timer
+}
+
+// change is a write recorded in the history
+type change struct {
+	rev  uint64
+	resp store.WatchResponse
+}
+
+// New returns an empty Store
+func New() *Store {
+	return &Store{
+		data:     make(map[string]*entry),
+		watchers: make(map[*watcher]struct{}),
+		locks:    make(map[string]*Lock),
+		lockFree: make(chan struct{}),
+	}
+}
+
+// Put a value at "key", returns the pair written with
+// its new index
+func (s *Store) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rev++
+	pair := s.put(store.Normalize(key), value, opts)
+	return &pair, nil
+}
+
+// Get a value given its key
+func (s *Store) Get(ctx context.Context, key string) (*store.KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[store.Normalize(key)]
+	if !ok {
+		return nil, store.ErrKeyNotFound
+	}
+	pair := e.pair
+	return &pair, nil
+}
+
+// Delete the value at "key", deleting a missing key
+// is not an error
+func (s *Store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = store.Normalize(key)
+	if _, ok := s.data[key]; ok {
+		s.rev++
+		s.delete(key)
+	}
+	return nil
+}
+
+// Exists checks if the key exists inside the store
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.data[store.Normalize(key)]
+	return ok, nil
+}
+
+// Update is an alias for Put with key exist
+func (s *Store) Update(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = store.Normalize(key)
+	if _, ok := s.data[key]; !ok {
+		return store.ErrKeyNotFound
+	}
+	s.rev++
+	s.put(key, value, opts)
+	return nil
+}
+
+// Create is an alias for Put with key not exist
+func (s *Store) Create(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = store.Normalize(key)
+	if _, ok := s.data[key]; ok {
+		return store.ErrKeyExists
+	}
+	s.rev++
+	s.put(key, value, opts)
+	return nil
+}
+
+// List returns the pairs under directory sorted by key, or
+// ErrKeyNotFound if there is none
+func (s *Store) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairs := s.list(store.Normalize(directory))
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+// DeleteTree deletes the keys under directory
+func (s *Store) DeleteTree(ctx context.Context, directory string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.keys(store.Normalize(directory))
+	if len(keys) > 0 {
+		s.rev++
+	}
+	for _, key := range keys {
+		s.delete(key)
+	}
+	return nil
+}
+
+// AtomicPut puts a value at "key" if the key has not been
+// modified since previous was read, or creates it if previous
+// is nil. Like etcd the Index of previous is compared, or its
+// value when it carries no Index.
+func (s *Store) AtomicPut(ctx context.Context, key, value string, previous *store.KVPair, opts *store.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = store.Normalize(key)
+	e, ok := s.data[key]
+	if previous == nil {
+		if ok {
+			return store.ErrKeyExists
+		}
+	} else if !ok || !unchanged(&e.pair, previous) {
+		return store.ErrKeyModified
+	}
+
+	s.rev++
+	s.put(key, value, opts)
+	return nil
+}
+
+// AtomicDelete deletes "key" if it has not been modified
+// since previous was read
+func (s *Store) AtomicDelete(ctx context.Context, key string, previous *store.KVPair) error {
+	if previous == nil {
+		return store.ErrPreviousNotSpecified
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = store.Normalize(key)
+	e, ok := s.data[key]
+	if !ok || !unchanged(&e.pair, previous) {
+		return store.ErrKeyModified
+	}
+	s.rev++
+	s.delete(key)
+	return nil
+}
+
+// unchanged compares current to the pair read previously
+func unchanged(current, previous *store.KVPair) bool {
+	if previous.Index == 0 {
+		return current.Value == previous.Value
+	}
+	return current.Index == previous.Index
+}
+
+// Compact drops the history before rev, watches can no longer
+// start before it
+func (s *Store) Compact(ctx context.Context, rev uint64, physical bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rev <= s.compacted {
+		return store.ErrCompacted
+	}
+	if rev > s.rev {
+		return ErrFutureRevision
+	}
+	s.compacted = rev
+
+	i := sort.Search(len(s.history), func(i int) bool {
+		return s.history[i].rev >= rev
+	})
+	s.history = append([]*change(nil), s.history[i:]...)
+	return nil
+}
+
+// CompactRevision returns the revision of the last
+// compaction, 0 if there was none
+func (s *Store) CompactRevision(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compacted, nil
+}
+
+// Revision returns the current revision of the store
+func (s *Store) Revision() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rev
+}
+
+// Status always reports the store healthy
+func (s *Store) Status(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, the data stays available
+func (s *Store) Close() error {
+	return nil
+}
+
+// put writes key at the current revision, s.mu must be held
+func (s *Store) put(key, value string, opts *store.WriteOptions) store.KVPair {
+	pair := store.KVPair{
+		Key:         key,
+		Value:       value,
+		Index:       s.rev,
+		Version:     1,
+		CreateIndex: s.rev,
+	}
+
+	prev, ok := s.data[key]
+	if ok {
+		pair.Version = prev.pair.Version + 1
+		pair.CreateIndex = prev.pair.CreateIndex
+		if prev.timer != nil {
+			prev.timer.Stop()
+		}
+	}
+
+	e := &entry{pair: pair}
+	if opts != nil && opts.TTL > 0 {
+		s.lastLease++
+		e.pair.Lease = s.lastLease
+		e.timer = time.AfterFunc(opts.TTL, func() { s.expire(key, e) })
+	}
+	s.data[key] = e
+
+	resp := store.WatchResponse{Action: store.ActionPut, Node: &e.pair}
+	if ok {
+		resp.PreNode = &prev.pair
+	}
+	s.record(resp)
+	return e.pair
+}
+
+// delete removes key at the current revision, s.mu must be held
+func (s *Store) delete(key string) {
+	prev := s.data[key]
+	if prev.timer != nil {
+		prev.timer.Stop()
+	}
+	delete(s.data, key)
+
+	s.record(store.WatchResponse{
+		Action:  store.ActionDelete,
+		PreNode: &prev.pair,
+		Node:    &store.KVPair{Key: key, Index: s.rev},
+	})
+}
+
+// keys returns the sorted keys under prefix, s.mu must be held
+func (s *Store) keys(prefix string) []string {
+	var keys []string
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// list returns copies of the pairs under prefix sorted by
+// key, s.mu must be held
+func (s *Store) list(prefix string) []*store.KVPair {
+	var pairs []*store.KVPair
+	for _, key := range s.keys(prefix) {
+		pair := s.data[key].pair
+		pairs = append(pairs, &pair)
+	}
+	return pairs
+}
+
+// expire removes key when its TTL elapses, unless it was
+// rewritten meanwhile
+func (s *Store) expire(key string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data[key] != e {
+		return
+	}
+	s.rev++
+	s.delete(key)
+}
+
+// record appends a change to the history and hands it to the
+// matching watchers, s.mu must be held
+func (s *Store) record(resp store.WatchResponse) {
+	c := &change{rev: s.rev, resp: resp}
+	s.history = append(s.history, c)
+	for w := range s.watchers {
+		if w.match(resp.Node.Key) {
+			w.push(c.response())
+		}
+	}
+}
+
+// response returns a copy of the recorded response, so that
+// consumers cannot alter the history
+func (c *change) response() *store.WatchResponse {
+	resp := c.resp
+	if resp.Node != nil {
+		node := *resp.Node
+		resp.Node = &node
+	}
+	if resp.PreNode != nil {
+		pre := *resp.PreNode
+		resp.PreNode = &pre
+	}
+	return &resp
+}
@@ -0,0 +1,298 @@
+package mock
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/YuleiXiao/kvstore/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockStore(t *testing.T) {
+	kv := New()
+
+	testutils.RunCleanup(t, kv)
+	testutils.RunTestCommon(t, kv)
+	testutils.RunTestAtomic(t, kv)
+	testutils.RunTestWatch(t, kv)
+	testutils.RunTestLockV3(t, kv)
+}
+
+func TestPutTTL(t *testing.T) {
+	kv := New()
+	ctx := context.Background()
+
+	pair, err := kv.Put(ctx, "testPutTTL", "v", &store.WriteOptions{TTL: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.NotZero(t, pair.Lease)
+
+	// Rewriting the key without TTL keeps it
+	_, err = kv.Put(ctx, "testPutTTL/kept", "v", &store.WriteOptions{TTL: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testPutTTL/kept", "v", nil)
+	assert.NoError(t, err)
+
+	events, err := kv.Watch(ctx, "testPutTTL", &store.WatchOptions{SkipInitialValues: true})
+	assert.NoError(t, err)
+	select {
+	case e := <-events:
+		assert.Equal(t, store.ActionDelete, e.Action)
+		assert.Equal(t, "v", e.PreNode.Value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("key did not expire")
+	}
+
+	_, err = kv.Get(ctx, "testPutTTL")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+	_, err = kv.Get(ctx, "testPutTTL/kept")
+	assert.NoError(t, err)
+}
+
+func TestRevisions(t *testing.T) {
+	kv := New()
+	ctx := context.Background()
+
+	first, err := kv.Put(ctx, "testRevisions", "v1", nil)
+	assert.NoError(t, err)
+	second, err := kv.Put(ctx, "testRevisions", "v2", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first.Index+1, second.Index)
+	assert.Equal(t, first.Index, second.CreateIndex)
+	assert.Equal(t, uint64(2), second.Version)
+	assert.Equal(t, second.Index, kv.Revision())
+
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicPut(ctx, "testRevisions", "v3", first, nil))
+	assert.Equal(t, store.ErrKeyModified, kv.AtomicDelete(ctx, "testRevisions", first))
+	assert.NoError(t, kv.AtomicDelete(ctx, "testRevisions", second))
+}
+
+func TestWatchIndex(t *testing.T) {
+	kv := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var pairs []*store.KVPair
+	for _, value := range []string{"v1", "v2", "v3"} {
+		pair, err := kv.Put(ctx, "testWatchIndex/key", value, nil)
+		assert.NoError(t, err)
+		pairs = append(pairs, pair)
+	}
+
+	// The history is replayed from the given revision
+	events, err := kv.WatchTree(ctx, "testWatchIndex", &store.WatchOptions{Index: pairs[1].Index})
+	assert.NoError(t, err)
+	for _, value := range []string{"v2", "v3"} {
+		e := <-events
+		assert.NoError(t, e.Error)
+		assert.Equal(t, value, e.Node.Value)
+	}
+
+	// Until it is compacted
+	assert.NoError(t, kv.Compact(ctx, pairs[2].Index, false))
+	rev, err := kv.CompactRevision(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, pairs[2].Index, rev)
+	assert.Equal(t, store.ErrCompacted, kv.Compact(ctx, pairs[2].Index, false))
+
+	events, err = kv.WatchTree(ctx, "testWatchIndex", &store.WatchOptions{Index: pairs[1].Index})
+	assert.NoError(t, err)
+	e := <-events
+	assert.Equal(t, store.ErrCompacted, e.Error)
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestWatchInitialValues(t *testing.T) {
+	kv := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kv.Put(ctx, "testWatchInitialValues/a", "a", nil)
+	kv.Put(ctx, "testWatchInitialValues/b", "b", nil)
+
+	_, err := kv.WatchTree(ctx, "testWatchInitialValues", &store.WatchOptions{
+		MaxInitialKeys: 1,
+	})
+	assert.Equal(t, store.ErrInitialSnapshotTooLarge, err)
+
+	events, err := kv.WatchTree(ctx, "testWatchInitialValues", nil)
+	assert.NoError(t, err)
+	kv.Put(ctx, "testWatchInitialValues/c", "c", nil)
+
+	for _, value := range []string{"a", "b", "c"} {
+		e := <-events
+		assert.Equal(t, store.ActionPut, e.Action)
+		assert.Equal(t, value, e.Node.Value)
+	}
+
+	// Unless only the changes are asked for
+	events, err = kv.WatchTree(ctx, "testWatchInitialValues", &store.WatchOptions{SkipInitialValues: true})
+	assert.NoError(t, err)
+	kv.Put(ctx, "testWatchInitialValues/d", "d", nil)
+	e := <-events
+	assert.Equal(t, "d", e.Node.Value)
+}
+
+func TestWatchFilter(t *testing.T) {
+	kv := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := kv.WatchTree(ctx, "testWatchFilter", &store.WatchOptions{FilterPut: true})
+	assert.NoError(t, err)
+	kv.Put(ctx, "testWatchFilter/a", "a", nil)
+	kv.Put(ctx, "testWatchFilter/b", "b", nil)
+	assert.NoError(t, kv.Delete(ctx, "testWatchFilter/b"))
+
+	e := <-events
+	assert.Equal(t, store.ActionDelete, e.Action)
+	assert.Equal(t, "/testWatchFilter/b", e.Node.Key)
+}
+
+func TestWatchSeq(t *testing.T) {
+	kv := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Responses dropped past the watcher leave a gap
+	ws, err := store.NewWatchSet(kv, []store.WatchSpec{{
+		Key:  "testWatchSeq",
+		Tree: true,
+		Filter: func(e *store.WatchResponse) bool {
+			return e.Node.Key != "/testWatchSeq/b"
+		},
+	}})
+	assert.NoError(t, err)
+	defer ws.Close()
+	events, err := kv.WatchTree(ctx, "testWatchSeq", nil)
+	assert.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := kv.Put(ctx, "testWatchSeq/"+key, key, nil)
+		assert.NoError(t, err)
+	}
+
+	// Contiguous when nothing is dropped
+	for i := 1; i <= 3; i++ {
+		e := <-events
+		assert.Equal(t, uint64(i), e.Seq)
+	}
+
+	var seqs []uint64
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-ws.Events():
+			seqs = append(seqs, e.Seq)
+		case <-time.After(time.Second):
+			t.Fatal("Timeout reached")
+		}
+	}
+	assert.Equal(t, []uint64{1, 3}, seqs)
+}
+
+func TestTxn(t *testing.T) {
+	kv := New()
+	ctx := context.Background()
+
+	pair, err := kv.Put(ctx, "/testTxn/a", "a", nil)
+	assert.NoError(t, err)
+
+	txn, err := kv.NewTxn(ctx)
+	assert.NoError(t, err)
+	txn.Begin()
+	txn.IfModifyRevision("/testTxn/a", "=", pair.Index)
+	txn.IfCreateRevision("/testTxn/b", "=", 0)
+	txn.Put("/testTxn/b", "b", nil)
+	txn.Put("/testTxn/c", "c", nil)
+	txn.List("/testTxn/")
+	txn.Else()
+	txn.Get("/testTxn/a")
+
+	resp, err := txn.Commit()
+	assert.NoError(t, err)
+	assert.True(t, resp.CompareSuccess)
+	assert.Equal(t, pair.Index+1, resp.Revision)
+	if assert.Len(t, resp.Responses, 3) {
+		assert.Len(t, resp.Responses[2].Pairs, 3)
+	}
+
+	// b now exists, the comparison fails
+	resp, err = txn.Commit()
+	assert.NoError(t, err)
+	assert.False(t, resp.CompareSuccess)
+	if assert.Len(t, resp.Responses, 1) && assert.Len(t, resp.Responses[0].Pairs, 1) {
+		assert.Equal(t, "a", resp.Responses[0].Pairs[0].Value)
+	}
+
+	// A value comparison on a missing key fails
+	txn.Begin()
+	txn.IfValue("/testTxn/missing", "!=", "x")
+	txn.DeleteTree("/testTxn/")
+	resp, err = txn.Commit()
+	assert.NoError(t, err)
+	assert.False(t, resp.CompareSuccess)
+
+	txn.Begin()
+	txn.Put("/testTxn/d", "d", nil)
+	txn.Put("/testTxn/d", "d", nil)
+	_, err = txn.Commit()
+	assert.Equal(t, store.ErrDuplicateKey, err)
+}
+
+func TestTryLock(t *testing.T) {
+	kv := New()
+	ctx := context.Background()
+
+	lock := kv.NewLock("testTryLock", &store.LockOptions{Value: "node-1"})
+	ok, err := lock.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// The holder can be read under the lock key
+	pairs, err := kv.List(ctx, "testTryLock/")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, "node-1", pairs[0].Value)
+	}
+
+	other := kv.NewLock("testTryLock", nil)
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, store.ErrLockNotHeld, other.Extend(ctx, time.Second))
+
+	assert.NoError(t, lock.Unlock(ctx))
+	_, err = kv.List(ctx, "testTryLock/")
+	assert.Equal(t, store.ErrKeyNotFound, err)
+
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestLockExpiresAfterCrash(t *testing.T) {
+	kv := New()
+	ctx := context.Background()
+
+	renew := make(chan struct{})
+	lock := kv.NewLock("testLockExpiresAfterCrash", &store.LockOptions{
+		TTL:       200 * time.Millisecond,
+		RenewLock: renew,
+	})
+	assert.NoError(t, lock.Lock(ctx))
+	close(renew)
+
+	tctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	other := kv.NewLock("testLockExpiresAfterCrash", nil)
+	assert.NoError(t, other.Lock(tctx))
+
+	// The crashed holder cannot lock anymore
+	assert.Equal(t, store.ErrCannotLock, lock.Lock(ctx))
+	assert.NoError(t, other.Unlock(ctx))
+}
@@ -0,0 +1,206 @@
+package mock
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// NewTxn creates a transaction Txn. As with etcd, the keys of
+// a transaction are used as given, without normalization, and
+// all its writes share a single revision.
+func (s *Store) NewTxn(ctx context.Context) (store.Txn, error) {
+	return &txn{s: s}, nil
+}
+
+type cmp struct {
+	key      string
+	target   string // "value", "version", "create" or "mod"
+	operator string
+	value    string
+	number   uint64
+}
+
+type op struct {
+	kind  string // "put", "get", "list", "delete" or "deleteTree"
+	key   string
+	value string
+	opts  *store.WriteOptions
+}
+
+type txn struct {
+	s *Store
+
+	cmps     []cmp
+	success  []op
+	fail     []op
+	isFailOp bool
+}
+
+func (t *txn) Begin() {
+	t.cmps = nil
+	t.success = nil
+	t.fail = nil
+	t.isFailOp = false
+}
+
+func (t *txn) Commit() (*store.TxnResponse, error) {
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &store.TxnResponse{CompareSuccess: true}
+	for _, c := range t.cmps {
+		if !t.compare(c) {
+			resp.CompareSuccess = false
+			break
+		}
+	}
+	ops := t.success
+	if !resp.CompareSuccess {
+		ops = t.fail
+	}
+
+	// etcd refuses a transaction writing a key twice
+	puts := make(map[string]bool)
+	for _, o := range ops {
+		if o.kind == "put" {
+			if puts[o.key] {
+				return nil, store.ErrDuplicateKey
+			}
+			puts[o.key] = true
+		}
+	}
+
+	// The revision is bumped once, by the first change
+	rev := s.rev
+	bump := func() {
+		if s.rev == rev {
+			s.rev++
+		}
+	}
+
+	for _, o := range ops {
+		opResp := &store.OpResponse{}
+		switch o.kind {
+		case "put":
+			bump()
+			s.put(o.key, o.value, o.opts)
+		case "get":
+			if e, ok := s.data[o.key]; ok {
+				pair := e.pair
+				opResp.Pairs = append(opResp.Pairs, &pair)
+			}
+		case "list":
+			opResp.Pairs = s.list(o.key)
+		case "delete":
+			if _, ok := s.data[o.key]; ok {
+				bump()
+				s.delete(o.key)
+			}
+		case "deleteTree":
+			for _, key := range s.keys(o.key) {
+				bump()
+				s.delete(key)
+			}
+		}
+		resp.Responses = append(resp.Responses, opResp)
+	}
+
+	resp.Revision = s.rev
+	return resp, nil
+}
+
+// compare evaluates c like etcd: a missing key has zero
+// revisions and version, and fails any value comparison
+func (t *txn) compare(c cmp) bool {
+	e, ok := t.s.data[c.key]
+	if c.target == "value" {
+		return ok && compare(strings.Compare(e.pair.Value, c.value), c.operator)
+	}
+
+	var n uint64
+	if ok {
+		switch c.target {
+		case "version":
+			n = e.pair.Version
+		case "create":
+			n = e.pair.CreateIndex
+		case "mod":
+			n = e.pair.Index
+		}
+	}
+	switch {
+	case n < c.number:
+		return compare(-1, c.operator)
+	case n > c.number:
+		return compare(1, c.operator)
+	}
+	return compare(0, c.operator)
+}
+
+// compare tells whether the result of a comparison
+// satisfies operator
+func compare(result int, operator string) bool {
+	switch operator {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	}
+	return false
+}
+
+func (t *txn) IfValue(key, operator, value string) {
+	t.cmps = append(t.cmps, cmp{key: key, target: "value", operator: operator, value: value})
+}
+
+func (t *txn) IfVersion(key, operator string, version uint64) {
+	t.cmps = append(t.cmps, cmp{key: key, target: "version", operator: operator, number: version})
+}
+
+func (t *txn) IfCreateRevision(key, operator string, revision uint64) {
+	t.cmps = append(t.cmps, cmp{key: key, target: "create", operator: operator, number: revision})
+}
+
+func (t *txn) IfModifyRevision(key, operator string, revision uint64) {
+	t.cmps = append(t.cmps, cmp{key: key, target: "mod", operator: operator, number: revision})
+}
+
+func (t *txn) Put(key, value string, options *store.WriteOptions) {
+	t.add(op{kind: "put", key: key, value: value, opts: options})
+}
+
+func (t *txn) Get(key string) {
+	t.add(op{kind: "get", key: key})
+}
+
+func (t *txn) List(dir string) {
+	t.add(op{kind: "list", key: dir})
+}
+
+func (t *txn) Delete(key string) {
+	t.add(op{kind: "delete", key: key})
+}
+
+func (t *txn) DeleteTree(key string) {
+	t.add(op{kind: "deleteTree", key: key})
+}
+
+func (t *txn) Else() {
+	t.isFailOp = true
+}
+
+func (t *txn) add(o op) {
+	if t.isFailOp {
+		t.fail = append(t.fail, o)
+		return
+	}
+	t.success = append(t.success, o)
+}
@@ -0,0 +1,163 @@
+package mock
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// watcher queues the responses of a watch, writers never block
+// on a slow consumer
+type watcher struct {
+	key    string
+	prefix bool
+	opt    *store.WatchOptions
+
+	mu    sync.Mutex
+	queue []*store.WatchResponse
+	ready chan struct{}
+}
+
+func (w *watcher) match(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+func (w *watcher) push(resp *store.WatchResponse) {
+	if resp.Error == nil && w.opt.Filters(resp.Action) {
+		return
+	}
+
+	w.mu.Lock()
+	w.queue = append(w.queue, resp)
+	w.mu.Unlock()
+
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) pop() []*store.WatchResponse {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queue := w.queue
+	w.queue = nil
+	return queue
+}
+
+// Watch for changes on "key". The channel is closed once ctx is
+// done, after a last response carrying ErrWatchFail.
+//
+// Index starts the watch at a past revision, the watch fails
+// right away with ErrCompacted if that revision is compacted.
+// The initial values, MaxInitialKeys and the filters behave as
+// with etcd, other options are irrelevant since the watch never
+// breaks.
+func (s *Store) Watch(ctx context.Context, key string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	return s.watch(ctx, key, false, opt)
+}
+
+// WatchTree watches for changes on the keys under directory,
+// see Watch
+func (s *Store) WatchTree(ctx context.Context, directory string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	return s.watch(ctx, directory, true, opt)
+}
+
+func (s *Store) watch(ctx context.Context, key string, prefix bool, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	w := &watcher{
+		key:    store.Normalize(key),
+		prefix: prefix,
+		opt:    opt,
+		ready:  make(chan struct{}, 1),
+	}
+
+	s.mu.Lock()
+	switch {
+	case opt != nil && opt.Index > 0:
+		if opt.Index < s.compacted {
+			w.push(&store.WatchResponse{Error: store.ErrCompacted})
+			break
+		}
+		for _, c := range s.history {
+			if c.rev >= opt.Index && w.match(c.resp.Node.Key) {
+				w.push(c.response())
+			}
+		}
+	case opt == nil || !opt.SkipInitialValues:
+		var pairs []*store.KVPair
+		if prefix {
+			pairs = s.list(w.key)
+		} else if e, ok := s.data[w.key]; ok {
+			pair := e.pair
+			pairs = append(pairs, &pair)
+		}
+		if opt != nil && opt.MaxInitialKeys > 0 && !opt.PagedInitialValues && len(pairs) > opt.MaxInitialKeys {
+			s.mu.Unlock()
+			return nil, store.ErrInitialSnapshotTooLarge
+		}
+		for _, pair := range pairs {
+			w.push(&store.WatchResponse{Action: store.ActionPut, Node: pair})
+		}
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	resp := make(chan *store.WatchResponse)
+	go s.deliver(ctx, w, resp)
+	return resp, nil
+}
+
+// deliver hands the responses queued by w over to resp
+func (s *Store) deliver(ctx context.Context, w *watcher, resp chan<- *store.WatchResponse) {
+	defer close(resp)
+
+	var seq uint64
+	send := func(r *store.WatchResponse) bool {
+		seq++
+		r.Seq = seq
+		r.ReceivedAt = time.Now()
+		select {
+		case resp <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		for _, r := range w.pop() {
+			if !send(r) {
+				s.unwatch(w)
+				resp <- &store.WatchResponse{Error: store.ErrWatchFail, Seq: seq}
+				return
+			}
+			if r.Error != nil {
+				s.unwatch(w)
+				return
+			}
+		}
+
+		select {
+		case <-w.ready:
+		case <-ctx.Done():
+			s.unwatch(w)
+			seq++
+			resp <- &store.WatchResponse{Error: store.ErrWatchFail, Seq: seq}
+			return
+		}
+	}
+}
+
+func (s *Store) unwatch(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers, w)
+}
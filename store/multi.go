@@ -0,0 +1,148 @@
+package store
+
+import (
+	"golang.org/x/net/context"
+)
+
+// TxnOp is a write of AtomicMulti, a put of Value at Key or
+// its delete, optionally guarded by a compare on Key
+type TxnOp struct {
+	Key     string
+	Value   string
+	Delete  bool // delete Key instead of writing Value
+	Options *WriteOptions
+
+	// Previous, when set, requires Key to be unchanged since
+	// Previous was read. Like AtomicPut its Index is compared,
+	// or its Value when it carries no Index.
+	Previous *KVPair
+
+	// Create requires Key not to exist, ignored when
+	// Previous is set
+	Create bool
+}
+
+// AtomicMulti applies ops all at once, in a single transaction,
+// or none of them if any compare fails, in which case it
+// returns ErrKeyModified. A key may only be written once. More
+// ops than the backend accepts in a transaction, 128 by default
+// with etcd, fail with ErrTooManyOperations, see ChunkedMulti.
+//
+// On backends without transactions the compares are checked
+// first and the ops are then applied one by one, each with its
+// own single key atomic call: an op failing there leaves the
+// previous ones applied.
+func AtomicMulti(ctx context.Context, s Store, ops []TxnOp) error {
+	txn, err := s.NewTxn(ctx)
+	if err == ErrCallNotSupported {
+		return atomicMultiFallback(ctx, s, ops)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Transactions use the keys as given
+	txn.Begin()
+	for _, op := range ops {
+		key := Normalize(op.Key)
+		switch {
+		case op.Previous != nil && op.Previous.Index != 0:
+			txn.IfModifyRevision(key, "=", op.Previous.Index)
+		case op.Previous != nil:
+			txn.IfValue(key, "=", op.Previous.Value)
+		case op.Create:
+			txn.IfCreateRevision(key, "=", 0)
+		}
+	}
+	for _, op := range ops {
+		if op.Delete {
+			txn.Delete(Normalize(op.Key))
+		} else {
+			txn.Put(Normalize(op.Key), op.Value, op.Options)
+		}
+	}
+
+	resp, err := txn.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.CompareSuccess {
+		return ErrKeyModified
+	}
+	return nil
+}
+
+// defaultChunkSize is the default limit of operations in a
+// transaction of etcd, its --max-txn-ops
+const defaultChunkSize = 128
+
+// ChunkedMulti applies ops like AtomicMulti, in transactions of
+// at most chunkSize ops, defaultChunkSize when not positive, run
+// one after the other. Each chunk is atomic but the whole is
+// not: a chunk failing, e.g. on a compare, leaves the previous
+// chunks applied and the next ones not.
+func ChunkedMulti(ctx context.Context, s Store, ops []TxnOp, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	for start := 0; start < len(ops); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if err := AtomicMulti(ctx, s, ops[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atomicMultiFallback applies ops with the single key calls
+// of s, once all the compares hold
+func atomicMultiFallback(ctx context.Context, s Store, ops []TxnOp) error {
+	for _, op := range ops {
+		if op.Previous == nil && !op.Create {
+			continue
+		}
+
+		current, err := s.Get(ctx, op.Key)
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		if op.Previous == nil {
+			if current != nil {
+				return ErrKeyModified
+			}
+			continue
+		}
+		if current == nil {
+			return ErrKeyModified
+		}
+		if op.Previous.Index == 0 && current.Value != op.Previous.Value ||
+			op.Previous.Index != 0 && current.Index != op.Previous.Index {
+			return ErrKeyModified
+		}
+	}
+
+	for _, op := range ops {
+		var err error
+		switch {
+		case op.Delete && op.Previous != nil:
+			err = s.AtomicDelete(ctx, op.Key, op.Previous)
+		case op.Delete:
+			err = s.Delete(ctx, op.Key)
+		case op.Previous != nil || op.Create:
+			err = s.AtomicPut(ctx, op.Key, op.Value, op.Previous, op.Options)
+		default:
+			_, err = s.Put(ctx, op.Key, op.Value, op.Options)
+		}
+
+		if err == ErrKeyExists || err == ErrKeyNotFound {
+			err = ErrKeyModified
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
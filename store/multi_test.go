@@ -0,0 +1,70 @@
+package store
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicMultiFallback(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	job, _ := kv.Put(ctx, "queue/pending/job", "payload", nil)
+
+	// Move the job from one queue to the other
+	err := AtomicMulti(ctx, kv, []TxnOp{
+		{Key: "queue/pending/job", Delete: true, Previous: job},
+		{Key: "queue/running/job", Value: job.Value, Create: true},
+	})
+	assert.NoError(t, err)
+
+	_, err = kv.Get(ctx, "queue/pending/job")
+	assert.Equal(t, ErrKeyNotFound, err)
+	pair, err := kv.Get(ctx, "queue/running/job")
+	assert.NoError(t, err)
+	assert.Equal(t, "payload", pair.Value)
+
+	// A failed compare writes nothing
+	err = AtomicMulti(ctx, kv, []TxnOp{
+		{Key: "queue/done/job", Value: "payload"},
+		{Key: "queue/running/job", Delete: true, Previous: job},
+	})
+	assert.Equal(t, ErrKeyModified, err)
+	_, err = kv.Get(ctx, "queue/done/job")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = AtomicMulti(ctx, kv, []TxnOp{{Key: "queue/running/job", Value: "again", Create: true}})
+	assert.Equal(t, ErrKeyModified, err)
+}
+
+func TestChunkedMulti(t *testing.T) {
+	kv := newMapStore()
+	ctx := context.Background()
+
+	taken, _ := kv.Put(ctx, "c", "taken", nil)
+	ops := []TxnOp{
+		{Key: "a", Value: "a", Create: true},
+		{Key: "b", Value: "b", Create: true},
+		{Key: "c", Value: "c", Create: true},
+		{Key: "d", Value: "d", Create: true},
+	}
+
+	// The chunk holding the failed compare is not applied,
+	// the previous one is
+	assert.Equal(t, ErrKeyModified, ChunkedMulti(ctx, kv, ops, 2))
+	_, err := kv.Get(ctx, "b")
+	assert.NoError(t, err)
+	_, err = kv.Get(ctx, "d")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, kv.Delete(ctx, "c"))
+	assert.NoError(t, kv.Delete(ctx, "a"))
+	assert.NoError(t, kv.Delete(ctx, "b"))
+	assert.NoError(t, ChunkedMulti(ctx, kv, ops, 3))
+	pair, err := kv.Get(ctx, "c")
+	assert.NoError(t, err)
+	assert.NotEqual(t, taken.Value, pair.Value)
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+type namespaceStore struct {
+	Store
+	prefix string
+}
+
+// WithNamespace wraps s so that every key, including the keys of
+// locks and transactions, is placed under prefix. Keys returned
+// have the prefix stripped: several tenants can share a backend
+// with the same logical keys and lock names without seeing nor
+// contending with each other.
+func WithNamespace(s Store, prefix string) Store {
+	prefix = Normalize(prefix)
+	if prefix == "/" {
+		prefix = ""
+	}
+	return &namespaceStore{Store: s, prefix: prefix}
+}
+
+func (s *namespaceStore) key(key string) string {
+	return s.prefix + Normalize(key)
+}
+
+// strip removes the namespace prefix from the key of pair
+func (s *namespaceStore) strip(pair *KVPair) *KVPair {
+	if pair != nil && strings.HasPrefix(pair.Key, s.prefix) {
+		pair.Key = Normalize(pair.Key[len(s.prefix):])
+	}
+	return pair
+}
+
+func (s *namespaceStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	pair, err := s.Store.Put(ctx, s.key(key), value, options)
+	return s.strip(pair), err
+}
+
+func (s *namespaceStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	pair, err := s.Store.Get(ctx, s.key(key))
+	return s.strip(pair), err
+}
+
+func (s *namespaceStore) Delete(ctx context.Context, key string) error {
+	return s.Store.Delete(ctx, s.key(key))
+}
+
+func (s *namespaceStore) Exists(ctx context.Context, key string) (bool, error) {
+	return s.Store.Exists(ctx, s.key(key))
+}
+
+func (s *namespaceStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Update(ctx, s.key(key), value, opts)
+}
+
+func (s *namespaceStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Create(ctx, s.key(key), value, opts)
+}
+
+func (s *namespaceStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	events, err := s.Store.Watch(ctx, s.key(key), opt)
+	if err != nil {
+		return nil, err
+	}
+	return s.stripEvents(events), nil
+}
+
+func (s *namespaceStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	events, err := s.Store.WatchTree(ctx, s.key(directory), opt)
+	if err != nil {
+		return nil, err
+	}
+	return s.stripEvents(events), nil
+}
+
+func (s *namespaceStore) stripEvents(events <-chan *WatchResponse) <-chan *WatchResponse {
+	resp := make(chan *WatchResponse)
+	go func() {
+		defer close(resp)
+		for e := range events {
+			s.strip(e.PreNode)
+			s.strip(e.Node)
+			resp <- e
+		}
+	}()
+	return resp
+}
+
+func (s *namespaceStore) NewLock(key string, opt *LockOptions) Locker {
+	return s.Store.NewLock(s.key(key), opt)
+}
+
+func (s *namespaceStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	pairs, err := s.Store.List(ctx, s.key(directory))
+	for _, pair := range pairs {
+		s.strip(pair)
+	}
+	return pairs, err
+}
+
+func (s *namespaceStore) DeleteTree(ctx context.Context, directory string) error {
+	return s.Store.DeleteTree(ctx, s.key(directory))
+}
+
+func (s *namespaceStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	return s.Store.AtomicPut(ctx, s.key(key), value, previous, options)
+}
+
+func (s *namespaceStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	return s.Store.AtomicDelete(ctx, s.key(key), previous)
+}
+
+func (s *namespaceStore) NewTxn(ctx context.Context) (Txn, error) {
+	txn, err := s.Store.NewTxn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceTxn{Txn: txn, s: s}, nil
+}
+
+// namespaceTxn places the keys of a transaction under
+// the namespace of its store
+type namespaceTxn struct {
+	Txn
+	s *namespaceStore
+}
+
+func (t *namespaceTxn) Commit() (*TxnResponse, error) {
+	resp, err := t.Txn.Commit()
+	if resp != nil {
+		for _, r := range resp.Responses {
+			for _, pair := range r.Pairs {
+				t.s.strip(pair)
+			}
+		}
+	}
+	return resp, err
+}
+
+func (t *namespaceTxn) IfValue(key, operator, value string) {
+	t.Txn.IfValue(t.s.key(key), operator, value)
+}
+
+func (t *namespaceTxn) IfVersion(key, operator string, version uint64) {
+	t.Txn.IfVersion(t.s.key(key), operator, version)
+}
+
+func (t *namespaceTxn) IfCreateRevision(key, operator string, revision uint64) {
+	t.Txn.IfCreateRevision(t.s.key(key), operator, revision)
+}
+
+func (t *namespaceTxn) IfModifyRevision(key, operator string, revision uint64) {
+	t.Txn.IfModifyRevision(t.s.key(key), operator, revision)
+}
+
+func (t *namespaceTxn) Put(key, value string, options *WriteOptions) {
+	t.Txn.Put(t.s.key(key), value, options)
+}
+
+func (t *namespaceTxn) Get(key string) {
+	t.Txn.Get(t.s.key(key))
+}
+
+func (t *namespaceTxn) List(dir string) {
+	t.Txn.List(t.s.key(dir))
+}
+
+func (t *namespaceTxn) Delete(key string) {
+	t.Txn.Delete(t.s.key(key))
+}
+
+func (t *namespaceTxn) DeleteTree(key string) {
+	t.Txn.DeleteTree(t.s.key(key))
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNamespace(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+
+	a := WithNamespace(backend, "tenants/a")
+	b := WithNamespace(backend, "tenants/b")
+
+	pair, err := a.Put(ctx, "config", "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/config", pair.Key)
+	_, err = b.Put(ctx, "config", "b", nil)
+	assert.NoError(t, err)
+
+	pair, err = a.Get(ctx, "config")
+	assert.NoError(t, err)
+	assert.Equal(t, "/config", pair.Key)
+	assert.Equal(t, "a", pair.Value)
+
+	pair, err = backend.Get(ctx, "tenants/b/config")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", pair.Value)
+}
+
+func TestWithNamespaceLock(t *testing.T) {
+	backend := &lockStore{Store: newMapStore()}
+	ctx := context.Background()
+
+	a := WithNamespace(backend, "tenants/a")
+	b := WithNamespace(backend, "tenants/b")
+
+	// Both tenants hold the same logical lock at once
+	la := a.NewLock("resource", nil)
+	lb := b.NewLock("resource", nil)
+	assert.NoError(t, la.Lock(ctx))
+
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, lb.Lock(tctx))
+
+	// Within a tenant the lock still excludes
+	tctx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, a.NewLock("resource", nil).Lock(tctx))
+
+	assert.Contains(t, backend.locks, "/tenants/a/resource")
+	assert.Contains(t, backend.locks, "/tenants/b/resource")
+}
@@ -0,0 +1,817 @@
+// Package redis implements store.Store over a single Redis server.
+//
+// Every key is a Redis hash holding the value along with its
+// revisions, taken from a global counter incremented by every
+// write. Writes are Lua scripts, so that the conditional ones
+// (Create, Update, AtomicPut, AtomicDelete) check and write in a
+// single atomic step, and publish the change for the watchers.
+//
+// The consistency is weaker than with etcd:
+//
+//   - writes acknowledged by a master may be lost on failover,
+//     replication is asynchronous
+//   - List and DeleteTree scan the keyspace and are not atomic,
+//     keys written meanwhile may be missed or seen half way
+//   - watches only see the changes published while they are
+//     subscribed, they cannot start at a past revision nor be
+//     resumed. Expired keys are reported from keyspace
+//     notifications, which require notify-keyspace-events to
+//     include "Ex" on the server
+//   - locks expire after their TTL unless renewed, a holder
+//     paused for longer than the TTL may lose its lock without
+//     noticing
+//
+// Transactions and compaction are not supported.
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore"
+	"github.com/YuleiXiao/kvstore/store"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const (
+	// revisionKey holds the global revision counter, it cannot
+	// clash with the normalized keys which start with a slash
+	revisionKey = "kvstore:revision"
+
+	// eventChannel is where the writes are published
+	eventChannel = "kvstore:events"
+
+	// expiredChannel receives the keys expired by the server
+	expiredChannel = "__keyevent@*__:expired"
+
+	defaultTimeout = 10 * time.Second
+	defaultLockTTL = 60 * time.Second
+	lockRetry      = 100 * time.Millisecond
+	scanCount      = 100
+)
+
+// Redis is the receiver type for the
+// Store interface
+type Redis struct {
+	pool *redigo.Pool
+
+	// closed ends the watches and lock renewals
+	// once the store is closed
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type redisLock struct {
+	s     *Redis
+	key   string
+	value string
+	ttl   time.Duration
+	token string
+	renew chan struct{}
+
+	// stop ends the renewal of a held lock
+	stop chan struct{}
+}
+
+// Register registers redis to kvstore
+func Register() {
+	kvstore.AddStore(store.REDIS, New)
+}
+
+// New creates a new Redis client given a list of endpoints,
+// only the first one is used, and an optional tls config
+func New(endpoints []string, options *store.Config) (store.Store, error) {
+	if len(endpoints) == 0 {
+		return nil, store.ErrNotReachable
+	}
+
+	timeout := defaultTimeout
+	var dialOpts []redigo.DialOption
+	if options != nil {
+		if options.ConnectionTimeout != 0 {
+			timeout = options.ConnectionTimeout
+		}
+		tlsConfig, err := store.TLSConfig(options)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			dialOpts = append(dialOpts, redigo.DialUseTLS(true), redigo.DialTLSConfig(tlsConfig))
+		}
+		if options.Password != "" {
+			dialOpts = append(dialOpts, redigo.DialUsername(options.Username), redigo.DialPassword(options.Password))
+		}
+	}
+	dialOpts = append(dialOpts, redigo.DialConnectTimeout(timeout))
+
+	s := &Redis{
+		pool: &redigo.Pool{
+			MaxIdle:     8,
+			IdleTimeout: 5 * time.Minute,
+			Dial: func() (redigo.Conn, error) {
+				return redigo.Dial("tcp", endpoints[0], dialOpts...)
+			},
+		},
+		closed: make(chan struct{}),
+	}
+
+	// Fail early on an unreachable server
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		s.pool.Close()
+		return nil, err
+	}
+
+	if options != nil && options.Namespace != "" {
+		return store.WithNamespace(s, options.Namespace), nil
+	}
+	return s, nil
+}
+
+// pair is a KVPair as encoded in the published events
+type pair struct {
+	Value   string `json:"v"`
+	Index   uint64 `json:"i"`
+	Version uint64 `json:"ver"`
+	Create  uint64 `json:"c"`
+}
+
+// event is a change published by the write scripts
+type event struct {
+	Action string `json:"a"`
+	Key    string `json:"k"`
+	Node   *pair  `json:"n"`
+	Prev   *pair  `json:"p"`
+}
+
+// Codes returned by the write scripts
+const (
+	codeOK = iota
+	codeExists
+	codeNotFound
+	codeModified
+)
+
+// current reads the fields of KEYS[1] and checks them against
+// the mode in ARGV[1]: "put", "create", "update" or "cas"; a
+// cas compares the index in ARGV[2], or the value in ARGV[3]
+// when the index is 0.
+const checkLua = `
+local cur = redis.call('HMGET', KEYS[1], 'value', 'index', 'version', 'create')
+local exists = cur[2] ~= false
+local mode = ARGV[1]
+if mode == 'create' and exists then return {1} end
+if (mode == 'update' or mode == 'delete') and not exists then return {2} end
+if mode == 'cas' then
+	if not exists then return {3} end
+	if ARGV[2] == '0' then
+		if cur[1] ~= ARGV[3] then return {3} end
+	elseif cur[2] ~= ARGV[2] then
+		return {3}
+	end
+end
+local prev = nil
+if exists then
+	prev = {v = cur[1], i = tonumber(cur[2]), ver = tonumber(cur[3]), c = tonumber(cur[4])}
+end
+local rev = redis.call('INCR', KEYS[2])
+`
+
+// putScript writes ARGV[4] at KEYS[1] with a TTL of ARGV[5]
+// milliseconds, none when 0
+var putScript = redigo.NewScript(2, checkLua+`
+local node = {v = ARGV[4], i = rev, ver = 1, c = rev}
+if prev then
+	node.ver = prev.ver + 1
+	node.c = prev.c
+end
+redis.call('HMSET', KEYS[1], 'value', node.v, 'index', node.i, 'version', node.ver, 'create', node.c)
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+redis.call('PUBLISH', ARGV[6], cjson.encode({a = 'PUT', k = KEYS[1], n = node, p = prev}))
+return {0, node.i, node.ver, node.c}
+`)
+
+// deleteScript deletes KEYS[1]
+var deleteScript = redigo.NewScript(2, checkLua+`
+redis.call('DEL', KEYS[1])
+redis.call('PUBLISH', ARGV[4], cjson.encode({a = 'DELETE', k = KEYS[1], n = {i = rev}, p = prev}))
+return {0, rev}
+`)
+
+// write runs script on key, returning the revisions of the
+// pair written or store.ErrX matching the code of the script
+func (s *Redis) write(ctx context.Context, script *redigo.Script, key string, args ...interface{}) ([]uint64, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	values, err := redigo.Int64s(script.Do(conn, append([]interface{}{key, revisionKey}, args...)...))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]uint64, len(values))
+	for i, v := range values {
+		res[i] = uint64(v)
+	}
+
+	switch res[0] {
+	case codeExists:
+		return nil, store.ErrKeyExists
+	case codeNotFound:
+		return nil, store.ErrKeyNotFound
+	case codeModified:
+		return nil, store.ErrKeyModified
+	}
+	return res[1:], nil
+}
+
+// put writes value at key according to mode, see checkLua
+func (s *Redis) put(ctx context.Context, key, value, mode string, previous *store.KVPair, opts *store.WriteOptions) (*store.KVPair, error) {
+	key = store.Normalize(key)
+	index, prevValue := uint64(0), ""
+	if previous != nil {
+		index, prevValue = previous.Index, previous.Value
+	}
+	var ttl int64
+	if opts != nil && opts.TTL > 0 {
+		ttl = int64(opts.TTL / time.Millisecond)
+	}
+
+	res, err := s.write(ctx, putScript, key, mode, index, prevValue, value, ttl, eventChannel)
+	if err != nil {
+		return nil, err
+	}
+	return &store.KVPair{
+		Key:         key,
+		Value:       value,
+		Index:       res[0],
+		Version:     res[1],
+		CreateIndex: res[2],
+	}, nil
+}
+
+// conn returns a connection of the pool, failing if ctx is done
+func (s *Redis) conn(ctx context.Context) (redigo.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.pool.Get(), nil
+}
+
+// Put a value at "key", returns the pair written with
+// its new index
+func (s *Redis) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
+	return s.put(ctx, key, value, "put", nil, opts)
+}
+
+// Get a value given its key
+func (s *Redis) Get(ctx context.Context, key string) (*store.KVPair, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	key = store.Normalize(key)
+	pairs, err := s.read(conn, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs[0], nil
+}
+
+// read fetches keys in a single round trip, skipping the ones
+// missing
+func (s *Redis) read(conn redigo.Conn, keys []string) ([]*store.KVPair, error) {
+	for _, key := range keys {
+		conn.Send("HMGET", key, "value", "index", "version", "create")
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	var pairs []*store.KVPair
+	for _, key := range keys {
+		fields, err := redigo.Strings(conn.Receive())
+		if err != nil {
+			return nil, err
+		}
+		if fields[1] == "" {
+			continue
+		}
+		pair := &store.KVPair{Key: key, Value: fields[0]}
+		pair.Index, _ = strconv.ParseUint(fields[1], 10, 64)
+		pair.Version, _ = strconv.ParseUint(fields[2], 10, 64)
+		pair.CreateIndex, _ = strconv.ParseUint(fields[3], 10, 64)
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// Delete the value at the specified key, deleting a
+// missing key is not an error
+func (s *Redis) Delete(ctx context.Context, key string) error {
+	_, err := s.write(ctx, deleteScript, store.Normalize(key), "delete", 0, "", eventChannel)
+	if err == store.ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+// Exists checks if the key exists inside the store
+func (s *Redis) Exists(ctx context.Context, key string) (bool, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	return redigo.Bool(conn.Do("EXISTS", store.Normalize(key)))
+}
+
+// Update is an alias for Put with key exist
+func (s *Redis) Update(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	_, err := s.put(ctx, key, value, "update", nil, opts)
+	return err
+}
+
+// Create is an alias for Put with key not exist
+func (s *Redis) Create(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+	_, err := s.put(ctx, key, value, "create", nil, opts)
+	return err
+}
+
+// List the content of a given prefix, sorted by key. The
+// keyspace is scanned, keys written meanwhile may be missed.
+func (s *Redis) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	keys, err := s.scan(ctx, conn, store.Normalize(directory))
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := s.read(conn, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+// scan returns the sorted keys under prefix
+func (s *Redis) scan(ctx context.Context, conn redigo.Conn, prefix string) ([]string, error) {
+	pattern := globEscaper.Replace(prefix) + "*"
+
+	var keys []string
+	cursor := "0"
+	for {
+		res, err := redigo.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", scanCount))
+		if err != nil {
+			return nil, err
+		}
+		cursor, _ = redigo.String(res[0], nil)
+		batch, _ := redigo.Strings(res[1], nil)
+		keys = append(keys, batch...)
+
+		if cursor == "0" {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// A key may be returned more than once by SCAN
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique, nil
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// DeleteTree deletes the keys under directory one by one,
+// keys written meanwhile may be left
+func (s *Redis) DeleteTree(ctx context.Context, directory string) error {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := s.scan(ctx, conn, store.Normalize(directory))
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AtomicPut puts a value at "key" if the key has not been
+// modified since previous was read, or creates it if
+// previous is nil
+func (s *Redis) AtomicPut(ctx context.Context, key, value string, previous *store.KVPair, opts *store.WriteOptions) error {
+	if previous == nil {
+		_, err := s.put(ctx, key, value, "create", nil, opts)
+		return err
+	}
+	_, err := s.put(ctx, key, value, "cas", previous, opts)
+	return err
+}
+
+// AtomicDelete deletes a value at "key" if the key
+// has not been modified in the meantime, throws an
+// error if this is the case
+func (s *Redis) AtomicDelete(ctx context.Context, key string, previous *store.KVPair) error {
+	if previous == nil {
+		return store.ErrPreviousNotSpecified
+	}
+	_, err := s.write(ctx, deleteScript, store.Normalize(key), "cas", previous.Index, previous.Value, eventChannel)
+	return err
+}
+
+// Watch for changes on "key", see WatchTree
+func (s *Redis) Watch(ctx context.Context, key string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	key = store.Normalize(key)
+	return s.watch(ctx, func(k string) bool { return k == key })
+}
+
+// WatchTree watches for changes on the keys under directory.
+// Only the changes published while subscribed are seen, the
+// options are ignored. The channel is closed once ctx is done,
+// the store closed or the subscription lost, after a last
+// response carrying ErrWatchFail.
+func (s *Redis) WatchTree(ctx context.Context, directory string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	directory = store.Normalize(directory)
+	return s.watch(ctx, func(k string) bool { return strings.HasPrefix(k, directory) })
+}
+
+func (s *Redis) watch(ctx context.Context, match func(key string) bool) (<-chan *store.WatchResponse, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	psc := redigo.PubSubConn{Conn: conn}
+
+	// Wait for both subscriptions so that no change
+	// following the call is missed
+	if err := psc.Subscribe(eventChannel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := psc.PSubscribe(expiredChannel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for subscribed := 0; subscribed < 2; {
+		switch m := psc.Receive().(type) {
+		case redigo.Subscription:
+			subscribed = m.Count
+		case error:
+			conn.Close()
+			return nil, m
+		}
+	}
+
+	// Unsubscribing makes the receiving loop end,
+	// done and stopped order the writes on conn
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+			psc.PUnsubscribe()
+		case <-s.closed:
+			psc.Unsubscribe()
+			psc.PUnsubscribe()
+		case <-done:
+		}
+	}()
+
+	resp := make(chan *store.WatchResponse)
+	go func() {
+		defer close(resp)
+		defer conn.Close()
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+
+		var seq uint64
+		for {
+			r, err := s.receive(psc, match)
+			if err == nil && r == nil {
+				continue
+			}
+			if err != nil || ctx.Err() != nil {
+				seq++
+				resp <- &store.WatchResponse{Error: store.ErrWatchFail, Seq: seq}
+				return
+			}
+
+			seq++
+			r.Seq = seq
+			r.ReceivedAt = time.Now()
+			select {
+			case resp <- r:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return resp, nil
+}
+
+// receive returns the next change matching, nil if the message
+// received is not one, or an error once unsubscribed
+func (s *Redis) receive(psc redigo.PubSubConn, match func(key string) bool) (*store.WatchResponse, error) {
+	switch m := psc.Receive().(type) {
+	case redigo.Message:
+		if m.Pattern == expiredChannel {
+			key := string(m.Data)
+			if !match(key) {
+				return nil, nil
+			}
+			return &store.WatchResponse{
+				Action: store.ActionDelete,
+				Node:   &store.KVPair{Key: key},
+			}, nil
+		}
+
+		var e event
+		if err := json.Unmarshal(m.Data, &e); err != nil || !match(e.Key) {
+			return nil, nil
+		}
+		r := &store.WatchResponse{Action: e.Action, Node: e.Node.kvPair(e.Key)}
+		if e.Prev != nil {
+			r.PreNode = e.Prev.kvPair(e.Key)
+		}
+		return r, nil
+	case redigo.Subscription:
+		if m.Count == 0 {
+			return nil, store.ErrWatchFail
+		}
+		return nil, nil
+	case error:
+		return nil, m
+	}
+	return nil, nil
+}
+
+func (p *pair) kvPair(key string) *store.KVPair {
+	if p == nil {
+		return &store.KVPair{Key: key}
+	}
+	return &store.KVPair{
+		Key:         key,
+		Value:       p.Value,
+		Index:       p.Index,
+		Version:     p.Version,
+		CreateIndex: p.Create,
+	}
+}
+
+// lockScript takes the lock KEYS[1] for the token ARGV[1],
+// writing ARGV[2] as its value, for ARGV[3] milliseconds. It
+// returns 1 if the lock is held by the token, 0 if held by
+// another one and -1 if KEYS[1] is a plain key, not a lock.
+var lockScript = redigo.NewScript(2, `
+local token = redis.call('HGET', KEYS[1], 'token')
+if token then
+	if token == ARGV[1] then return 1 end
+	return 0
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then return -1 end
+local rev = redis.call('INCR', KEYS[2])
+local node = {v = ARGV[2], i = rev, ver = 1, c = rev}
+redis.call('HMSET', KEYS[1], 'value', node.v, 'index', rev, 'version', 1, 'create', rev, 'token', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PUBLISH', ARGV[4], cjson.encode({a = 'PUT', k = KEYS[1], n = node}))
+return 1
+`)
+
+// unlockScript deletes the lock KEYS[1] if the token ARGV[1]
+// holds it
+var unlockScript = redigo.NewScript(2, `
+local cur = redis.call('HMGET', KEYS[1], 'value', 'index', 'version', 'create', 'token')
+if cur[5] ~= ARGV[1] then return 0 end
+local rev = redis.call('INCR', KEYS[2])
+local prev = {v = cur[1], i = tonumber(cur[2]), ver = tonumber(cur[3]), c = tonumber(cur[4])}
+redis.call('DEL', KEYS[1])
+redis.call('PUBLISH', ARGV[2], cjson.encode({a = 'DELETE', k = KEYS[1], n = {i = rev}, p = prev}))
+return 1
+`)
+
+// extendScript makes the lock KEYS[1] held by the token
+// ARGV[1] last at least ARGV[2] milliseconds from now. It
+// returns 0 if the lock is not held by the token.
+var extendScript = redigo.NewScript(1, `
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then return 0 end
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// NewLock returns a handle to a lock struct which can
+// be used to provide mutual exclusion on a key. The lock
+// is the key itself, holding Value, and expires after TTL
+// unless renewed: it is renewed while held, until Unlock
+// or until RenewLock is closed.
+func (s *Redis) NewLock(key string, opt *store.LockOptions) store.Locker {
+	token := make([]byte, 16)
+	rand.Read(token)
+
+	l := &redisLock{
+		s:     s,
+		key:   store.Normalize(key),
+		ttl:   defaultLockTTL,
+		token: hex.EncodeToString(token),
+	}
+	if opt != nil {
+		l.value = opt.Value
+		l.renew = opt.RenewLock
+		if opt.TTL > 0 {
+			l.ttl = opt.TTL
+		}
+	}
+	return l
+}
+
+// Lock attempts to acquire the lock, polling until it
+// is free or ctx is done
+func (l *redisLock) Lock(ctx context.Context) error {
+	for {
+		ok, err := l.TryLock(ctx)
+		if ok || err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(lockRetry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryLock acquires the lock if it is free, without
+// blocking. It returns false if the lock is held, and
+// ErrKeyExists if the key holds data rather than a lock.
+func (l *redisLock) TryLock(ctx context.Context) (bool, error) {
+	conn, err := l.s.conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	res, err := redigo.Int(lockScript.Do(conn, l.key, revisionKey,
+		l.token, l.value, int64(l.ttl/time.Millisecond), eventChannel))
+	if err != nil {
+		return false, err
+	}
+	// Taking the lock would overwrite the data stored there
+	if res < 0 {
+		return false, store.ErrKeyExists
+	}
+	if res == 0 {
+		return false, nil
+	}
+
+	if l.stop == nil {
+		l.stop = make(chan struct{})
+		go l.renewal(l.stop)
+	}
+	return true, nil
+}
+
+// renewal keeps the lock alive until stop or RenewLock
+// is closed
+func (l *redisLock) renewal(stop chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case <-l.renew:
+			return
+		case <-l.s.closed:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		err := l.Extend(ctx, l.ttl)
+		cancel()
+		if err == store.ErrLockNotHeld {
+			return
+		}
+	}
+}
+
+// Unlock releases the lock, unlocking a lock that is
+// not held does nothing
+func (l *redisLock) Unlock(ctx context.Context) error {
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+
+	conn, err := l.s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = unlockScript.Do(conn, l.key, revisionKey, l.token, eventChannel)
+	return err
+}
+
+// Extend keeps the lock for at least ttl from now
+func (l *redisLock) Extend(ctx context.Context, ttl time.Duration) error {
+	conn, err := l.s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ok, err := redigo.Bool(extendScript.Do(conn, l.key, l.token, int64(ttl/time.Millisecond)))
+	if err == nil && !ok {
+		err = store.ErrLockNotHeld
+	}
+	return err
+}
+
+// Compact is not supported in redis, there is no history
+func (s *Redis) Compact(ctx context.Context, rev uint64, physical bool) error {
+	return store.ErrCallNotSupported
+}
+
+// CompactRevision is not supported in redis, there is no history
+func (s *Redis) CompactRevision(ctx context.Context) (uint64, error) {
+	return 0, store.ErrCallNotSupported
+}
+
+// NewTxn is not supported in redis
+func (s *Redis) NewTxn(ctx context.Context) (store.Txn, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+// Status pings the server
+func (s *Redis) Status(ctx context.Context) error {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+	return err
+}
+
+// Close ends the watches and lock renewals and closes
+// the client connections. Closing again is a no-op that
+// returns the first result.
+func (s *Redis) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.closeErr = s.pool.Close()
+	})
+	return s.closeErr
+}
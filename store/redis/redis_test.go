@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore"
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/YuleiXiao/kvstore/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	client = "localhost:6379"
+)
+
+func makeRedisClient(t *testing.T) store.Store {
+	kv, err := New(
+		[]string{client},
+		&store.Config{
+			ConnectionTimeout: 3 * time.Second,
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("cannot create store: %v", err)
+	}
+
+	return kv
+}
+
+func TestRegister(t *testing.T) {
+	Register()
+
+	kv, err := kvstore.NewStore(store.REDIS, []string{client}, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, kv)
+
+	if _, ok := kv.(*Redis); !ok {
+		t.Fatal("Error registering and initializing redis")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+
+	testutils.RunCleanup(t, kv)
+	testutils.RunTestCommon(t, kv)
+	testutils.RunTestAtomic(t, kv)
+	testutils.RunTestWatch(t, kv)
+	testutils.RunTestLock(t, kv)
+
+	_, err := kv.NewTxn(context.Background())
+	assert.Equal(t, store.ErrCallNotSupported, err)
+	assert.NoError(t, kv.Status(context.Background()))
+}
+
+func TestLockTTL(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+	otherKV := makeRedisClient(t)
+	defer otherKV.Close()
+
+	testutils.RunTestLockTTL(t, kv, otherKV)
+}
+
+func TestTryLock(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+
+	ctx := context.Background()
+	lock := kv.NewLock("testTryLock", &store.LockOptions{Value: "node-1"})
+	ok, err := lock.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	other := kv.NewLock("testTryLock", nil)
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, store.ErrLockNotHeld, other.Extend(ctx, time.Second))
+
+	// The holder can be read from the lock key
+	pair, err := kv.Get(ctx, "testTryLock")
+	assert.NoError(t, err)
+	assert.Equal(t, "node-1", pair.Value)
+
+	assert.NoError(t, lock.Unlock(ctx))
+	ok, err = other.TryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestLockRefusesDataKey(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+
+	ctx := context.Background()
+	_, err := kv.Put(ctx, "testLockDataKey", "data", nil)
+	assert.NoError(t, err)
+
+	lock := kv.NewLock("testLockDataKey", nil)
+	ok, err := lock.TryLock(ctx)
+	assert.Equal(t, store.ErrKeyExists, err)
+	assert.False(t, ok)
+	assert.Equal(t, store.ErrKeyExists, lock.Lock(ctx))
+
+	pair, err := kv.Get(ctx, "testLockDataKey")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", pair.Value)
+	assert.NoError(t, kv.Delete(ctx, "testLockDataKey"))
+}
+
+func TestCloseTwice(t *testing.T) {
+	kv := makeRedisClient(t)
+
+	assert.NoError(t, kv.Close())
+	assert.NoError(t, kv.Close())
+}
+
+func TestListEscapesPattern(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+
+	ctx := context.Background()
+	defer kv.DeleteTree(ctx, "testList*")
+
+	_, err := kv.Put(ctx, "testList*/a", "a", nil)
+	assert.NoError(t, err)
+	_, err = kv.Put(ctx, "testListX/b", "b", nil)
+	assert.NoError(t, err)
+	defer kv.Delete(ctx, "testListX/b")
+
+	pairs, err := kv.List(ctx, "testList*")
+	assert.NoError(t, err)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, "/testList*/a", pairs[0].Key)
+	}
+}
+
+func TestWatchPreNode(t *testing.T) {
+	kv := makeRedisClient(t)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer kv.DeleteTree(context.Background(), "testWatchPreNode")
+
+	events, err := kv.WatchTree(ctx, "testWatchPreNode", nil)
+	assert.NoError(t, err)
+
+	first, err := kv.Put(ctx, "testWatchPreNode/key", "v1", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Delete(ctx, "testWatchPreNode/key"))
+
+	e := <-events
+	assert.Equal(t, store.ActionPut, e.Action)
+	assert.Nil(t, e.PreNode)
+	assert.Equal(t, *first, *e.Node)
+
+	e = <-events
+	assert.Equal(t, store.ActionDelete, e.Action)
+	assert.Equal(t, *first, *e.PreNode)
+	assert.True(t, e.Node.Index > first.Index)
+}
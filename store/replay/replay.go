@@ -0,0 +1,92 @@
+// Package replay provides a store whose watches replay a recorded
+// sequence of responses, so that event driven consumers can be
+// tested deterministically without a cluster.
+package replay
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+)
+
+// Store replays Events on every Watch and WatchTree, honoring the
+// channel contract of the real backends: responses are delivered
+// in order with Seq numbered from 1, and the channel is closed
+// once the context is done. It is also closed after the last
+// response, which lets consumers detect the end of the recording.
+//
+// Other calls are forwarded to the embedded Store, which may be
+// left nil when only watches are used.
+type Store struct {
+	store.Store
+
+	// Events is the recorded sequence, it is never modified
+	Events []*store.WatchResponse
+
+	// Interval is waited before each response is delivered,
+	// responses are delivered as fast as they are read when zero
+	Interval time.Duration
+}
+
+// New returns a Store replaying events, waiting interval
+// before each of them
+func New(events []*store.WatchResponse, interval time.Duration) *Store {
+	return &Store{Events: events, Interval: interval}
+}
+
+// Watch replays the responses about key. Responses without a
+// node, such as errors, are always replayed.
+func (s *Store) Watch(ctx context.Context, key string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	key = store.Normalize(key)
+	return s.replay(ctx, func(k string) bool {
+		return k == key
+	}), nil
+}
+
+// WatchTree replays the responses about keys under directory.
+// Responses without a node, such as errors, are always replayed.
+func (s *Store) WatchTree(ctx context.Context, directory string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
+	directory = store.Normalize(directory)
+	return s.replay(ctx, func(k string) bool {
+		return strings.HasPrefix(k, directory)
+	}), nil
+}
+
+func (s *Store) replay(ctx context.Context, match func(key string) bool) <-chan *store.WatchResponse {
+	watchCh := make(chan *store.WatchResponse)
+
+	go func() {
+		defer close(watchCh)
+
+		var seq uint64
+		for _, e := range s.Events {
+			if e.Node != nil && !match(store.Normalize(e.Node.Key)) {
+				continue
+			}
+
+			if s.Interval > 0 {
+				select {
+				case <-time.After(s.Interval):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			seq++
+			resp := *e
+			resp.Seq = seq
+			resp.ReceivedAt = time.Now()
+
+			select {
+			case watchCh <- &resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return watchCh
+}
@@ -0,0 +1,95 @@
+package replay
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func recording() []*store.WatchResponse {
+	return []*store.WatchResponse{
+		{Action: store.ActionPut, Node: &store.KVPair{Key: "/app/a", Value: "1", Index: 10}},
+		{Action: store.ActionPut, Node: &store.KVPair{Key: "/other", Value: "x", Index: 11}},
+		{
+			Action:  store.ActionPut,
+			PreNode: &store.KVPair{Key: "/app/a", Value: "1", Index: 10},
+			Node:    &store.KVPair{Key: "/app/a", Value: "2", Index: 12},
+		},
+		{
+			Action:  store.ActionDelete,
+			PreNode: &store.KVPair{Key: "/app/a", Value: "2", Index: 12},
+			Node:    &store.KVPair{Key: "/app/a", Index: 13},
+		},
+	}
+}
+
+// counter is a consumer keeping the last value of every key
+type counter struct {
+	values  map[string]string
+	indexes []uint64
+}
+
+func (c *counter) process(e *store.WatchResponse) {
+	c.indexes = append(c.indexes, e.Node.Index)
+	if e.Action == store.ActionDelete {
+		delete(c.values, e.Node.Key)
+		return
+	}
+	c.values[e.Node.Key] = e.Node.Value
+}
+
+func TestReplayWatchTree(t *testing.T) {
+	kv := New(recording(), time.Millisecond)
+
+	events, err := kv.WatchTree(context.Background(), "app", nil)
+	assert.NoError(t, err)
+
+	c := &counter{values: map[string]string{}}
+	var seqs []uint64
+	for e := range events {
+		seqs = append(seqs, e.Seq)
+		assert.False(t, e.ReceivedAt.IsZero())
+		c.process(e)
+	}
+
+	assert.Equal(t, []uint64{10, 12, 13}, c.indexes)
+	assert.Equal(t, []uint64{1, 2, 3}, seqs)
+	assert.Empty(t, c.values)
+
+	// The recording is left untouched
+	assert.Equal(t, uint64(0), kv.Events[0].Seq)
+}
+
+func TestReplayWatch(t *testing.T) {
+	kv := New(recording(), 0)
+
+	events, err := kv.Watch(context.Background(), "other", nil)
+	assert.NoError(t, err)
+
+	e := <-events
+	assert.Equal(t, "x", e.Node.Value)
+	assert.Equal(t, uint64(1), e.Seq)
+
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestReplayCancel(t *testing.T) {
+	kv := New(recording(), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := kv.WatchTree(ctx, "/", nil)
+	assert.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("replay did not stop on cancel")
+	}
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const shardPrefix = "/shard-"
+
+// ShardedKey returns the key placed under its shard prefix,
+// in the form:
+//
+//	/shard-<n>/path/to/key
+//
+// The shard only depends on the normalized key so that
+// writers and readers always agree. Less than one shard is
+// taken as one, like WithSharding does.
+func ShardedKey(key string, shards int) string {
+	if shards < 1 {
+		shards = 1
+	}
+	key = Normalize(key)
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%s%d%s", shardPrefix, h.Sum32()%uint32(shards), key)
+}
+
+// unshardKey strips the shard prefix from a key
+func unshardKey(key string) string {
+	if !strings.HasPrefix(key, shardPrefix) {
+		return key
+	}
+	if i := strings.Index(key[len(shardPrefix):], "/"); i >= 0 {
+		return key[len(shardPrefix)+i:]
+	}
+	return key
+}
+
+func unshardPair(pair *KVPair) *KVPair {
+	if pair != nil {
+		pair.Key = unshardKey(pair.Key)
+	}
+	return pair
+}
+
+type shardingStore struct {
+	Store
+	shards int
+}
+
+// WithSharding wraps s so that keys are transparently spread
+// over shards prefixes using ShardedKey. Directory operations
+// (List, DeleteTree, WatchTree) are run against every shard
+// and their results merged. Keys returned are unsharded.
+//
+// A directory is not guaranteed to land on the same shard as
+// its children, a directory key is thus only a prefix.
+func WithSharding(s Store, shards int) Store {
+	if shards < 1 {
+		shards = 1
+	}
+	return &shardingStore{Store: s, shards: shards}
+}
+
+func (s *shardingStore) key(key string) string {
+	return ShardedKey(key, s.shards)
+}
+
+func (s *shardingStore) dir(shard int, directory string) string {
+	return fmt.Sprintf("%s%d%s", shardPrefix, shard, Normalize(directory))
+}
+
+func (s *shardingStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	pair, err := s.Store.Put(ctx, s.key(key), value, options)
+	return unshardPair(pair), err
+}
+
+func (s *shardingStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	pair, err := s.Store.Get(ctx, s.key(key))
+	return unshardPair(pair), err
+}
+
+func (s *shardingStore) Delete(ctx context.Context, key string) error {
+	return s.Store.Delete(ctx, s.key(key))
+}
+
+func (s *shardingStore) Exists(ctx context.Context, key string) (bool, error) {
+	return s.Store.Exists(ctx, s.key(key))
+}
+
+func (s *shardingStore) Update(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Update(ctx, s.key(key), value, opts)
+}
+
+func (s *shardingStore) Create(ctx context.Context, key, value string, opts *WriteOptions) error {
+	return s.Store.Create(ctx, s.key(key), value, opts)
+}
+
+func (s *shardingStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	return s.Store.AtomicPut(ctx, s.key(key), value, previous, options)
+}
+
+func (s *shardingStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	return s.Store.AtomicDelete(ctx, s.key(key), previous)
+}
+
+func (s *shardingStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	var pairs []*KVPair
+	for i := 0; i < s.shards; i++ {
+		shardPairs, err := s.Store.List(ctx, s.dir(i, directory))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range shardPairs {
+			pairs = append(pairs, unshardPair(pair))
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+func (s *shardingStore) DeleteTree(ctx context.Context, directory string) error {
+	found := false
+	for i := 0; i < s.shards; i++ {
+		err := s.Store.DeleteTree(ctx, s.dir(i, directory))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if !found {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (s *shardingStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	events, err := s.Store.Watch(ctx, s.key(key), opt)
+	if err != nil {
+		return nil, err
+	}
+	return s.merge([]<-chan *WatchResponse{events}, nil), nil
+}
+
+func (s *shardingStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var chans []<-chan *WatchResponse
+	for i := 0; i < s.shards; i++ {
+		events, err := s.Store.WatchTree(ctx, s.dir(i, directory), opt)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		chans = append(chans, events)
+	}
+
+	return s.merge(chans, cancel), nil
+}
+
+// merge forwards the responses of all chans with their keys
+// unsharded, the returned channel is closed once all are and
+// done is called
+func (s *shardingStore) merge(chans []<-chan *WatchResponse, done func()) <-chan *WatchResponse {
+	resp := make(chan *WatchResponse)
+
+	var wg sync.WaitGroup
+	for _, events := range chans {
+		wg.Add(1)
+		go func(events <-chan *WatchResponse) {
+			defer wg.Done()
+			for e := range events {
+				unshardPair(e.PreNode)
+				unshardPair(e.Node)
+				resp <- e
+			}
+		}(events)
+	}
+
+	go func() {
+		wg.Wait()
+		if done != nil {
+			done()
+		}
+		close(resp)
+	}()
+	return resp
+}
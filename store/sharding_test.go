@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedKey(t *testing.T) {
+	assert.Equal(t, ShardedKey("app/foo", 8), ShardedKey("/app/foo", 8))
+	assert.True(t, strings.HasSuffix(ShardedKey("app/foo", 8), "/app/foo"))
+	assert.Equal(t, "/app/foo", unshardKey(ShardedKey("app/foo", 8)))
+	assert.Equal(t, "/shard-0/app/foo", ShardedKey("app/foo", 1))
+	assert.Equal(t, "/shard-0/app/foo", ShardedKey("app/foo", 0))
+}
+
+func TestWithSharding(t *testing.T) {
+	backend := newMapStore()
+	kv := WithSharding(backend, 4)
+	ctx := context.Background()
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("/app/key%02d", i)
+		keys = append(keys, key)
+		_, err := kv.Put(ctx, key, key, nil)
+		assert.NoError(t, err)
+	}
+
+	// Keys are spread over several shards
+	shards := map[string]bool{}
+	for k := range backend.data {
+		shards[k[:strings.Index(k[1:], "/")+1]] = true
+	}
+	assert.True(t, len(shards) > 1)
+
+	pair, err := kv.Get(ctx, "app/key03")
+	assert.NoError(t, err)
+	assert.Equal(t, "/app/key03", pair.Key)
+	assert.Equal(t, "/app/key03", pair.Value)
+
+	pairs, err := kv.List(ctx, "app")
+	assert.NoError(t, err)
+	var listed []string
+	for _, pair := range pairs {
+		assert.Equal(t, pair.Value, pair.Key)
+		listed = append(listed, pair.Key)
+	}
+	sort.Strings(listed)
+	assert.Equal(t, keys, listed)
+
+	_, err = kv.List(ctx, "other")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// SharedWatcher shares a single backend watch per key or
+// directory among all its local subscribers. The backend watch
+// is started by the first subscriber and stopped once the last
+// one leaves.
+type SharedWatcher struct {
+	store Store
+	opt   *WatchOptions
+
+	mu      sync.Mutex
+	watches map[sharedKey]*sharedWatch
+}
+
+type sharedKey struct {
+	key  string
+	tree bool
+}
+
+type sharedWatch struct {
+	cancel context.CancelFunc
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+type subscriber struct {
+	in   chan *WatchResponse
+	done chan struct{}
+}
+
+// NewSharedWatcher returns a SharedWatcher over s, opt applies
+// to every backend watch
+func NewSharedWatcher(s Store, opt *WatchOptions) *SharedWatcher {
+	return &SharedWatcher{
+		store:   s,
+		opt:     opt,
+		watches: make(map[sharedKey]*sharedWatch),
+	}
+}
+
+// Subscribe returns a channel receiving the responses of the
+// watch on key, or on its children when tree is set. The
+// subscription ends once ctx is done, the channel is then closed.
+// It is also closed if the backend watch ends.
+//
+// Responses are delivered to the subscribers one after the
+// other: a slow subscriber holds back the others.
+func (w *SharedWatcher) Subscribe(ctx context.Context, key string, tree bool) (<-chan *WatchResponse, error) {
+	sk := sharedKey{key: Normalize(key), tree: tree}
+	sub := &subscriber{
+		in:   make(chan *WatchResponse),
+		done: make(chan struct{}),
+	}
+
+	w.mu.Lock()
+	sw, ok := w.watches[sk]
+	if !ok {
+		var err error
+		if sw, err = w.start(sk); err != nil {
+			w.mu.Unlock()
+			return nil, err
+		}
+		w.watches[sk] = sw
+	}
+	sw.subs[sub] = struct{}{}
+	w.mu.Unlock()
+
+	out := make(chan *WatchResponse)
+	go func() {
+		defer close(out)
+		defer w.unsubscribe(sk, sw, sub)
+		defer close(sub.done)
+
+		for {
+			select {
+			case e, ok := <-sub.in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Watches returns the number of backend watches running
+func (w *SharedWatcher) Watches() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.watches)
+}
+
+// start opens the backend watch of sk and fans its responses
+// out to the subscribers, w.mu must be held
+func (w *SharedWatcher) start(sk sharedKey) (*sharedWatch, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var events <-chan *WatchResponse
+	var err error
+	if sk.tree {
+		events, err = w.store.WatchTree(ctx, sk.key, w.opt)
+	} else {
+		events, err = w.store.Watch(ctx, sk.key, w.opt)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	sw := &sharedWatch{cancel: cancel, subs: make(map[*subscriber]struct{})}
+	go func() {
+		for e := range events {
+			w.mu.Lock()
+			subs := make([]*subscriber, 0, len(sw.subs))
+			for sub := range sw.subs {
+				subs = append(subs, sub)
+			}
+			w.mu.Unlock()
+
+			for _, sub := range subs {
+				select {
+				case sub.in <- e:
+				case <-sub.done:
+				}
+			}
+		}
+
+		// The backend watch ended, close what is left
+		w.mu.Lock()
+		w.close(sk, sw)
+		subs := sw.subs
+		sw.subs = nil
+		w.mu.Unlock()
+
+		for sub := range subs {
+			close(sub.in)
+		}
+	}()
+
+	return sw, nil
+}
+
+func (w *SharedWatcher) unsubscribe(sk sharedKey, sw *sharedWatch, sub *subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(sw.subs, sub)
+	if len(sw.subs) == 0 {
+		w.close(sk, sw)
+	}
+}
+
+// close stops the backend watch of sw, w.mu must be held
+func (w *SharedWatcher) close(sk sharedKey, sw *sharedWatch) {
+	if sw.closed {
+		return
+	}
+	sw.closed = true
+	sw.cancel()
+	if w.watches[sk] == sw {
+		delete(w.watches, sk)
+	}
+}
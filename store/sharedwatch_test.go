@@ -0,0 +1,70 @@
+package store
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the watches opened on its backend
+type countingStore struct {
+	*feedStore
+	watches int32
+}
+
+func (s *countingStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	atomic.AddInt32(&s.watches, 1)
+	return s.feedStore.Watch(ctx, key, opt)
+}
+
+func TestSharedWatcher(t *testing.T) {
+	kv := &countingStore{feedStore: &feedStore{}}
+	w := NewSharedWatcher(kv, nil)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	sub1, err := w.Subscribe(ctx1, "key", false)
+	assert.NoError(t, err)
+	sub2, err := w.Subscribe(ctx2, "/key/", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&kv.watches))
+	assert.Equal(t, 1, w.Watches())
+
+	kv.input("/key") <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/key", Value: "1"}}
+	for _, sub := range []<-chan *WatchResponse{sub1, sub2} {
+		e := <-sub
+		assert.Equal(t, "1", e.Node.Value)
+	}
+
+	// The watch survives the first subscriber leaving
+	cancel1()
+	_, ok := <-sub1
+	assert.False(t, ok)
+	assert.Equal(t, 1, w.Watches())
+
+	kv.input("/key") <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/key", Value: "2"}}
+	e := <-sub2
+	assert.Equal(t, "2", e.Node.Value)
+
+	// and stops with the last one
+	cancel2()
+	_, ok = <-sub2
+	assert.False(t, ok)
+	for i := 0; i < 100 && w.Watches() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, w.Watches())
+
+	// A new subscriber starts a new watch
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	_, err = w.Subscribe(ctx3, "key", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&kv.watches))
+}
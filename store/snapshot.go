@@ -0,0 +1,65 @@
+package store
+
+import (
+	"time"
+)
+
+// redacted replaces secrets in configuration snapshots
+const redacted = "[REDACTED]"
+
+// ConfigSnapshot is a copy of the settings a store was created
+// with, safe to log or dump: secrets are redacted
+type ConfigSnapshot struct {
+	Endpoints         []string
+	ConnectionTimeout time.Duration
+	OperationTimeout  time.Duration
+	WaitForReady      time.Duration
+	AutoSyncInterval  time.Duration
+	RejectOldCluster  bool
+	TLS               bool
+	Bucket            string
+	PersistConnection bool
+	Username          string
+	Password          string
+	MaxStaleRevisions uint64
+	StalenessRefresh  time.Duration
+	WarnValueBytes    int
+	Consistency       map[string]Consistency
+	Namespace         string
+}
+
+// NewConfigSnapshot returns the snapshot of a store created for
+// endpoints with options, which may be nil. Backends adjust the
+// fields they apply defaults to.
+func NewConfigSnapshot(endpoints []string, options *Config) ConfigSnapshot {
+	snap := ConfigSnapshot{
+		Endpoints: append([]string(nil), endpoints...),
+	}
+	if options == nil {
+		return snap
+	}
+
+	snap.ConnectionTimeout = options.ConnectionTimeout
+	snap.OperationTimeout = options.OperationTimeout
+	snap.WaitForReady = options.WaitForReady
+	snap.AutoSyncInterval = options.AutoSyncInterval
+	snap.RejectOldCluster = options.RejectOldCluster
+	snap.TLS = options.TLS != nil || options.ClientTLS != nil
+	snap.Bucket = options.Bucket
+	snap.PersistConnection = options.PersistConnection
+	snap.Username = options.Username
+	if options.Password != "" {
+		snap.Password = redacted
+	}
+	snap.MaxStaleRevisions = options.MaxStaleRevisions
+	snap.StalenessRefresh = options.StalenessRefresh
+	snap.WarnValueBytes = options.WarnValueBytes
+	snap.Namespace = options.Namespace
+	if options.Consistency != nil {
+		snap.Consistency = make(map[string]Consistency, len(options.Consistency))
+		for prefix, c := range options.Consistency {
+			snap.Consistency[prefix] = c
+		}
+	}
+	return snap
+}
@@ -18,6 +18,12 @@ const (
 
 	// ZK backend
 	ZK = "zk"
+
+	// REDIS backend
+	REDIS = "redis"
+
+	// BOLTDB backend
+	BOLTDB = "boltdb"
 )
 
 var (
@@ -39,12 +45,51 @@ var (
 	ErrKeyExists = errors.New("Previous K/V pair exists, cannot complete Atomic operation")
 	// ErrWatchFail is thrown when the watch fail or response channel closed
 	ErrWatchFail = errors.New("Some error occurred when watch or response channel was closed")
+	// ErrInvalidKey is thrown when a key is rejected by the key policy of the store
+	ErrInvalidKey = errors.New("Key rejected by the key policy")
+	// ErrCircuitOpen is thrown when calls are rejected by an open circuit breaker
+	ErrCircuitOpen = errors.New("Circuit breaker is open, backend considered unhealthy")
+	// ErrTooManyOperations is thrown when a request needs more operations than a single transaction allows
+	ErrTooManyOperations = errors.New("Too many operations in a single transaction")
+	// ErrCompacted is thrown when the requested revision has been compacted away
+	ErrCompacted = errors.New("Requested revision has been compacted, a full List is required")
+	// ErrLeaseLost is thrown when a lease can no longer be kept alive
+	ErrLeaseLost = errors.New("Lease keepalive failed, the lease is lost or about to expire")
+	// ErrWatchSetClosed is thrown when a watch is added to a closed watch set
+	ErrWatchSetClosed = errors.New("Watch set is closed")
+	// ErrNotOwner is thrown when a key is not owned by the expected owner
+	ErrNotOwner = errors.New("Key is not owned by the expected owner")
+	// ErrLockNotHeld is thrown when an operation requires a lock that is not held
+	ErrLockNotHeld = errors.New("Lock is not held")
+	// ErrNotReady is thrown when the cluster has no leader before the readiness timeout
+	ErrNotReady = errors.New("Cluster not ready, no leader elected before the timeout")
+	// ErrUnexpectedEvent is delivered on a watch channel for an event of unknown type
+	ErrUnexpectedEvent = errors.New("Unexpected watch event type")
+	// ErrDependencyMissing is thrown when a conditional write depends on a key that does not exist
+	ErrDependencyMissing = errors.New("Key depended upon does not exist")
+	// ErrDuplicateKey is thrown when the same key is written more than once in a batch
+	ErrDuplicateKey = errors.New("Duplicate key written in a single batch")
+	// ErrInitialSnapshotTooLarge is thrown when the initial values of a watch exceed MaxInitialKeys
+	ErrInitialSnapshotTooLarge = errors.New("Too many initial values for the watch")
+	// ErrEmptyDirectory is thrown when deleting a tree whose directory is the root of the keyspace
+	ErrEmptyDirectory = errors.New("Refusing to delete the whole keyspace under an empty directory")
+	// ErrNoLease is thrown when asking the time to live of a key that never expires
+	ErrNoLease = errors.New("Key has no lease attached, it does not expire")
+	// ErrInvalidInterval is thrown when a window or an interval is not positive
+	ErrInvalidInterval = errors.New("Window or interval must be positive")
+	// ErrInvalidTTL is thrown when a TTL is too short to be granted as a lease
+	ErrInvalidTTL = errors.New("TTL must be at least one second")
 )
 
 // ActionXXX is the action definition of request.
 const (
 	ActionPut    = "PUT"
 	ActionDelete = "DELETE"
+
+	// ActionReconnect reports a failed attempt to re-establish
+	// a watch, the Error field holds the cause. The channel
+	// stays open and the watcher keeps retrying.
+	ActionReconnect = "RECONNECT"
 )
 
 // Config contains the options for a storage client
@@ -56,14 +101,86 @@ type Config struct {
 	PersistConnection bool
 	Username          string
 	Password          string
+
+	// MaxStaleRevisions bounds how far behind the cluster a
+	// serializable read may be: a read served by a member lagging
+	// by more revisions is retried linearizably. Zero means no bound.
+	MaxStaleRevisions uint64
+
+	// StalenessRefresh is how often the cluster revision checked
+	// by MaxStaleRevisions is refreshed, one second by default.
+	StalenessRefresh time.Duration
+
+	// WaitForReady makes the constructor block until the cluster
+	// has elected a leader, failing with ErrNotReady if none is
+	// elected within the duration. Zero does not wait.
+	WaitForReady time.Duration
+
+	// AutoSyncInterval is how often the etcd v3 client refreshes
+	// its endpoints from the member list, so that a long-lived
+	// store follows the membership changes of the cluster instead
+	// of insisting on a removed member. Disabled when zero, a
+	// minute is a reasonable interval.
+	AutoSyncInterval time.Duration
+
+	// RejectOldCluster makes the etcd v3 client refuse to connect
+	// to a cluster running an outdated version
+	RejectOldCluster bool
+	// Logger receives the internal diagnostics of the store,
+	// nothing is logged when nil
+	Logger Logger
+
+	// Observer receives the metrics of the store, if set
+	Observer Observer
+
+	// WarnValueBytes is a soft limit on the size of written
+	// values: larger values are still written but a warning
+	// is logged. Zero disables the warning.
+	WarnValueBytes int
+	// OperationTimeout bounds the calls made with a context
+	// that has no deadline, so that an unreachable cluster
+	// does not block them forever. Backends pick a default
+	// when zero, a negative value disables the bound.
+	OperationTimeout time.Duration
+
+	// Consistency maps key prefixes to the consistency of the
+	// reads under them, the longest matching prefix wins. A
+	// consistency set on the context with WithConsistency takes
+	// precedence. Keys matching no prefix are read linearizably.
+	Consistency map[string]Consistency
+
+	// Namespace confines the store to the keys under it, like
+	// WithNamespace: keys are transparently prefixed and the keys
+	// returned are relative to it, so that several applications
+	// can share a cluster. Backends without native support are
+	// wrapped with WithNamespace.
+	Namespace string
+}
+
+// Logger is the logging interface used by the stores
+type Logger interface {
+	Errorf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// Observer collects metrics about the calls made to a store
+type Observer interface {
+	// ObserveValueSize is called with the size in bytes
+	// of every value written to key
+	ObserveValueSize(key string, size int)
 }
 
 // ClientTLSConfig contains data for a Client TLS configuration in the form
 // the etcd client wants it.  Eventually we'll adapt it for ZK and Consul.
+//
+// The files are PEM encoded. The client certificate is optional,
+// without CA file the system roots are trusted. It is only used
+// when Config.TLS is not set, see TLSConfig.
 type ClientTLSConfig struct {
-	CertFile   string
-	KeyFile    string
-	CACertFile string
+	CertFile           string
+	KeyFile            string
+	CACertFile         string
+	InsecureSkipVerify bool // do not verify the certificate of the server
 }
 
 // Store represents the backend K/V storage
@@ -71,8 +188,9 @@ type ClientTLSConfig struct {
 // here. Or it couldn't be implemented as a K/V
 // backend for kvstore
 type Store interface {
-	// Put a value at the specified key
-	Put(ctx context.Context, key, value string, options *WriteOptions) error
+	// Put a value at the specified key, returning the pair
+	// written so that it can be used for a later Atomic call
+	Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error)
 
 	// Get a value given its key
 	Get(ctx context.Context, key string) (*KVPair, error)
@@ -115,13 +233,29 @@ type Store interface {
 	AtomicDelete(ctx context.Context, key string, previous *KVPair) error
 
 	// Compact compacts etcd KV history before the given rev.
-	Compact(ctx context.Context, rev uint64, wait bool) error
+	// A physical compaction only returns once the compacted
+	// entries are removed from the backend database, which is
+	// slower but required before defragmenting. Otherwise the
+	// call returns as soon as the compaction is scheduled.
+	Compact(ctx context.Context, rev uint64, physical bool) error
+
+	// CompactRevision returns the revision the history was last
+	// compacted at, 0 if it never was. Watches and reads from an
+	// older revision fail with ErrCompacted.
+	CompactRevision(ctx context.Context) (uint64, error)
 
 	// NewTxn creates a transaction Txn.
 	NewTxn(ctx context.Context) (Txn, error)
 
-	// Close the store connection
-	Close()
+	// Status checks that the backend is reachable and serving,
+	// it returns nil when it is healthy. It is meant for health
+	// and readiness probes, and cheaper than a read.
+	Status(ctx context.Context) error
+
+	// Close the store connection and stop the background
+	// work of the store. Using the store after Close is
+	// undefined.
+	Close() error
 }
 
 // KVPair represents {Key, Value} tuple
@@ -131,8 +265,9 @@ type KVPair struct {
 	Index uint64
 
 	// only for etcdv3
-	Version uint64
-	Lease   uint64
+	Version     uint64
+	Lease       uint64
+	CreateIndex uint64 // revision the key was created at
 }
 
 func (kv *KVPair) String() string {
@@ -140,25 +275,86 @@ func (kv *KVPair) String() string {
 	return string(data)
 }
 
+// LeasedPair is a KVPair annotated with the remaining
+// time to live of its lease. TTL is zero when the key has
+// no lease attached.
+type LeasedPair struct {
+	*KVPair
+	TTL time.Duration
+}
+
 // LockOptions contains optional request parameters
 type LockOptions struct {
 	Value     string        // Optional, value to associate with the lock
 	TTL       time.Duration // Optional, expiration ttl associated with the lock
 	RenewLock chan struct{} // Optional, chan used to control and stop the session ttl renewal for the lock
+
+	// Heartbeat is the interval at which a held lock rewrites
+	// its key with a LockHeartbeat carrying Value as owner, so
+	// that watchers can tell a live holder from a stuck one.
+	// Disabled when zero.
+	Heartbeat time.Duration
+}
+
+// LockHeartbeat is the JSON value written under a lock key
+// by a holder configured with a heartbeat
+type LockHeartbeat struct {
+	Owner string    `json:"owner"`
+	Time  time.Time `json:"time"`
 }
 
 // Locker provides lock mechanism
 type Locker interface {
 	Lock(ctx context.Context) error
 	Unlock(ctx context.Context) error
+
+	// TryLock acquires the lock if it is free, without
+	// blocking. It returns false if the lock is held.
+	TryLock(ctx context.Context) (bool, error)
+
+	// Extend pushes the expiry of a held lock to at least
+	// ttl from now, on top of any automatic renewal
+	Extend(ctx context.Context, ttl time.Duration) error
+}
+
+// ListOptions tunes a List call, the zero value lists
+// like List does
+type ListOptions struct {
+	Serializable bool   // read from the local member, possibly stale
+	Limit        int    // maximum number of pairs returned, no limit when zero
+	Descending   bool   // sort by key in descending order instead of ascending
+	Revision     uint64 // list at this past revision, the latest when zero
+	KeysOnly     bool   // leave the values of the pairs empty, they are not transferred
 }
 
 // WatchResponse will be returned when watch event happen.
 type WatchResponse struct {
+	// Error reports a failure of the watch, Action and the
+	// nodes are then unset unless Action is ActionReconnect.
+	// Consumers must check it on every response: a watch
+	// that fails for good sends a last response with Error set
+	// before its channel is closed. The error is ErrCompacted
+	// when the revision watched has been compacted, which ends
+	// the watch even with Reconnect, ErrWatchFail when the watch
+	// is cancelled or the store closed, and the error of the
+	// backend otherwise.
 	Error   error
 	Action  string
 	PreNode *KVPair
 	Node    *KVPair
+
+	// Seq is assigned by the watcher, starting at 1 and
+	// incremented by one for every response delivered on
+	// the channel. A gap between two consecutive responses
+	// means events were dropped on the way to the consumer,
+	// by a WatchSet filter for instance.
+	Seq uint64
+
+	// ReceivedAt is the time the library received the
+	// response from the backend, before handing it over to
+	// the consumer: the delivery delay is the time elapsed
+	// since when the response is read from the channel.
+	ReceivedAt time.Time
 }
 
 func (wr *WatchResponse) String() string {
@@ -170,11 +366,72 @@ func (wr *WatchResponse) String() string {
 type WriteOptions struct {
 	IsDir bool // useless in etcdv3
 	TTL   time.Duration
+
+	// Timeout bounds the write, in place of the operation timeout
+	// of the store. An earlier deadline of the context of the
+	// call still applies.
+	Timeout time.Duration
 }
 
 // WatchOptions contains optional request parameters
 type WatchOptions struct {
+	// Index starts the watch at a past revision, the events
+	// since then are sent first. The Index of the Node of a
+	// response is the revision of its event: a consumer that
+	// saved the last one it handled resumes after a restart
+	// without missing or repeating events by watching from
+	// that Index plus one. Starting at a compacted revision
+	// fails the watch with ErrCompacted.
 	Index uint64
+
+	// Reconnect re-establishes a failed watch from the last
+	// received revision instead of closing the channel. Failed
+	// attempts are retried with an exponential backoff capped
+	// by MaxBackoff.
+	Reconnect  bool
+	MaxBackoff time.Duration
+
+	// ReconcileInterval, when set on a tree watch, periodically
+	// re-lists the tree and emits a DELETE for every key known to
+	// the watcher that no longer exists in the store. It is a
+	// safety net against deletes lost while the watch was down.
+	ReconcileInterval time.Duration
+
+	// The current value of the key, or of every key of the tree,
+	// is first sent as PUT responses without PreNode. The watch
+	// then starts right after the revision of that read so that
+	// no change is missed in between. SkipInitialValues only
+	// sends the changes, as does setting Index.
+	SkipInitialValues bool
+
+	// MaxInitialKeys bounds the number of initial values read at
+	// once, no bound when zero. Past it the watch fails with
+	// ErrInitialSnapshotTooLarge, unless PagedInitialValues is set:
+	// the initial values are then read and sent page by page, at
+	// the same revision, MaxInitialKeys at a time.
+	MaxInitialKeys     int
+	PagedInitialValues bool
+
+	// FilterPut and FilterDelete drop the PUT, respectively the
+	// DELETE, events of the watch before they reach the consumer.
+	// Errors and reconnects are always delivered.
+	FilterPut    bool
+	FilterDelete bool
+}
+
+// Filters reports whether the events of action are dropped
+// by the watch
+func (o *WatchOptions) Filters(action string) bool {
+	if o == nil {
+		return false
+	}
+	switch action {
+	case ActionPut:
+		return o.FilterPut
+	case ActionDelete:
+		return o.FilterDelete
+	}
+	return false
 }
 
 // OpResponse will be returned when transaction commit.
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// mapStore is a minimal in-memory backend
+type mapStore struct {
+	Store
+	mu    sync.Mutex
+	index uint64
+	data  map[string]*KVPair
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{data: make(map[string]*KVPair)}
+}
+
+func (s *mapStore) Put(ctx context.Context, key, value string, options *WriteOptions) (*KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index++
+	s.data[Normalize(key)] = &KVPair{Key: Normalize(key), Value: value, Index: s.index}
+	copy := *s.data[Normalize(key)]
+	return &copy, nil
+}
+
+func (s *mapStore) Get(ctx context.Context, key string) (*KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.data[Normalize(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	copy := *pair
+	return &copy, nil
+}
+
+func (s *mapStore) AtomicPut(ctx context.Context, key, value string, previous *KVPair, options *WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.data[Normalize(key)]
+	if previous == nil && ok {
+		return ErrKeyExists
+	}
+	if previous != nil && (!ok || pair.Index != previous.Index) {
+		return ErrKeyModified
+	}
+
+	s.index++
+	s.data[Normalize(key)] = &KVPair{Key: Normalize(key), Value: value, Index: s.index}
+	return nil
+}
+
+func (s *mapStore) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pairs []*KVPair
+	for k, pair := range s.data {
+		if strings.HasPrefix(k, Normalize(directory)) {
+			copy := *pair
+			pairs = append(pairs, &copy)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+func (s *mapStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, Normalize(key))
+	return nil
+}
+
+func (s *mapStore) AtomicDelete(ctx context.Context, key string, previous *KVPair) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, ok := s.data[Normalize(key)]
+	if !ok || pair.Index != previous.Index {
+		return ErrKeyModified
+	}
+	delete(s.data, Normalize(key))
+	return nil
+}
+
+func (s *mapStore) NewTxn(ctx context.Context) (Txn, error) {
+	return nil, ErrCallNotSupported
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig returns the TLS configuration of options, TLS if
+// set or else the one loaded from the files of ClientTLS. It
+// returns nil when options has neither.
+func TLSConfig(options *Config) (*tls.Config, error) {
+	if options == nil {
+		return nil, nil
+	}
+	if options.TLS != nil {
+		return options.TLS, nil
+	}
+	if options.ClientTLS == nil {
+		return nil, nil
+	}
+
+	files := options.ClientTLS
+	cfg := &tls.Config{InsecureSkipVerify: files.InsecureSkipVerify}
+	if files.CertFile != "" || files.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate %s: %v", files.CertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if files.CACertFile != "" {
+		pem, err := ioutil.ReadFile(files.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load CA certificate: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cannot load CA certificate %s: no certificate found", files.CACertFile)
+		}
+	}
+	return cfg, nil
+}
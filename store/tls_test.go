@@ -0,0 +1,91 @@
+package store
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key
+// to dir, returning their paths
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kvstore"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvstore-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	cfg, err := TLSConfig(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = TLSConfig(&Config{ClientTLS: &ClientTLSConfig{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		CACertFile: certFile,
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Certificates, 1)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.False(t, cfg.InsecureSkipVerify)
+
+	// A configuration built by the caller wins
+	own := &tls.Config{}
+	cfg, err = TLSConfig(&Config{TLS: own, ClientTLS: &ClientTLSConfig{CACertFile: "missing.pem"}})
+	assert.NoError(t, err)
+	assert.True(t, own == cfg)
+
+	cfg, err = TLSConfig(&Config{ClientTLS: &ClientTLSConfig{InsecureSkipVerify: true}})
+	assert.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+	assert.Nil(t, cfg.RootCAs)
+
+	// Missing and unparseable files are reported
+	_, err = TLSConfig(&Config{ClientTLS: &ClientTLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}})
+	assert.Error(t, err)
+	_, err = TLSConfig(&Config{ClientTLS: &ClientTLSConfig{CACertFile: filepath.Join(dir, "missing.pem")}})
+	assert.Error(t, err)
+	_, err = TLSConfig(&Config{ClientTLS: &ClientTLSConfig{CACertFile: keyFile}})
+	assert.EqualError(t, err, "cannot load CA certificate "+keyFile+": no certificate found")
+}
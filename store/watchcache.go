@@ -0,0 +1,169 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// watchCacheRetry is the delay before a failed cache
+// watch is set up again
+const watchCacheRetry = 500 * time.Millisecond
+
+type watchCache struct {
+	Store
+	prefix string
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	ready   bool
+	data    map[string]*KVPair
+	removed map[string]uint64 // index of the deletes seen since the last resync
+}
+
+// WithWatchCache wraps s so that Get and List under prefix are
+// served from memory. The cache is filled by listing the prefix
+// and kept up to date by a background WatchTree. Whenever that
+// watch fails the cache is rebuilt from scratch, reads going to
+// the backend until it is.
+//
+// Writes always go to the backend and are visible to cached reads
+// once the watch delivers them. Close stops the watch.
+func WithWatchCache(s Store, prefix string) Store {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &watchCache{Store: s, prefix: Normalize(prefix), cancel: cancel}
+	go c.run(ctx)
+	return c
+}
+
+func (c *watchCache) run(ctx context.Context) {
+	for {
+		c.sync(ctx)
+
+		c.mu.Lock()
+		c.ready = false
+		c.mu.Unlock()
+
+		select {
+		case <-time.After(watchCacheRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync rebuilds the cache and applies watch events until the
+// watch fails
+func (c *watchCache) sync(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The watch is set up before listing so that no change is
+	// missed, events older than the listing are ignored
+	events, err := c.Store.WatchTree(ctx, c.prefix, &WatchOptions{SkipInitialValues: true})
+	if err != nil {
+		return
+	}
+
+	pairs, err := c.Store.List(ctx, c.prefix)
+	if err != nil && err != ErrKeyNotFound {
+		return
+	}
+
+	data := make(map[string]*KVPair, len(pairs))
+	for _, pair := range pairs {
+		data[pair.Key] = pair
+	}
+
+	c.mu.Lock()
+	c.data = data
+	c.removed = make(map[string]uint64)
+	c.ready = true
+	c.mu.Unlock()
+
+	for e := range events {
+		if e.Error != nil {
+			return
+		}
+		c.apply(e)
+	}
+}
+
+func (c *watchCache) apply(e *WatchResponse) {
+	if e.Node == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := e.Node.Key
+	if pair, ok := c.data[key]; ok && pair.Index > e.Node.Index {
+		return
+	}
+	if c.removed[key] > e.Node.Index {
+		return
+	}
+
+	switch e.Action {
+	case ActionDelete:
+		delete(c.data, key)
+		c.removed[key] = e.Node.Index
+	default:
+		c.data[key] = e.Node
+		delete(c.removed, key)
+	}
+}
+
+// cached reports whether key is under the cached prefix
+// and the cache can serve it
+func (c *watchCache) cached(key string) bool {
+	return c.ready && strings.HasPrefix(Normalize(key), c.prefix)
+}
+
+func (c *watchCache) Get(ctx context.Context, key string) (*KVPair, error) {
+	c.mu.RLock()
+	if !c.cached(key) {
+		c.mu.RUnlock()
+		return c.Store.Get(ctx, key)
+	}
+	defer c.mu.RUnlock()
+
+	pair, ok := c.data[Normalize(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	copy := *pair
+	return &copy, nil
+}
+
+func (c *watchCache) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	c.mu.RLock()
+	if !c.cached(directory) {
+		c.mu.RUnlock()
+		return c.Store.List(ctx, directory)
+	}
+	defer c.mu.RUnlock()
+
+	var pairs []*KVPair
+	for key, pair := range c.data {
+		if strings.HasPrefix(key, Normalize(directory)) {
+			copy := *pair
+			pairs = append(pairs, &copy)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs, nil
+}
+
+func (c *watchCache) Close() error {
+	c.cancel()
+	return c.Store.Close()
+}
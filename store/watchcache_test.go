@@ -0,0 +1,134 @@
+package store
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cacheBackend counts reads and hands every new tree watch
+// over to the test
+type cacheBackend struct {
+	*mapStore
+	reads   int32
+	watches chan chan *WatchResponse
+}
+
+func (s *cacheBackend) Get(ctx context.Context, key string) (*KVPair, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.mapStore.Get(ctx, key)
+}
+
+func (s *cacheBackend) List(ctx context.Context, directory string) ([]*KVPair, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.mapStore.List(ctx, directory)
+}
+
+func (s *cacheBackend) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	events := make(chan *WatchResponse)
+	s.watches <- events
+	return events, nil
+}
+
+func (s *cacheBackend) Close() error { return nil }
+
+func waitCacheReady(t *testing.T, kv Store) {
+	for i := 0; i < 100; i++ {
+		c := kv.(*watchCache)
+		c.mu.RLock()
+		ready := c.ready
+		c.mu.RUnlock()
+		if ready {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("cache not ready")
+}
+
+// waitCachedValue waits for the cache to serve want at key,
+// an empty want waiting for the key to be gone
+func waitCachedValue(t *testing.T, kv Store, key, want string) {
+	var got string
+	for i := 0; i < 100; i++ {
+		got = ""
+		if pair, err := kv.Get(context.Background(), key); err == nil {
+			got = pair.Value
+		}
+		if got == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: expected %q, got %q", key, want, got)
+}
+
+func TestWithWatchCache(t *testing.T) {
+	backend := &cacheBackend{mapStore: newMapStore(), watches: make(chan chan *WatchResponse, 1)}
+	ctx := context.Background()
+
+	backend.Put(ctx, "app/a", "a", nil)
+	backend.Put(ctx, "other/b", "b", nil)
+
+	kv := WithWatchCache(backend, "app")
+	defer kv.Close()
+
+	events := <-backend.watches
+	waitCacheReady(t, kv)
+	warmup := atomic.LoadInt32(&backend.reads)
+
+	pair, err := kv.Get(ctx, "app/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", pair.Value)
+	_, err = kv.Get(ctx, "app/missing")
+	assert.Equal(t, ErrKeyNotFound, err)
+	pairs, err := kv.List(ctx, "app")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 1)
+	assert.Equal(t, warmup, atomic.LoadInt32(&backend.reads))
+
+	// Keys outside of the prefix are read from the backend
+	_, err = kv.Get(ctx, "other/b")
+	assert.NoError(t, err)
+	assert.Equal(t, warmup+1, atomic.LoadInt32(&backend.reads))
+
+	// Out-of-band write, visible once the watch delivers it
+	backend.Put(ctx, "app/c", "c", nil)
+	c, _ := backend.mapStore.Get(ctx, "app/c")
+	events <- &WatchResponse{Action: ActionPut, Node: c}
+	waitCachedValue(t, kv, "app/c", "c")
+
+	// Stale events are ignored, the delete sent after
+	// them is only applied once they have been
+	events <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: "/app/c", Value: "old", Index: 1}}
+	events <- &WatchResponse{Action: ActionDelete, Node: &KVPair{Key: "/app/a", Index: c.Index + 1}}
+	waitCachedValue(t, kv, "app/a", "")
+	waitCachedValue(t, kv, "app/c", "c")
+	assert.Equal(t, warmup+1, atomic.LoadInt32(&backend.reads))
+}
+
+func TestWithWatchCacheResync(t *testing.T) {
+	backend := &cacheBackend{mapStore: newMapStore(), watches: make(chan chan *WatchResponse, 1)}
+	ctx := context.Background()
+
+	backend.Put(ctx, "app/a", "a", nil)
+
+	kv := WithWatchCache(backend, "app")
+	defer kv.Close()
+
+	events := <-backend.watches
+	waitCacheReady(t, kv)
+
+	// The watch fails and a write is missed meanwhile
+	events <- &WatchResponse{Error: ErrWatchFail}
+	close(events)
+	backend.Put(ctx, "app/a", "changed", nil)
+
+	// The cache is rebuilt from the backend
+	<-backend.watches
+	waitCachedValue(t, kv, "app/a", "changed")
+}
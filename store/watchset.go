@@ -0,0 +1,167 @@
+package store
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// WatchSpec describes a watch of a WatchSet
+type WatchSpec struct {
+	Key     string
+	Tree    bool          // watch the children of Key rather than Key itself
+	Options *WatchOptions // optional
+
+	// Filter drops the responses for which it returns false,
+	// all responses are delivered when nil
+	Filter func(*WatchResponse) bool
+}
+
+// WatchSet manages a changing set of watches whose responses
+// are merged into a single channel
+type WatchSet struct {
+	store  Store
+	ctx    context.Context
+	cancel context.CancelFunc
+	events chan *WatchResponse
+
+	mu      sync.Mutex
+	closed  bool
+	watches map[sharedKey]*watchSetEntry
+	wg      sync.WaitGroup
+}
+
+// watchSetEntry is a running watch of a WatchSet
+type watchSetEntry struct {
+	cancel context.CancelFunc
+}
+
+// NewWatchSet starts a watch for every spec. Watches can then be
+// added and removed at runtime, their responses are all delivered
+// on Events. If a watch fails to start, the ones already started
+// are stopped.
+func NewWatchSet(s Store, specs []WatchSpec) (*WatchSet, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ws := &WatchSet{
+		store:   s,
+		ctx:     ctx,
+		cancel:  cancel,
+		events:  make(chan *WatchResponse),
+		watches: make(map[sharedKey]*watchSetEntry),
+	}
+
+	for _, spec := range specs {
+		if err := ws.Add(spec); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+	return ws, nil
+}
+
+// Events returns the merged responses of all watches. It is
+// closed once the set is closed.
+func (ws *WatchSet) Events() <-chan *WatchResponse {
+	return ws.events
+}
+
+// Add starts watching spec. A watch already set up for the same
+// key and Tree is replaced. A watch that ends on its own, e.g.
+// after a failure, is removed from the set.
+func (ws *WatchSet) Add(spec WatchSpec) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return ErrWatchSetClosed
+	}
+
+	ctx, cancel := context.WithCancel(ws.ctx)
+	var (
+		events <-chan *WatchResponse
+		err    error
+	)
+	if spec.Tree {
+		events, err = ws.store.WatchTree(ctx, spec.Key, spec.Options)
+	} else {
+		events, err = ws.store.Watch(ctx, spec.Key, spec.Options)
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	sk := sharedKey{key: Normalize(spec.Key), tree: spec.Tree}
+	if prev, ok := ws.watches[sk]; ok {
+		prev.cancel()
+	}
+	entry := &watchSetEntry{cancel: cancel}
+	ws.watches[sk] = entry
+
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		ws.forward(ctx, events, spec.Filter)
+		ws.ended(sk, entry)
+	}()
+	return nil
+}
+
+// Remove stops the watch of key, of its children when tree is
+// set. It returns ErrKeyNotFound if there is none.
+func (ws *WatchSet) Remove(key string, tree bool) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	sk := sharedKey{key: Normalize(key), tree: tree}
+	entry, ok := ws.watches[sk]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	entry.cancel()
+	delete(ws.watches, sk)
+	return nil
+}
+
+// ended removes entry once its watch is over, unless it
+// was replaced meanwhile
+func (ws *WatchSet) ended(sk sharedKey, entry *watchSetEntry) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	entry.cancel()
+	if ws.watches[sk] == entry {
+		delete(ws.watches, sk)
+	}
+}
+
+// Close stops all the watches and closes the Events channel
+func (ws *WatchSet) Close() {
+	ws.mu.Lock()
+	if ws.closed {
+		ws.mu.Unlock()
+		return
+	}
+	ws.closed = true
+	ws.watches = nil
+	ws.mu.Unlock()
+
+	ws.cancel()
+	ws.wg.Wait()
+	close(ws.events)
+}
+
+// forward delivers the responses of a single watch until it
+// is stopped. The failure reported by a stopped watch is not
+// delivered.
+func (ws *WatchSet) forward(ctx context.Context, events <-chan *WatchResponse, filter func(*WatchResponse) bool) {
+	for e := range events {
+		if ctx.Err() != nil || (filter != nil && !filter(e)) {
+			continue
+		}
+		select {
+		case ws.events <- e:
+		case <-ctx.Done():
+		}
+	}
+}
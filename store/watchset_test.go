@@ -0,0 +1,146 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// feedStore serves watches fed by the test through per-key
+// inputs, a watch is closed once its context is done
+type feedStore struct {
+	Store
+	mu     sync.Mutex
+	inputs map[string]chan *WatchResponse
+}
+
+func (s *feedStore) input(key string) chan *WatchResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inputs == nil {
+		s.inputs = make(map[string]chan *WatchResponse)
+	}
+	if _, ok := s.inputs[key]; !ok {
+		s.inputs[key] = make(chan *WatchResponse, 10)
+	}
+	return s.inputs[key]
+}
+
+func (s *feedStore) Watch(ctx context.Context, key string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	in := s.input(Normalize(key))
+	out := make(chan *WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case e, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *feedStore) WatchTree(ctx context.Context, directory string, opt *WatchOptions) (<-chan *WatchResponse, error) {
+	return s.Watch(ctx, directory, opt)
+}
+
+func (s *feedStore) push(key string) {
+	s.input(Normalize(key)) <- &WatchResponse{Action: ActionPut, Node: &KVPair{Key: Normalize(key)}}
+}
+
+func expectEvent(t *testing.T, events <-chan *WatchResponse, key string) {
+	select {
+	case e := <-events:
+		assert.Equal(t, key, e.Node.Key)
+	case <-time.After(time.Second):
+		t.Fatalf("no event for %s", key)
+	}
+}
+
+func expectNoEvent(t *testing.T, events <-chan *WatchResponse) {
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// len returns the number of watches in the set
+func (ws *WatchSet) len() int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return len(ws.watches)
+}
+
+func TestWatchSet(t *testing.T) {
+	kv := &feedStore{}
+
+	ws, err := NewWatchSet(kv, []WatchSpec{
+		{Key: "a"},
+		{Key: "dir", Tree: true, Filter: func(e *WatchResponse) bool {
+			return e.Action == ActionPut
+		}},
+	})
+	assert.NoError(t, err)
+
+	kv.push("a")
+	expectEvent(t, ws.Events(), "/a")
+	kv.push("dir")
+	expectEvent(t, ws.Events(), "/dir")
+
+	// Filtered out
+	kv.input("/dir") <- &WatchResponse{Action: ActionDelete, Node: &KVPair{Key: "/dir"}}
+	expectNoEvent(t, ws.Events())
+
+	// Added at runtime
+	assert.NoError(t, ws.Add(WatchSpec{Key: "b"}))
+	kv.push("b")
+	expectEvent(t, ws.Events(), "/b")
+
+	// Removed at runtime
+	assert.NoError(t, ws.Remove("a", false))
+	assert.Equal(t, ErrKeyNotFound, ws.Remove("a", false))
+	kv.push("a")
+	expectNoEvent(t, ws.Events())
+
+	// A watch and a tree watch of the same key coexist
+	assert.NoError(t, ws.Add(WatchSpec{Key: "c"}))
+	assert.NoError(t, ws.Add(WatchSpec{Key: "c", Tree: true}))
+	assert.Equal(t, 4, ws.len())
+	assert.NoError(t, ws.Remove("c", true))
+	assert.Equal(t, ErrKeyNotFound, ws.Remove("c", true))
+	assert.NoError(t, ws.Remove("c", false))
+
+	// A watch that ends on its own leaves the set
+	assert.NoError(t, ws.Add(WatchSpec{Key: "d"}))
+	assert.Equal(t, 3, ws.len())
+	close(kv.input("/d"))
+	for i := 0; ws.len() != 2; i++ {
+		if i == 100 {
+			t.Fatal("ended watch still in the set")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ErrKeyNotFound, ws.Remove("d", false))
+
+	ws.Close()
+	_, ok := <-ws.Events()
+	assert.False(t, ok)
+	assert.Equal(t, ErrWatchSetClosed, ws.Add(WatchSpec{Key: "c"}))
+	ws.Close()
+}
@@ -0,0 +1,194 @@
+package zookeeper
+
+import (
+	"path"
+
+	"golang.org/x/net/context"
+
+	"github.com/YuleiXiao/kvstore/store"
+	zk "github.com/samuel/go-zookeeper/zk"
+)
+
+// treeNode is a znode watched by a treeWatch, with the data
+// and children last seen
+type treeNode struct {
+	data     []byte
+	version  int32
+	children map[string]bool
+}
+
+// treeEvent is a notification of a data or child watch set on
+// the node at path
+type treeEvent struct {
+	path  string
+	node  *treeNode
+	event zk.Event
+}
+
+// treeWatch keeps a data and a child watch on every znode under
+// root, zk watches only fire once and only for a single level
+type treeWatch struct {
+	s      *Zookeeper
+	ctx    context.Context
+	root   string
+	nodes  map[string]*treeNode
+	events chan treeEvent
+}
+
+func newTreeWatch(ctx context.Context, s *Zookeeper, root string) *treeWatch {
+	return &treeWatch{
+		s:      s,
+		ctx:    ctx,
+		root:   root,
+		nodes:  make(map[string]*treeNode),
+		events: make(chan treeEvent),
+	}
+}
+
+// start watches the children of the root, the ones already
+// there are not reported
+func (w *treeWatch) start() error {
+	node := &treeNode{children: make(map[string]bool)}
+	w.nodes[w.root] = node
+	_, err := w.watchChildren(w.root, node, false)
+	return err
+}
+
+// forward hands the single event of ch over to w.events
+func (w *treeWatch) forward(p string, node *treeNode, ch <-chan zk.Event) {
+	go func() {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			select {
+			case w.events <- treeEvent{path: p, node: node, event: e}:
+			case <-w.ctx.Done():
+			}
+		case <-w.ctx.Done():
+		}
+	}()
+}
+
+// watchNode starts watching the node at p and its subtree, the
+// ones just created are reported as PUT when created is set
+func (w *treeWatch) watchNode(p string, created bool) ([]*store.WatchResponse, error) {
+	data, stat, ch, err := w.s.client.GetW(p)
+	if err == zk.ErrNoNode {
+		// Already deleted, there is nothing to report
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	node := &treeNode{data: data, version: stat.Version, children: make(map[string]bool)}
+	w.nodes[p] = node
+	w.forward(p, node, ch)
+
+	var resps []*store.WatchResponse
+	if created {
+		resps = append(resps, &store.WatchResponse{
+			Action: store.ActionPut,
+			Node:   node.pair(p),
+		})
+	}
+	children, err := w.watchChildren(p, node, created)
+	return append(resps, children...), err
+}
+
+// watchChildren sets the child watch of the node at p and starts
+// watching the children it does not know yet
+func (w *treeWatch) watchChildren(p string, node *treeNode, created bool) ([]*store.WatchResponse, error) {
+	children, _, ch, err := w.s.client.ChildrenW(p)
+	if err == zk.ErrNoNode && p != w.root {
+		// Deleted, its own data watch reports it
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.forward(p, node, ch)
+
+	var resps []*store.WatchResponse
+	for _, child := range children {
+		if node.children[child] {
+			continue
+		}
+		node.children[child] = true
+		r, err := w.watchNode(path.Join(p, child), created)
+		if err != nil {
+			return nil, err
+		}
+		resps = append(resps, r...)
+	}
+	return resps, nil
+}
+
+// handle returns the responses for e, an error ends the watch
+func (w *treeWatch) handle(e treeEvent) ([]*store.WatchResponse, error) {
+	// Left over by a node since deleted
+	if w.nodes[e.path] != e.node {
+		return nil, nil
+	}
+
+	switch e.event.Type {
+	case zk.EventNodeChildrenChanged:
+		return w.watchChildren(e.path, e.node, true)
+
+	case zk.EventNodeDataChanged:
+		data, stat, ch, err := w.s.client.GetW(e.path)
+		if err == zk.ErrNoNode {
+			return w.deleted(e)
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.forward(e.path, e.node, ch)
+
+		pre := e.node.pair(e.path)
+		e.node.data, e.node.version = data, stat.Version
+		return []*store.WatchResponse{{
+			Action:  store.ActionPut,
+			PreNode: pre,
+			Node:    e.node.pair(e.path),
+		}}, nil
+
+	case zk.EventNodeDeleted:
+		return w.deleted(e)
+
+	case zk.EventNotWatching:
+		if e.event.Err != nil {
+			return nil, e.event.Err
+		}
+		return nil, store.ErrWatchFail
+	}
+	return nil, nil
+}
+
+// deleted forgets the node of e and reports its deletion, znodes
+// with children cannot be deleted so its subtree is gone already
+func (w *treeWatch) deleted(e treeEvent) ([]*store.WatchResponse, error) {
+	if e.path == w.root {
+		return nil, store.ErrKeyNotFound
+	}
+	delete(w.nodes, e.path)
+	if parent, ok := w.nodes[path.Dir(e.path)]; ok {
+		delete(parent.children, path.Base(e.path))
+	}
+
+	return []*store.WatchResponse{{
+		Action:  store.ActionDelete,
+		PreNode: e.node.pair(e.path),
+		Node:    &store.KVPair{Key: e.path},
+	}}, nil
+}
+
+func (n *treeNode) pair(p string) *store.KVPair {
+	return &store.KVPair{
+		Key:   p,
+		Value: string(n.data),
+		Index: uint64(n.version),
+	}
+}
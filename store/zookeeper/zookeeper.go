@@ -62,6 +62,9 @@ func New(endpoints []string, options *store.Config) (store.Store, error) {
 	}
 	s.client = conn
 
+	if options != nil && options.Namespace != "" {
+		return store.WithNamespace(s, options.Namespace), nil
+	}
 	return s, nil
 }
 
@@ -123,11 +126,11 @@ func (s *Zookeeper) createFullPath(path []string, value string, ephemeral bool)
 }
 
 // Put a value at "key"
-func (s *Zookeeper) Put(ctx context.Context, key, value string, opts *store.WriteOptions) error {
+func (s *Zookeeper) Put(ctx context.Context, key, value string, opts *store.WriteOptions) (*store.KVPair, error) {
 	fkey := store.Normalize(key)
 	exists, err := s.Exists(ctx, fkey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !exists {
@@ -138,8 +141,16 @@ func (s *Zookeeper) Put(ctx context.Context, key, value string, opts *store.Writ
 		}
 	}
 
-	_, err = s.client.Set(fkey, []byte(value), -1)
-	return err
+	meta, err := s.client.Set(fkey, []byte(value), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.KVPair{
+		Key:   fkey,
+		Value: value,
+		Index: uint64(meta.Version),
+	}, nil
 }
 
 // Create is an alias for Put with key not exist
@@ -196,10 +207,18 @@ func (s *Zookeeper) Watch(ctx context.Context, key string, opt *store.WatchOptio
 	resp := make(chan *store.WatchResponse)
 	go func() {
 		defer close(resp)
+
+		var seq uint64
+		send := func(r *store.WatchResponse) {
+			seq++
+			r.Seq = seq
+			resp <- r
+		}
+
 		for {
 			data, meta, eventCh, err := s.client.GetW(fkey)
 			if err != nil {
-				resp <- &store.WatchResponse{Error: err}
+				send(&store.WatchResponse{Error: err})
 				return
 			}
 
@@ -207,7 +226,7 @@ func (s *Zookeeper) Watch(ctx context.Context, key string, opt *store.WatchOptio
 			case e := <-eventCh:
 				if e.Type == zk.EventNodeDataChanged {
 					if entry, err := s.Get(ctx, fkey); err == nil {
-						resp <- &store.WatchResponse{
+						send(&store.WatchResponse{
 							Action: store.ActionPut,
 							Node:   entry,
 							PreNode: &store.KVPair{
@@ -215,22 +234,22 @@ func (s *Zookeeper) Watch(ctx context.Context, key string, opt *store.WatchOptio
 								Value: string(data),
 								Index: uint64(meta.Version),
 							},
-						}
+						})
 					}
 				} else if e.Type == zk.EventNodeDeleted {
-					resp <- &store.WatchResponse{
+					send(&store.WatchResponse{
 						Action: store.ActionDelete,
 						PreNode: &store.KVPair{
 							Key:   fkey,
 							Value: string(data),
 							Index: uint64(meta.Version),
 						},
-					}
+					})
 				}
 
 			case <-ctx.Done():
 				// There is no way to stop GetW so just quit
-				resp <- &store.WatchResponse{Error: ctx.Err()}
+				send(&store.WatchResponse{Error: ctx.Err()})
 				return
 			}
 		}
@@ -241,9 +260,10 @@ func (s *Zookeeper) Watch(ctx context.Context, key string, opt *store.WatchOptio
 
 // WatchTree watches for changes on a "directory"
 // It returns a channel that will receive changes or pass
-// on errors. Upon creating a watch, the current childs values
-// will be sent to the channel .Providing a non-nil stopCh can
-// be used to stop watching.
+// on errors. Every znode under the directory is watched,
+// at any depth: created ones and data changes are sent as
+// PUT, deleted ones as DELETE, keyed by their full path.
+// The watch ends once ctx is done or the directory deleted.
 func (s *Zookeeper) WatchTree(ctx context.Context, dir string, opt *store.WatchOptions) (<-chan *store.WatchResponse, error) {
 	fkey := store.Normalize(dir)
 
@@ -251,26 +271,35 @@ func (s *Zookeeper) WatchTree(ctx context.Context, dir string, opt *store.WatchO
 	resp := make(chan *store.WatchResponse)
 	go func() {
 		defer close(resp)
-		for {
-			data, meta, eventCh, err := s.client.ChildrenW(fkey)
-			if err != nil {
-				resp <- &store.WatchResponse{Error: err}
-				return
-			}
 
+		var seq uint64
+		send := func(r *store.WatchResponse) {
+			seq++
+			r.Seq = seq
+			resp <- r
+		}
+
+		w := newTreeWatch(ctx, s, fkey)
+		if err := w.start(); err != nil {
+			send(&store.WatchResponse{Error: err})
+			return
+		}
+
+		for {
 			select {
-			case e := <-eventCh:
-				if e.Type == zk.EventNodeChildrenChanged {
-					pairs, err := s.List(ctx, fkey)
-					respList := s.makeWatchResponse(data, meta, pairs, err)
-					for _, r := range respList {
-						resp <- r
-					}
+			case e := <-w.events:
+				resps, err := w.handle(e)
+				for _, r := range resps {
+					send(r)
+				}
+				if err != nil {
+					send(&store.WatchResponse{Error: err})
+					return
 				}
 
 			case <-ctx.Done():
-				// There is no way to stop GetW so just quit
-				resp <- &store.WatchResponse{Error: context.Canceled}
+				// There is no way to stop the zk watches so just quit
+				send(&store.WatchResponse{Error: context.Canceled})
 				return
 			}
 		}
@@ -279,50 +308,6 @@ func (s *Zookeeper) WatchTree(ctx context.Context, dir string, opt *store.WatchO
 	return resp, nil
 }
 
-// makeWatchResponse construct WatchResponse with nodes before and after event happen.
-func (s *Zookeeper) makeWatchResponse(preNodes []string, stat *zk.Stat, paris []*store.KVPair, err error) []*store.WatchResponse {
-	if err != nil {
-		resp := &store.WatchResponse{Error: err}
-		return []*store.WatchResponse{resp}
-	}
-
-	contain := func(s string, list []string) bool {
-		for _, str := range list {
-			if s == str {
-				return true
-			}
-		}
-		return false
-	}
-
-	var nodes []string
-	respList := []*store.WatchResponse{}
-	for _, kv := range paris {
-		nodes = append(nodes, kv.Key)
-		if !contain(kv.Key, preNodes) {
-			respList = append(respList, &store.WatchResponse{
-				Action: store.ActionPut,
-				Node: &store.KVPair{
-					Key:   kv.Key,
-					Index: kv.Index,
-					Value: kv.Value,
-				},
-			})
-		}
-	}
-
-	for _, k := range preNodes {
-		if !contain(k, nodes) {
-			respList = append(respList, &store.WatchResponse{
-				Action:  store.ActionDelete,
-				PreNode: &store.KVPair{Key: k},
-			})
-		}
-	}
-
-	return respList
-}
-
 // List child nodes of a given directory
 func (s *Zookeeper) List(ctx context.Context, directory string) ([]*store.KVPair, error) {
 	fkey := store.Normalize(directory)
@@ -492,17 +477,40 @@ func (l *zookeeperLock) Unlock(ctx context.Context) error {
 	return l.lock.Unlock()
 }
 
+// TryLock is not supported, Lock blocks until the lock is free
+func (l *zookeeperLock) TryLock(ctx context.Context) (bool, error) {
+	return false, store.ErrCallNotSupported
+}
+
+// Extend is not supported in zookeeper, locks do not
+// expire while the session is alive.
+func (l *zookeeperLock) Extend(ctx context.Context, ttl time.Duration) error {
+	return store.ErrCallNotSupported
+}
+
 // Compact compacts etcd KV history before the given rev. But not support in zookeeper.
-func (s *Zookeeper) Compact(ctx context.Context, rev uint64, wait bool) error {
+func (s *Zookeeper) Compact(ctx context.Context, rev uint64, physical bool) error {
 	return store.ErrCallNotSupported
 }
 
+// CompactRevision is not supported in zookeeper, there is no history.
+func (s *Zookeeper) CompactRevision(ctx context.Context) (uint64, error) {
+	return 0, store.ErrCallNotSupported
+}
+
 // NewTxn creates a transaction Txn.
 func (s *Zookeeper) NewTxn(ctx context.Context) (store.Txn, error) {
 	return nil, store.ErrCallNotSupported
 }
 
+// Status checks the server is serving with a read of the root
+func (s *Zookeeper) Status(ctx context.Context) error {
+	_, _, err := s.client.Exists("/")
+	return err
+}
+
 // Close closes the client connection
-func (s *Zookeeper) Close() {
+func (s *Zookeeper) Close() error {
 	s.client.Close()
+	return nil
 }
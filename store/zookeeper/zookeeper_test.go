@@ -63,3 +63,60 @@ func TestZkStore(t *testing.T) {
 
 	testNewTxn(t, kv)
 }
+
+func TestWatchTreeRecursive(t *testing.T) {
+	kv := makeZkClient(t)
+	defer kv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := "testWatchTreeRecursive"
+	defer kv.DeleteTree(context.Background(), dir)
+	defer kv.DeleteTree(context.Background(), dir+"/sub")
+
+	_, err := kv.Put(ctx, dir+"/a", "a", nil)
+	assert.NoError(t, err)
+	events, err := kv.WatchTree(ctx, dir, nil)
+	assert.NoError(t, err)
+
+	// expect skips the responses until the one for key with value
+	expect := func(action, key, value string) *store.WatchResponse {
+		for {
+			select {
+			case e := <-events:
+				if !assert.NoError(t, e.Error) {
+					t.FailNow()
+				}
+				if e.Action == action && e.Node.Key == key && (action == store.ActionDelete || e.Node.Value == value) {
+					return e
+				}
+			case <-time.After(4 * time.Second):
+				t.Fatalf("Timeout reached waiting for %s %s", action, key)
+			}
+		}
+	}
+
+	// Keys created below a new child are watched
+	_, err = kv.Put(ctx, dir+"/sub/b", "b1", nil)
+	assert.NoError(t, err)
+	expect(store.ActionPut, "/"+dir+"/sub", "")
+	expect(store.ActionPut, "/"+dir+"/sub/b", "b1")
+
+	// Data changes as well, at any depth
+	_, err = kv.Put(ctx, dir+"/sub/b", "b2", nil)
+	assert.NoError(t, err)
+	e := expect(store.ActionPut, "/"+dir+"/sub/b", "b2")
+	assert.Equal(t, "b1", e.PreNode.Value)
+	_, err = kv.Put(ctx, dir+"/a", "a2", nil)
+	assert.NoError(t, err)
+	expect(store.ActionPut, "/"+dir+"/a", "a2")
+
+	assert.NoError(t, kv.Delete(ctx, dir+"/sub/b"))
+	e = expect(store.ActionDelete, "/"+dir+"/sub/b", "")
+	assert.Equal(t, "b2", e.PreNode.Value)
+
+	// A recreated key is watched again
+	_, err = kv.Put(ctx, dir+"/sub/b", "b3", nil)
+	assert.NoError(t, err)
+	expect(store.ActionPut, "/"+dir+"/sub/b", "b3")
+}
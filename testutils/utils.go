@@ -87,7 +87,7 @@ func testPutGetDeleteExistsUpdateCreate(t *testing.T, kv store.Store) {
 		assert.NoError(t, err, failMsg)
 
 		// Put the key
-		err = kv.Put(context.TODO(), key, value, nil)
+		put, err := kv.Put(context.TODO(), key, value, nil)
 		assert.NoError(t, err, failMsg)
 
 		// Get should return the value and an incremented index
@@ -99,6 +99,12 @@ func testPutGetDeleteExistsUpdateCreate(t *testing.T, kv store.Store) {
 		assert.Equal(t, pair.Value, value, failMsg)
 		assert.NotEqual(t, pair.Index, 0, failMsg)
 
+		// Put should return the pair as read back by Get
+		if assert.NotNil(t, put, failMsg) {
+			assert.Equal(t, pair.Value, put.Value, failMsg)
+			assert.Equal(t, pair.Index, put.Index, failMsg)
+		}
+
 		// Exists should return true
 		exists, err := kv.Exists(context.TODO(), key)
 		assert.NoError(t, err, failMsg)
@@ -136,14 +142,14 @@ func testWatch(t *testing.T, kv store.Store) {
 	newValue := "world!"
 
 	// Put the key
-	err := kv.Put(context.TODO(), key, value, nil)
+	_, err := kv.Put(context.TODO(), key, value, nil)
 	assert.NoError(t, err)
 
 	ctx, cancle := context.WithCancel(context.Background())
 	defer func() {
 		cancle()
 	}()
-	events, err := kv.Watch(ctx, key, nil)
+	events, err := kv.Watch(ctx, key, &store.WatchOptions{SkipInitialValues: true})
 	assert.NoError(t, err)
 	assert.NotNil(t, events)
 
@@ -156,7 +162,7 @@ func testWatch(t *testing.T, kv store.Store) {
 			case <-timeout:
 				return
 			case <-tick:
-				err := kv.Put(context.TODO(), key, newValue, nil)
+				_, err := kv.Put(context.TODO(), key, newValue, nil)
 				if assert.NoError(t, err) {
 					continue
 				}
@@ -175,6 +181,7 @@ LOOP:
 			assert.NotNil(t, event)
 			assert.NotNil(t, event.PreNode)
 			assert.NotNil(t, event.Node)
+			assert.Equal(t, uint64(eventCount), event.Seq)
 
 			if eventCount == 1 {
 				assert.Equal(t, event.Action, store.ActionPut)
@@ -203,7 +210,7 @@ LOOP:
 
 	// stop watch by context
 	ctx1, cancle1 := context.WithCancel(context.Background())
-	events1, err := kv.Watch(ctx1, key1, nil)
+	events1, err := kv.Watch(ctx1, key1, &store.WatchOptions{SkipInitialValues: true})
 	assert.NoError(t, err)
 	assert.NotNil(t, events1)
 	cancle1()
@@ -212,6 +219,7 @@ LOOP:
 	assert.NotNil(t, e)
 	assert.Equal(t, true, ok, failMsg)
 	assert.Error(t, e.Error, failMsg)
+	assert.Equal(t, uint64(1), e.Seq, failMsg)
 
 	e, ok = <-events1
 	assert.Nil(t, e)
@@ -230,13 +238,13 @@ func testWatchTree(t *testing.T, kv store.Store) {
 	node3 := "testWatchTree/node3"
 	value3 := "node3"
 
-	err := kv.Put(context.TODO(), node1, value1, nil)
+	_, err := kv.Put(context.TODO(), node1, value1, nil)
 	assert.NoError(t, err)
 
-	err = kv.Put(context.TODO(), node2, value2, nil)
+	_, err = kv.Put(context.TODO(), node2, value2, nil)
 	assert.NoError(t, err)
 
-	err = kv.Put(context.TODO(), node3, value3, nil)
+	_, err = kv.Put(context.TODO(), node3, value3, nil)
 	assert.NoError(t, err)
 
 	ctx, cancle := context.WithCancel(context.Background())
@@ -278,7 +286,7 @@ func testAtomicPut(t *testing.T, kv store.Store) {
 	value := "world"
 
 	// Put the key
-	err := kv.Put(context.TODO(), key, value, nil)
+	_, err := kv.Put(context.TODO(), key, value, nil)
 	assert.NoError(t, err)
 
 	// Get should return the value and an incremented index
@@ -342,7 +350,7 @@ func testAtomicDelete(t *testing.T, kv store.Store) {
 	value := "world"
 
 	// Put the key
-	err := kv.Put(context.TODO(), key, value, nil)
+	_, err := kv.Put(context.TODO(), key, value, nil)
 	assert.NoError(t, err)
 
 	// Get should return the value and an incremented index
@@ -614,11 +622,11 @@ func testPutTTL(t *testing.T, kv store.Store, otherConn store.Store) {
 	secondValue := "bar"
 
 	// Put the first key with the Ephemeral flag
-	err := otherConn.Put(context.TODO(), firstKey, firstValue, &store.WriteOptions{TTL: 2 * time.Second})
+	_, err := otherConn.Put(context.TODO(), firstKey, firstValue, &store.WriteOptions{TTL: 2 * time.Second})
 	assert.NoError(t, err)
 
 	// Put a second key with the Ephemeral flag
-	err = otherConn.Put(context.TODO(), secondKey, secondValue, &store.WriteOptions{TTL: 2 * time.Second})
+	_, err = otherConn.Put(context.TODO(), secondKey, secondValue, &store.WriteOptions{TTL: 2 * time.Second})
 	assert.NoError(t, err)
 
 	// Get on firstKey should work
@@ -658,11 +666,11 @@ func testList(t *testing.T, kv store.Store) {
 	secondValue := "second"
 
 	// Put the first key
-	err := kv.Put(context.TODO(), firstKey, firstValue, nil)
+	_, err := kv.Put(context.TODO(), firstKey, firstValue, nil)
 	assert.NoError(t, err)
 
 	// Put the second key
-	err = kv.Put(context.TODO(), secondKey, secondValue, nil)
+	_, err = kv.Put(context.TODO(), secondKey, secondValue, nil)
 	assert.NoError(t, err)
 
 	// List should work and return the two correct values
@@ -700,11 +708,11 @@ func testDeleteTree(t *testing.T, kv store.Store) {
 	secondValue := "second"
 
 	// Put the first key
-	err := kv.Put(context.TODO(), firstKey, firstValue, nil)
+	_, err := kv.Put(context.TODO(), firstKey, firstValue, nil)
 	assert.NoError(t, err)
 
 	// Put the second key
-	err = kv.Put(context.TODO(), secondKey, secondValue, nil)
+	_, err = kv.Put(context.TODO(), secondKey, secondValue, nil)
 	assert.NoError(t, err)
 
 	// Get should work on the first Key